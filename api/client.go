@@ -255,6 +255,23 @@ func (c *Client) Pull(ctx context.Context, req *PullRequest, fn PullProgressFunc
 	})
 }
 
+// VerifyProgressFunc is a function that [Client.Verify] invokes when progress
+// is made, and with the results.
+type VerifyProgressFunc func(VerifyResponse) error
+
+// Verify checks the blobs of a model, or of all models, against their digests.
+// With req.Repair set, missing and corrupt blobs are pulled again.
+func (c *Client) Verify(ctx context.Context, req *VerifyRequest, fn VerifyProgressFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/verify", req, func(bts []byte) error {
+		var resp VerifyResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
 // PushProgressFunc is a function that [Client.Push] invokes when progress is
 // made.
 // It's similar to other progress function types like [PullProgressFunc].
@@ -294,6 +311,16 @@ func (c *Client) Create(ctx context.Context, req *CreateRequest, fn CreateProgre
 	})
 }
 
+// Lint checks a Modelfile and reports the problems found in it, without
+// creating a model.
+func (c *Client) Lint(ctx context.Context, req *LintRequest) (*LintResponse, error) {
+	var resp LintResponse
+	if err := c.do(ctx, http.MethodPost, "/api/lint", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // List lists models that are available locally.
 func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	var lr ListResponse
@@ -312,6 +339,43 @@ func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	return &lr, nil
 }
 
+// DiskUsage reports the disk space used by each model.
+func (c *Client) DiskUsage(ctx context.Context) (*DiskUsageResponse, error) {
+	var resp DiskUsageResponse
+	if err := c.do(ctx, http.MethodGet, "/api/du", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Diff compares two models.
+func (c *Client) Diff(ctx context.Context, req *DiffRequest) (*DiffResponse, error) {
+	var resp DiffResponse
+	if err := c.do(ctx, http.MethodPost, "/api/diff", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RenderTemplate renders a chat with a model's template and returns the
+// prompt the model would be given.
+func (c *Client) RenderTemplate(ctx context.Context, req *RenderTemplateRequest) (*RenderTemplateResponse, error) {
+	var resp RenderTemplateResponse
+	if err := c.do(ctx, http.MethodPost, "/api/template/render", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GC removes the blobs which no model uses.
+func (c *Client) GC(ctx context.Context, req *GCRequest) (*GCResponse, error) {
+	var resp GCResponse
+	if err := c.do(ctx, http.MethodPost, "/api/gc", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Copy copies a model - creating a model with another name from an existing
 // model.
 func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
@@ -321,12 +385,78 @@ func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
 	return nil
 }
 
+// Alias creates an alias pointing at a model, or points an existing alias at
+// another model.
+func (c *Client) Alias(ctx context.Context, req *AliasRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/alias", req, nil)
+}
+
+// CreateSession creates a conversation stored by the server.
+func (c *Client) CreateSession(ctx context.Context, req *CreateSessionRequest) (*Session, error) {
+	var resp Session
+	if err := c.do(ctx, http.MethodPost, "/api/sessions", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Sessions lists the stored conversations.
+func (c *Client) Sessions(ctx context.Context) (*SessionsResponse, error) {
+	var resp SessionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/sessions", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Session returns a stored conversation with its history.
+func (c *Client) Session(ctx context.Context, id string) (*Session, error) {
+	var resp Session
+	if err := c.do(ctx, http.MethodGet, "/api/sessions/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AppendSession appends messages to the history of a stored conversation.
+func (c *Client) AppendSession(ctx context.Context, id string, req *AppendSessionRequest) (*Session, error) {
+	var resp Session
+	if err := c.do(ctx, http.MethodPost, "/api/sessions/"+url.PathEscape(id)+"/messages", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ForkSession copies a stored conversation into a new one.
+func (c *Client) ForkSession(ctx context.Context, id string, req *ForkSessionRequest) (*Session, error) {
+	var resp Session
+	if err := c.do(ctx, http.MethodPost, "/api/sessions/"+url.PathEscape(id)+"/fork", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteSession deletes a stored conversation.
+func (c *Client) DeleteSession(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/sessions/"+url.PathEscape(id), nil, nil)
+}
+
+// Aliases lists the aliases and the models they point at.
+func (c *Client) Aliases(ctx context.Context) (*AliasesResponse, error) {
+	var resp AliasesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/aliases", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Delete deletes a model and its data.
-func (c *Client) Delete(ctx context.Context, req *DeleteRequest) error {
-	if err := c.do(ctx, http.MethodDelete, "/api/delete", req, nil); err != nil {
-		return err
+func (c *Client) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	var resp DeleteResponse
+	if err := c.do(ctx, http.MethodDelete, "/api/delete", req, &resp); err != nil {
+		return nil, err
 	}
-	return nil
+	return &resp, nil
 }
 
 // Show obtains model information, including details, modelfile, license etc.
@@ -362,6 +492,76 @@ func (c *Client) CreateBlob(ctx context.Context, digest string, r io.Reader) err
 	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/blobs/%s", digest), r, nil)
 }
 
+// Export writes a model as a tarball in OCI image layout to w.
+func (c *Client) Export(ctx context.Context, req *ExportRequest, w io.Writer) error {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, c.base.JoinPath("/api/export"), "application/json", bytes.NewReader(bts))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Import reads a tarball in OCI image layout, as written by [Client.Export],
+// from r and registers the models it holds. If name is not empty the tarball
+// must hold a single model which is imported under that name.
+func (c *Client) Import(ctx context.Context, r io.Reader, name string) (*ImportResponse, error) {
+	requestURL := c.base.JoinPath("/api/import")
+	if name != "" {
+		requestURL.RawQuery = url.Values{"name": {name}}.Encode()
+	}
+
+	resp, err := c.send(ctx, requestURL, "application/x-tar", r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var importResp ImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&importResp); err != nil {
+		return nil, err
+	}
+
+	return &importResp, nil
+}
+
+// send posts body to requestURL as is and returns the response for the caller
+// to read, for endpoints whose request or response isn't JSON.
+func (c *Client) send(ctx context.Context, requestURL *url.URL, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+
+	resp, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		bts, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, checkError(resp, bts)
+	}
+
+	return resp, nil
+}
+
 // Version returns the Ollama server version as a string.
 func (c *Client) Version(ctx context.Context) (string, error) {
 	var version struct {
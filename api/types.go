@@ -77,6 +77,16 @@ type GenerateRequest struct {
 	// Options lists model-specific options. For example, temperature can be
 	// set through this field, if the model supports it.
 	Options map[string]interface{} `json:"options"`
+
+	// Session is an optional identifier for a conversation. Requests with the
+	// same session are routed to the same runner slot so the evaluated prompt
+	// can be reused.
+	Session string `json:"session,omitempty"`
+
+	// Adapters selects the named LoRA adapters of the model to apply, mapped
+	// to their scale. A scale of 0 uses the adapter's default scale. If nil,
+	// every adapter is applied at its default scale.
+	Adapters map[string]float32 `json:"adapters,omitempty"`
 }
 
 // ChatRequest describes a request sent by [Client.Chat].
@@ -99,8 +109,42 @@ type ChatRequest struct {
 
 	// Options lists model-specific options.
 	Options map[string]interface{} `json:"options"`
+
+	// Session is an optional conversation identifier, as in [GenerateRequest].
+	// If it's the ID of a [Session] stored by the server, Messages are
+	// appended to its history and the response is recorded in it. Model and
+	// Options default to those of the session.
+	Session string `json:"session,omitempty"`
+
+	// Adapters selects the named LoRA adapters to apply, as in [GenerateRequest].
+	Adapters map[string]float32 `json:"adapters,omitempty"`
+
+	// Overflow selects how messages which don't fit into the context window
+	// are handled, one of the Overflow constants. The default is
+	// [OverflowTruncate].
+	Overflow string `json:"overflow,omitempty"`
 }
 
+// Strategies for chat messages which don't fit into the context window.
+const (
+	// OverflowTruncate drops the oldest messages, keeping system messages.
+	OverflowTruncate = "truncate"
+
+	// OverflowMiddle drops the messages after the first user message,
+	// keeping system messages.
+	OverflowMiddle = "middle"
+
+	// OverflowContent shortens the content of the longest messages.
+	OverflowContent = "content"
+
+	// OverflowSummarize drops the oldest messages as [OverflowTruncate] does
+	// and adds a system message with a summary of them written by the model.
+	OverflowSummarize = "summarize"
+
+	// OverflowError fails the request.
+	OverflowError = "error"
+)
+
 // Message is a single message in a chat sequence. The message contains the
 // role ("system", "user", or "assistant"), the content and an optional list
 // of images.
@@ -120,6 +164,10 @@ type ChatResponse struct {
 
 	Done bool `json:"done"`
 
+	// DroppedMessages is the number of messages left out of the prompt
+	// because they don't fit into the context window.
+	DroppedMessages int `json:"dropped_messages,omitempty"`
+
 	Metrics
 }
 
@@ -127,9 +175,12 @@ type Metrics struct {
 	TotalDuration      time.Duration `json:"total_duration,omitempty"`
 	LoadDuration       time.Duration `json:"load_duration,omitempty"`
 	PromptEvalCount    int           `json:"prompt_eval_count,omitempty"`
+	PromptCachedCount  int           `json:"prompt_cached_count,omitempty"`
 	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int           `json:"eval_count,omitempty"`
 	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+	DraftCount         int           `json:"draft_count,omitempty"`
+	DraftAcceptedCount int           `json:"draft_accepted_count,omitempty"`
 }
 
 // Options specified in [GenerateRequest], if you add a new option here add it
@@ -171,6 +222,20 @@ type Runner struct {
 	UseMMap   *bool `json:"use_mmap,omitempty"`
 	UseMLock  bool  `json:"use_mlock,omitempty"`
 	NumThread int   `json:"num_thread,omitempty"`
+
+	// KVCacheType is the data type of the KV cache, e.g. "q8_0". It takes
+	// precedence over F16KV and OLLAMA_KV_CACHE_TYPE when set.
+	KVCacheType string `json:"kv_cache_type,omitempty"`
+
+	// RoPE scaling extends the context of a model beyond the length it was
+	// trained with. Zero values use the model's defaults.
+	RopeFrequencyBase  float32 `json:"rope_freq_base,omitempty"`
+	RopeFrequencyScale float32 `json:"rope_freq_scale,omitempty"`
+	RopeScalingType    string  `json:"rope_scaling_type,omitempty"`
+	YarnExtFactor      float32 `json:"yarn_ext_factor,omitempty"`
+	YarnAttnFactor     float32 `json:"yarn_attn_factor,omitempty"`
+	YarnBetaFast       float32 `json:"yarn_beta_fast,omitempty"`
+	YarnBetaSlow       float32 `json:"yarn_beta_slow,omitempty"`
 }
 
 // EmbeddingRequest is the request passed to [Client.Embeddings].
@@ -202,6 +267,9 @@ type CreateRequest struct {
 	Stream    *bool  `json:"stream,omitempty"`
 	Quantize  string `json:"quantize,omitempty"`
 
+	// Spec defines the model instead of a Modelfile.
+	Spec *ModelSpec `json:"spec,omitempty"`
+
 	// Name is deprecated, see Model
 	Name string `json:"name"`
 
@@ -209,6 +277,70 @@ type CreateRequest struct {
 	Quantization string `json:"quantization,omitempty"`
 }
 
+// ModelSpec is a structured model definition, an alternative to a Modelfile.
+// Each field corresponds to a Modelfile command.
+type ModelSpec struct {
+	// From is the model, file or blob the model is created from.
+	From string `json:"from"`
+
+	// Projectors are the multimodal projectors, which are set with further
+	// FROM commands in a Modelfile.
+	Projectors []string `json:"projectors,omitempty"`
+
+	Adapters   []AdapterSpec  `json:"adapters,omitempty"`
+	Draft      string         `json:"draft,omitempty"`
+	Template   string         `json:"template,omitempty"`
+	System     string         `json:"system,omitempty"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+	Messages   []Message      `json:"messages,omitempty"`
+	License    []string       `json:"license,omitempty"`
+}
+
+// AdapterSpec is an adapter in a [ModelSpec].
+type AdapterSpec struct {
+	From  string  `json:"from"`
+	Name  string  `json:"name,omitempty"`
+	Scale float32 `json:"scale,omitempty"`
+}
+
+// LintRequest is the request passed to [Client.Lint].
+type LintRequest struct {
+	// Modelfile is the content of the Modelfile to check.
+	Modelfile string `json:"modelfile"`
+
+	// Path is the path of the Modelfile on the server. Relative paths in
+	// FROM, ADAPTER and DRAFT are resolved against its directory. The file
+	// is read if Modelfile is empty.
+	Path string `json:"path,omitempty"`
+
+	// Vars are the values of the variables in the Modelfile. Variables which
+	// aren't set are reported unless they have a default.
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// LintResponse is the response returned from [Client.Lint].
+type LintResponse struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Diagnostic is a problem found in a Modelfile.
+type Diagnostic struct {
+	// File is the path of the included file the problem is in, and empty
+	// for problems in the Modelfile itself.
+	File string `json:"file,omitempty"`
+
+	// Line and Column are the position of the problem, starting at 1. Both
+	// are 0 for problems with the file as a whole.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+
+	// Severity is "error" for problems which fail a create, and "warning"
+	// for ones which don't.
+	Severity string `json:"severity"`
+
+	Message string `json:"message"`
+}
+
 // DeleteRequest is the request passed to [Client.Delete].
 type DeleteRequest struct {
 	Model string `json:"model"`
@@ -217,6 +349,12 @@ type DeleteRequest struct {
 	Name string `json:"name"`
 }
 
+// DeleteResponse is the response returned by [Client.Delete].
+type DeleteResponse struct {
+	// Aliases are the aliases left pointing at the deleted model.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
 // ShowRequest is the request passed to [Client.Show].
 type ShowRequest struct {
 	Model    string `json:"model"`
@@ -234,6 +372,7 @@ type ShowRequest struct {
 type ShowResponse struct {
 	License       string         `json:"license,omitempty"`
 	Modelfile     string         `json:"modelfile,omitempty"`
+	Spec          *ModelSpec     `json:"spec,omitempty"`
 	Parameters    string         `json:"parameters,omitempty"`
 	Template      string         `json:"template,omitempty"`
 	System        string         `json:"system,omitempty"`
@@ -250,6 +389,264 @@ type CopyRequest struct {
 	Destination string `json:"destination"`
 }
 
+// AliasRequest is the request passed to [Client.Alias].
+type AliasRequest struct {
+	// Name is the alias to create or retarget.
+	Name string `json:"name"`
+
+	// Target is the model the alias points at.
+	Target string `json:"target"`
+}
+
+// AliasesResponse is the response returned from [Client.Aliases].
+type AliasesResponse struct {
+	Aliases []AliasResponse `json:"aliases"`
+}
+
+// AliasResponse is a single alias in [AliasesResponse].
+type AliasResponse struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+
+	// Missing is true if the target model doesn't exist, e.g. because it
+	// was deleted after the alias was created.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// CreateSessionRequest is the request passed to [Client.CreateSession].
+type CreateSessionRequest struct {
+	// Model is the model the session chats with.
+	Model string `json:"model"`
+
+	// Options lists model-specific options used for each chat in the session.
+	Options map[string]any `json:"options,omitempty"`
+
+	// Messages starts the history of the session, e.g. with a system message.
+	Messages []Message `json:"messages,omitempty"`
+}
+
+// AppendSessionRequest is the request passed to [Client.AppendSession].
+type AppendSessionRequest struct {
+	// Messages are appended to the history of the session without
+	// generating a response.
+	Messages []Message `json:"messages"`
+}
+
+// ForkSessionRequest is the request passed to [Client.ForkSession].
+type ForkSessionRequest struct {
+	// Messages is the number of messages of the history to copy to the new
+	// session. If zero, the whole history is copied.
+	Messages int `json:"messages,omitempty"`
+}
+
+// Session is a conversation stored by the server, which chats continue by
+// setting [ChatRequest.Session] to its ID.
+type Session struct {
+	ID       string         `json:"id"`
+	Model    string         `json:"model"`
+	Options  map[string]any `json:"options,omitempty"`
+	Messages []Message      `json:"messages,omitempty"`
+
+	// Parent is the ID of the session this session was forked from.
+	Parent string `json:"parent,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// SessionsResponse is the response returned from [Client.Sessions].
+type SessionsResponse struct {
+	// Sessions is sorted by when they were last modified, most recent
+	// first. Their messages are left out.
+	Sessions []SessionSummary `json:"sessions"`
+}
+
+// SessionSummary is a single session in [SessionsResponse].
+type SessionSummary struct {
+	ID         string    `json:"id"`
+	Model      string    `json:"model"`
+	Messages   int       `json:"messages"`
+	Parent     string    `json:"parent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// ExportRequest is the request passed to [Client.Export].
+type ExportRequest struct {
+	Model string `json:"model"`
+}
+
+// ImportResponse is the response returned from [Client.Import].
+type ImportResponse struct {
+	// Models lists the names of the imported models.
+	Models []string `json:"models"`
+}
+
+// VerifyRequest is the request passed to [Client.Verify].
+type VerifyRequest struct {
+	// Model is the model to verify. All models are verified if it is empty.
+	Model string `json:"model,omitempty"`
+
+	// Repair downloads missing and corrupt blobs again.
+	Repair   bool  `json:"repair,omitempty"`
+	Insecure bool  `json:"insecure,omitempty"`
+	Stream   *bool `json:"stream,omitempty"`
+}
+
+// VerifyResponse is the response passed to [VerifyProgressFunc]. It reports
+// progress until the last response, with status "success", which holds the
+// results.
+type VerifyResponse struct {
+	ProgressResponse
+
+	Missing  []BlobInfo `json:"missing,omitempty"`
+	Corrupt  []BlobInfo `json:"corrupt,omitempty"`
+	Orphaned []BlobInfo `json:"orphaned,omitempty"`
+	Repaired []BlobInfo `json:"repaired,omitempty"`
+}
+
+// BlobInfo describes a blob in the model store and the models using it.
+type BlobInfo struct {
+	Digest string   `json:"digest"`
+	Size   int64    `json:"size"`
+	Models []string `json:"models,omitempty"`
+
+	// Partial is true for the files of an abandoned partial download of the
+	// blob.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// GCRequest is the request passed to [Client.GC].
+type GCRequest struct {
+	// DryRun reports the blobs which would be removed without removing them.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// GCResponse is the response returned from [Client.GC].
+type GCResponse struct {
+	// Blobs lists the blobs which were removed, or would be with DryRun.
+	Blobs []BlobInfo `json:"blobs"`
+
+	// Size is the number of bytes reclaimed, or which would be with DryRun.
+	Size int64 `json:"size"`
+}
+
+// DiffRequest is the request passed to [Client.Diff].
+type DiffRequest struct {
+	// From and To are the models to compare.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DiffResponse is the response returned from [Client.Diff].
+type DiffResponse struct {
+	// Layers lists the layers of both models.
+	Layers []LayerDiff `json:"layers"`
+
+	// Changes lists the fields which differ between the models.
+	Changes []FieldDiff `json:"changes"`
+}
+
+// LayerDiff is a layer in [DiffResponse].
+type LayerDiff struct {
+	MediaType string `json:"media_type"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+
+	// Status is "shared" for a layer both models have, "removed" for one
+	// only From has and "added" for one only To has.
+	Status string `json:"status"`
+}
+
+// FieldDiff is a field which differs between the models in [DiffResponse].
+type FieldDiff struct {
+	// Field is "template", "system", "messages", "license", or a parameter
+	// or GGUF metadata key prefixed with "parameters." or "model_info.".
+	Field string `json:"field"`
+
+	// From and To are the values of the field as text, empty if the model
+	// doesn't set it.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RenderTemplateRequest is the request passed to [Client.RenderTemplate].
+type RenderTemplateRequest struct {
+	// Model is the model whose template is rendered.
+	Model string `json:"model"`
+
+	// Messages are the messages of the chat, as in [ChatRequest].
+	Messages []Message `json:"messages"`
+
+	// System is a system message to prepend to the messages.
+	System string `json:"system,omitempty"`
+
+	// Template overrides the model's template, for trying out changes to
+	// it without creating a model.
+	Template string `json:"template,omitempty"`
+
+	// Overflow selects how messages which don't fit into the context window
+	// are handled, as in [ChatRequest].
+	Overflow string `json:"overflow,omitempty"`
+
+	// Options lists model-specific options, such as num_ctx.
+	Options map[string]interface{} `json:"options"`
+
+	// KeepAlive controls how long the model will stay loaded into memory
+	// after the prompt is tokenized.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+}
+
+// RenderTemplateResponse is the response returned from
+// [Client.RenderTemplate].
+type RenderTemplateResponse struct {
+	// Prompt is the prompt the model would be given for the chat.
+	Prompt string `json:"prompt"`
+
+	// Mode is "messages" when the template ranges over the messages, or
+	// "legacy" when it's executed for each prompt and response.
+	Mode string `json:"mode"`
+
+	// Messages is the number of messages rendered into the prompt, and
+	// Dropped the number left out because they don't fit into the context
+	// window.
+	Messages int `json:"messages"`
+	Dropped  int `json:"dropped"`
+
+	// Images is the number of images given to the model with the prompt.
+	Images int `json:"images"`
+
+	// PromptTokens is the number of tokens in the prompt and NumCtx the size
+	// of the context window.
+	PromptTokens int `json:"prompt_tokens"`
+	NumCtx       int `json:"num_ctx"`
+}
+
+// DiskUsageResponse is the response returned from [Client.DiskUsage].
+type DiskUsageResponse struct {
+	Models []ModelDiskUsage `json:"models"`
+
+	// Size is the total size of the blobs used by models.
+	Size int64 `json:"size"`
+
+	// Reclaimable is the size of the blobs which no model uses.
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// ModelDiskUsage is the disk usage of a single model in [DiskUsageResponse].
+type ModelDiskUsage struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	Size  int64  `json:"size"`
+
+	// Unique is the size of the blobs only this model uses, which deleting
+	// it frees.
+	Unique int64 `json:"unique"`
+
+	// Shared is the size of the blobs this model shares with other models.
+	Shared int64 `json:"shared"`
+}
+
 // PullRequest is the request passed to [Client.Pull].
 type PullRequest struct {
 	Model    string `json:"model"`
@@ -258,6 +655,11 @@ type PullRequest struct {
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// MaxRate limits the download rate of the pull in bytes per second. A
+	// blob already being downloaded by another pull is downloaded at the
+	// lower of their rates.
+	MaxRate int64 `json:"max_rate,omitempty"`
+
 	// Name is deprecated, see Model
 	Name string `json:"name"`
 }
@@ -279,6 +681,12 @@ type PushRequest struct {
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// Sign pushes a signature of the manifest made with the server's key.
+	Sign bool `json:"sign,omitempty"`
+
+	// MaxRate limits the upload rate of the push in bytes per second.
+	MaxRate int64 `json:"max_rate,omitempty"`
+
 	// Name is deprecated, see Model
 	Name string `json:"name"`
 }
@@ -298,9 +706,13 @@ type ListModelResponse struct {
 	Name       string       `json:"name"`
 	Model      string       `json:"model"`
 	ModifiedAt time.Time    `json:"modified_at"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
 	Size       int64        `json:"size"`
 	Digest     string       `json:"digest"`
 	Details    ModelDetails `json:"details,omitempty"`
+
+	// Target is the model an alias points at. It is empty for models.
+	Target string `json:"target,omitempty"`
 }
 
 // ProcessModelResponse is a single model description in [ProcessResponse].
@@ -312,6 +724,32 @@ type ProcessModelResponse struct {
 	Details   ModelDetails `json:"details,omitempty"`
 	ExpiresAt time.Time    `json:"expires_at"`
 	SizeVRAM  int64        `json:"size_vram"`
+
+	// PromptCache reports reuse of persisted prompt prefixes when
+	// OLLAMA_PROMPT_CACHE is enabled.
+	PromptCache *PromptCacheStats `json:"prompt_cache,omitempty"`
+
+	// Draft reports how many tokens proposed by the model's draft model were
+	// accepted, only set for models with a DRAFT.
+	Draft *DraftStats `json:"draft,omitempty"`
+}
+
+// DraftStats counts the tokens proposed by a draft model during speculative
+// decoding (Count) and how many of those were accepted by the model
+// (Accepted).
+type DraftStats struct {
+	Count          int64   `json:"count"`
+	Accepted       int64   `json:"accepted"`
+	AcceptanceRate float64 `json:"acceptance_rate"`
+}
+
+// PromptCacheStats counts how often a saved prompt prefix was restored into
+// the runner (Hits), how often a long prompt had no saved prefix (Misses) and
+// how many prefixes were saved (Saves).
+type PromptCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Saves  int64 `json:"saves"`
 }
 
 type RetrieveModelResponse struct {
@@ -372,6 +810,10 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "prompt eval count:    %d token(s)\n", m.PromptEvalCount)
 	}
 
+	if m.PromptCachedCount > 0 {
+		fmt.Fprintf(os.Stderr, "prompt cached count:  %d token(s)\n", m.PromptCachedCount)
+	}
+
 	if m.PromptEvalDuration > 0 {
 		fmt.Fprintf(os.Stderr, "prompt eval duration: %s\n", m.PromptEvalDuration)
 		fmt.Fprintf(os.Stderr, "prompt eval rate:     %.2f tokens/s\n", float64(m.PromptEvalCount)/m.PromptEvalDuration.Seconds())
@@ -385,6 +827,11 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "eval duration:        %s\n", m.EvalDuration)
 		fmt.Fprintf(os.Stderr, "eval rate:            %.2f tokens/s\n", float64(m.EvalCount)/m.EvalDuration.Seconds())
 	}
+
+	if m.DraftCount > 0 {
+		fmt.Fprintf(os.Stderr, "draft count:          %d token(s)\n", m.DraftCount)
+		fmt.Fprintf(os.Stderr, "draft acceptance:     %.2f%%\n", 100*float64(m.DraftAcceptedCount)/float64(m.DraftCount))
+	}
 }
 
 func (opts *Options) FromMap(m map[string]interface{}) error {
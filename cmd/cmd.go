@@ -7,6 +7,7 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"regexp"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -28,9 +30,11 @@ import (
 	"github.com/containerd/console"
 	"github.com/mattn/go-runewidth"
 	"github.com/olekukonko/tablewriter"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/auth"
@@ -59,15 +63,34 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+	var modelfile *parser.File
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".yaml", ".yml":
+		spec, err := readSpec(filename)
+		if err != nil {
+			return err
+		}
 
-	modelfile, err := parser.ParseFile(f)
-	if err != nil {
-		return err
+		modelfile, err = parser.ParseSpec(*spec)
+		if err != nil {
+			return err
+		}
+	default:
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		lookup, err := modelfileVars(cmd)
+		if err != nil {
+			return err
+		}
+
+		modelfile, err = parser.ParseFileWithOptions(f, parser.ParseOptions{Dir: filepath.Dir(filename), Lookup: lookup})
+		if err != nil {
+			return err
+		}
 	}
 
 	home, err := os.UserHomeDir()
@@ -155,6 +178,218 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func LintHandler(cmd *cobra.Command, args []string) error {
+	filename := "Modelfile"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	lookup, err := modelfileVars(cmd)
+	if err != nil {
+		return err
+	}
+
+	// send the values of the variables the Modelfile and the files it
+	// includes use, rather than the whole environment
+	vars := make(map[string]string)
+	parser.ParseFileAll(bytes.NewReader(bts), parser.ParseOptions{
+		Dir: filepath.Dir(path),
+		Lookup: func(name string) (string, bool) {
+			v, ok := lookup(name)
+			if ok {
+				vars[name] = v
+			}
+
+			return v, ok
+		},
+	})
+
+	resp, err := client.Lint(cmd.Context(), &api.LintRequest{Modelfile: string(bts), Path: path, Vars: vars})
+	if err != nil {
+		return err
+	}
+
+	var errs int
+	for _, d := range resp.Diagnostics {
+		if d.Severity == "error" {
+			errs++
+		}
+
+		name := filename
+		if d.File != "" {
+			name = d.File
+		}
+
+		if d.Line > 0 {
+			fmt.Printf("%s:%d:%d: %s: %s\n", name, d.Line, d.Column, d.Severity, d.Message)
+		} else {
+			fmt.Printf("%s: %s: %s\n", name, d.Severity, d.Message)
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%s has %d error(s)", filename, errs)
+	}
+
+	return nil
+}
+
+func FormatHandler(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"Modelfile"}
+	}
+
+	write, err := cmd.Flags().GetBool("write")
+	if err != nil {
+		return err
+	}
+
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+
+	var unformatted int
+	for _, filename := range args {
+		bts, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		syntax, err := parser.ParseSyntax(bytes.NewReader(bts))
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+
+		formatted := syntax.Format()
+		switch {
+		case check:
+			if formatted != string(bts) {
+				fmt.Println(filename)
+				unformatted++
+			}
+		case write:
+			if formatted == string(bts) {
+				continue
+			}
+
+			fi, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(filename, []byte(formatted), fi.Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) aren't formatted", unformatted)
+	}
+
+	return nil
+}
+
+// readSpec reads a model spec from a JSON or YAML file.
+func readSpec(filename string) (*api.ModelSpec, error) {
+	bts, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, so either is decoded as YAML and then converted to JSON
+	// so the spec's JSON field names apply
+	var v any
+	if err := yaml.Unmarshal(bts, &v); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if bts, err = json.Marshal(v); err != nil {
+		return nil, err
+	}
+
+	var spec api.ModelSpec
+	if err := json.Unmarshal(bts, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return &spec, nil
+}
+
+// marshalSpec encodes a model spec as YAML, with the fields in the same
+// order as in JSON and multiline strings as literal blocks.
+func marshalSpec(spec *api.ModelSpec) ([]byte, error) {
+	bts, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(bts, &node); err != nil {
+		return nil, err
+	}
+
+	var reset func(*yaml.Node)
+	reset = func(n *yaml.Node) {
+		n.Style = 0
+		if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "\n") {
+			n.Style = yaml.LiteralStyle
+		}
+
+		for _, c := range n.Content {
+			reset(c)
+		}
+	}
+
+	reset(&node)
+	return yaml.Marshal(&node)
+}
+
+// modelfileVars returns a lookup for the variables in a Modelfile, which
+// are set with --var NAME=VALUE flags or else from the environment.
+func modelfileVars(cmd *cobra.Command) (func(string) (string, bool), error) {
+	flags, err := cmd.Flags().GetStringArray("var")
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, flag := range flags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected NAME=VALUE", flag)
+		}
+
+		vars[name] = value
+	}
+
+	return func(name string) (string, bool) {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+
+		return os.LookupEnv(name)
+	}, nil
+}
+
 func tempZipFiles(path string) (string, error) {
 	tempfile, err := os.CreateTemp("", "ollama-tf")
 	if err != nil {
@@ -422,6 +657,16 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	sign, err := cmd.Flags().GetBool("sign")
+	if err != nil {
+		return err
+	}
+
+	maxRate, err := maxRateFlag(cmd)
+	if err != nil {
+		return err
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -456,7 +701,7 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	request := api.PushRequest{Name: args[0], Insecure: insecure}
+	request := api.PushRequest{Name: args[0], Insecure: insecure, Sign: sign, MaxRate: maxRate}
 	if err := client.Push(cmd.Context(), &request, fn); err != nil {
 		if spinner != nil {
 			spinner.Stop()
@@ -494,12 +739,22 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 
 	for _, m := range models.Models {
 		if len(args) == 0 || strings.HasPrefix(m.Name, args[0]) {
-			data = append(data, []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")})
+			name := m.Name
+			if m.Target != "" {
+				name += " -> " + m.Target
+			}
+
+			lastUsed := "Never"
+			if m.LastUsedAt != nil {
+				lastUsed = format.HumanTime(*m.LastUsedAt, "Never")
+			}
+
+			data = append(data, []string{name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never"), lastUsed})
 		}
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"NAME", "ID", "SIZE", "MODIFIED"})
+	table.SetHeader([]string{"NAME", "ID", "SIZE", "MODIFIED", "LAST USED"})
 	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetHeaderLine(false)
@@ -566,11 +821,18 @@ func DeleteHandler(cmd *cobra.Command, args []string) error {
 
 	for _, name := range args {
 		req := api.DeleteRequest{Name: name}
-		if err := client.Delete(cmd.Context(), &req); err != nil {
+		resp, err := client.Delete(cmd.Context(), &req)
+		if err != nil {
 			return err
 		}
 		fmt.Printf("deleted '%s'\n", name)
+
+		// deleting a model leaves the aliases pointing at it dangling
+		for _, alias := range resp.Aliases {
+			fmt.Fprintf(os.Stderr, "warning: alias '%s' points at missing model '%s'\n", alias, name)
+		}
 	}
+
 	return nil
 }
 
@@ -585,8 +847,9 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	parameters, errParams := cmd.Flags().GetBool("parameters")
 	system, errSystem := cmd.Flags().GetBool("system")
 	template, errTemplate := cmd.Flags().GetBool("template")
+	spec, errSpec := cmd.Flags().GetString("spec")
 
-	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate} {
+	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate, errSpec} {
 		if boolErr != nil {
 			return errors.New("error retrieving flags")
 		}
@@ -620,8 +883,13 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 		showType = "template"
 	}
 
+	if spec != "" {
+		flagsSet++
+		showType = "spec"
+	}
+
 	if flagsSet > 1 {
-		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', or '--template' can be specified")
+		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', '--template', or '--spec' can be specified")
 	}
 
 	req := api.ShowRequest{Name: args[0]}
@@ -642,6 +910,27 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 			fmt.Println(resp.System)
 		case "template":
 			fmt.Println(resp.Template)
+		case "spec":
+			if resp.Spec == nil {
+				return errors.New("model can't be shown as a spec")
+			}
+
+			var bts []byte
+			switch spec {
+			case "json":
+				bts, err = json.MarshalIndent(resp.Spec, "", "  ")
+				bts = append(bts, '\n')
+			case "yaml":
+				bts, err = marshalSpec(resp.Spec)
+			default:
+				return fmt.Errorf("unknown spec format %q, expected yaml or json", spec)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			os.Stdout.Write(bts)
 		}
 
 		return nil
@@ -779,79 +1068,678 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func PullHandler(cmd *cobra.Command, args []string) error {
-	insecure, err := cmd.Flags().GetBool("insecure")
+func AliasHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
 	}
 
-	client, err := api.ClientFromEnvironment()
+	if len(args) == 2 {
+		req := api.AliasRequest{Name: args[0], Target: args[1]}
+		if err := client.Alias(cmd.Context(), &req); err != nil {
+			return err
+		}
+		fmt.Printf("'%s' now points at '%s'\n", args[0], args[1])
+		return nil
+	}
+
+	aliases, err := client.Aliases(cmd.Context())
 	if err != nil {
 		return err
 	}
 
-	p := progress.NewProgress(os.Stderr)
-	defer p.Stop()
+	var data [][]string
+	for _, a := range aliases.Aliases {
+		target := a.Target
+		if a.Missing {
+			target += " (missing)"
+		}
 
-	bars := make(map[string]*progress.Bar)
+		data = append(data, []string{a.Name, target})
+	}
 
-	var status string
-	var spinner *progress.Spinner
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "TARGET"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
 
-	fn := func(resp api.ProgressResponse) error {
-		if resp.Digest != "" {
-			if spinner != nil {
-				spinner.Stop()
-			}
+	return nil
+}
 
-			bar, ok := bars[resp.Digest]
-			if !ok {
-				bar = progress.NewBar(fmt.Sprintf("pulling %s...", resp.Digest[7:19]), resp.Total, resp.Completed)
-				bars[resp.Digest] = bar
-				p.Add(resp.Digest, bar)
-			}
+func ExportHandler(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
 
-			bar.Set(resp.Completed)
-		} else if status != resp.Status {
-			if spinner != nil {
-				spinner.Stop()
-			}
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
 
-			status = resp.Status
-			spinner = progress.NewSpinner(status)
-			p.Add(status, spinner)
+	w := os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
 		}
+		defer f.Close()
 
-		return nil
+		w = f
+	} else if term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("refusing to write a tarball to a terminal, use --output to name a file")
 	}
 
-	request := api.PullRequest{Name: args[0], Insecure: insecure}
-	if err := client.Pull(cmd.Context(), &request, fn); err != nil {
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	spinner := progress.NewSpinner(fmt.Sprintf("exporting %s", args[0]))
+	p.Add("", spinner)
+
+	if err := client.Export(cmd.Context(), &api.ExportRequest{Model: args[0]}, w); err != nil {
+		if w != os.Stdout {
+			os.Remove(output)
+		}
+
 		return err
 	}
 
 	return nil
 }
 
-type generateContextKey string
+func ImportHandler(cmd *cobra.Command, args []string) error {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
 
-type runOptions struct {
-	Model       string
-	ParentModel string
-	Prompt      string
-	Messages    []api.Message
-	WordWrap    bool
-	Format      string
-	System      string
-	Template    string
-	Images      []api.ImageData
-	Options     map[string]interface{}
-	MultiModal  bool
-	KeepAlive   *api.Duration
-}
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
 
-type displayResponseState struct {
-	lineLength int
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p := progress.NewProgress(os.Stderr)
+	spinner := progress.NewSpinner(fmt.Sprintf("importing %s", args[0]))
+	p.Add("", spinner)
+
+	resp, err := client.Import(cmd.Context(), f, name)
+	p.Stop()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range resp.Models {
+		fmt.Printf("imported '%s'\n", m)
+	}
+
+	return nil
+}
+
+func VerifyHandler(cmd *cobra.Command, args []string) error {
+	repair, err := cmd.Flags().GetBool("repair")
+	if err != nil {
+		return err
+	}
+
+	insecure, err := cmd.Flags().GetBool("insecure")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	bars := make(map[string]*progress.Bar)
+
+	var result api.VerifyResponse
+	fn := func(resp api.VerifyResponse) error {
+		if resp.Status == "success" {
+			result = resp
+		} else if resp.Digest != "" {
+			bar, ok := bars[resp.Status]
+			if !ok {
+				bar = progress.NewBar(resp.Status+"...", resp.Total, resp.Completed)
+				bars[resp.Status] = bar
+				p.Add(resp.Status, bar)
+			}
+
+			bar.Set(resp.Completed)
+		}
+
+		return nil
+	}
+
+	request := api.VerifyRequest{Repair: repair, Insecure: insecure}
+	if len(args) > 0 {
+		request.Model = args[0]
+	}
+
+	if err := client.Verify(cmd.Context(), &request, fn); err != nil {
+		return err
+	}
+
+	p.Stop()
+
+	repaired := make(map[string]bool)
+	for _, blob := range result.Repaired {
+		repaired[blob.Digest] = true
+	}
+
+	report := func(problem string, blobs []api.BlobInfo) {
+		for _, blob := range blobs {
+			status := problem
+			if repaired[blob.Digest] {
+				status += ", repaired"
+			}
+
+			fmt.Printf("%s\t%s\t%s\t%s\n", blob.Digest, format.HumanBytes(blob.Size), status, strings.Join(blob.Models, ", "))
+		}
+	}
+
+	report("missing", result.Missing)
+	report("corrupt", result.Corrupt)
+	report("orphaned", result.Orphaned)
+
+	if n := len(result.Missing) + len(result.Corrupt) - len(result.Repaired); n > 0 {
+		return fmt.Errorf("found %d missing or corrupt blobs, run with --repair to pull them again", n)
+	}
+
+	if len(result.Missing)+len(result.Corrupt)+len(result.Orphaned) == 0 {
+		fmt.Println("all blobs verified")
+	}
+
+	return nil
+}
+
+func GCHandler(cmd *cobra.Command, args []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GC(cmd.Context(), &api.GCRequest{DryRun: dryRun})
+	if err != nil {
+		return err
+	}
+
+	verb := "deleted"
+	if dryRun {
+		verb = "would delete"
+	}
+
+	for _, blob := range resp.Blobs {
+		if blob.Partial {
+			fmt.Printf("%s partial download of %s (%s)\n", verb, blob.Digest, format.HumanBytes(blob.Size))
+			continue
+		}
+
+		fmt.Printf("%s %s (%s)\n", verb, blob.Digest, format.HumanBytes(blob.Size))
+	}
+
+	if dryRun {
+		fmt.Printf("%s would be reclaimed\n", format.HumanBytes(resp.Size))
+	} else {
+		fmt.Printf("reclaimed %s\n", format.HumanBytes(resp.Size))
+	}
+
+	return nil
+}
+
+func CreateSessionHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.CreateSessionRequest{Model: args[0]}
+
+	system, err := cmd.Flags().GetString("system")
+	if err != nil {
+		return err
+	}
+
+	if system != "" {
+		req.Messages = append(req.Messages, api.Message{Role: "system", Content: system})
+	}
+
+	session, err := client.CreateSession(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(session.ID)
+	return nil
+}
+
+func ListSessionsHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	sessions, err := client.Sessions(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, s := range sessions.Sessions {
+		data = append(data, []string{s.ID, s.Model, strconv.Itoa(s.Messages), format.HumanTime(s.ModifiedAt, "Never")})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "MODEL", "MESSAGES", "MODIFIED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
+
+func ShowSessionHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	session, err := client.Session(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(session)
+	}
+
+	fmt.Printf("model: %s\n", session.Model)
+	if session.Parent != "" {
+		fmt.Printf("forked from: %s\n", session.Parent)
+	}
+
+	for _, msg := range session.Messages {
+		fmt.Printf("\n%s: %s\n", msg.Role, msg.Content)
+	}
+
+	return nil
+}
+
+func ForkSessionHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	messages, err := cmd.Flags().GetInt("messages")
+	if err != nil {
+		return err
+	}
+
+	session, err := client.ForkSession(cmd.Context(), args[0], &api.ForkSessionRequest{Messages: messages})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(session.ID)
+	return nil
+}
+
+func DeleteSessionHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range args {
+		if err := client.DeleteSession(cmd.Context(), id); err != nil {
+			return err
+		}
+		fmt.Printf("deleted session '%s'\n", id)
+	}
+
+	return nil
+}
+
+func DiffHandler(cmd *cobra.Command, args []string) error {
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Diff(cmd.Context(), &api.DiffRequest{From: args[0], To: args[1]})
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		bts, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bts))
+		return nil
+	}
+
+	fmt.Println("layers:")
+	for _, layer := range resp.Layers {
+		prefix := " "
+		switch layer.Status {
+		case "added":
+			prefix = "+"
+		case "removed":
+			prefix = "-"
+		}
+
+		fmt.Printf("%s %-42s %s %s\n", prefix, layer.MediaType, layer.Digest[7:19], format.HumanBytes(layer.Size))
+	}
+
+	for _, change := range resp.Changes {
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(change.From),
+			B:        difflib.SplitLines(change.To),
+			FromFile: args[0] + " " + change.Field,
+			ToFile:   args[1] + " " + change.Field,
+			Context:  3,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println()
+		fmt.Print(diff)
+	}
+
+	return nil
+}
+
+func RenderTemplateHandler(cmd *cobra.Command, args []string) error {
+	req := api.RenderTemplateRequest{Model: args[0]}
+
+	filename, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+
+	if filename != "" {
+		var bts []byte
+		if filename == "-" {
+			bts, err = io.ReadAll(os.Stdin)
+		} else {
+			bts, err = os.ReadFile(filename)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(bts, &req.Messages); err != nil {
+			return fmt.Errorf("invalid messages in %s: %w", filename, err)
+		}
+	}
+
+	messages, err := cmd.Flags().GetStringArray("message")
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		role, content, ok := strings.Cut(message, "=")
+		if !ok {
+			return fmt.Errorf("invalid message %q, expected ROLE=CONTENT", message)
+		}
+
+		req.Messages = append(req.Messages, api.Message{Role: role, Content: content})
+	}
+
+	images, err := cmd.Flags().GetStringArray("image")
+	if err != nil {
+		return err
+	}
+
+	if len(images) > 0 {
+		// images are attached to the last message
+		if len(req.Messages) == 0 {
+			return errors.New("images require a message")
+		}
+
+		last := &req.Messages[len(req.Messages)-1]
+		for _, image := range images {
+			data, err := getImageData(normalizeFilePath(image))
+			if err != nil {
+				return err
+			}
+
+			last.Images = append(last.Images, data)
+		}
+	}
+
+	if req.System, err = cmd.Flags().GetString("system"); err != nil {
+		return err
+	}
+
+	if req.Overflow, err = cmd.Flags().GetString("overflow"); err != nil {
+		return err
+	}
+
+	templateFile, err := cmd.Flags().GetString("template")
+	if err != nil {
+		return err
+	}
+
+	if templateFile != "" {
+		bts, err := os.ReadFile(templateFile)
+		if err != nil {
+			return err
+		}
+
+		req.Template = string(bts)
+	}
+
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.RenderTemplate(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		bts, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bts))
+		return nil
+	}
+
+	fmt.Print(resp.Prompt)
+	if !strings.HasSuffix(resp.Prompt, "\n") {
+		fmt.Println()
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "mode:     %s\n", resp.Mode)
+	fmt.Fprintf(os.Stderr, "messages: %d rendered, %d dropped\n", resp.Messages, resp.Dropped)
+	fmt.Fprintf(os.Stderr, "images:   %d\n", resp.Images)
+	fmt.Fprintf(os.Stderr, "tokens:   %d of %d\n", resp.PromptTokens, resp.NumCtx)
+	return nil
+}
+
+func DiskUsageHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.DiskUsage(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, m := range resp.Models {
+		if len(args) == 0 || strings.HasPrefix(m.Name, args[0]) {
+			data = append(data, []string{m.Name, format.HumanBytes(m.Size), format.HumanBytes(m.Unique), format.HumanBytes(m.Shared)})
+		}
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "SIZE", "UNIQUE", "SHARED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	if len(args) == 0 {
+		fmt.Printf("\ntotal %s, %s reclaimable with ollama gc\n", format.HumanBytes(resp.Size), format.HumanBytes(resp.Reclaimable))
+	}
+
+	return nil
+}
+
+// maxRateFlag parses the --max-rate flag, a size per second such as 10MB.
+func maxRateFlag(cmd *cobra.Command) (int64, error) {
+	s, err := cmd.Flags().GetString("max-rate")
+	if err != nil || s == "" {
+		return 0, err
+	}
+
+	rate, err := format.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --max-rate: %w", err)
+	}
+
+	return rate, nil
+}
+
+func PullHandler(cmd *cobra.Command, args []string) error {
+	insecure, err := cmd.Flags().GetBool("insecure")
+	if err != nil {
+		return err
+	}
+
+	maxRate, err := maxRateFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	bars := make(map[string]*progress.Bar)
+
+	var status string
+	var spinner *progress.Spinner
+
+	fn := func(resp api.ProgressResponse) error {
+		if resp.Digest != "" {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			bar, ok := bars[resp.Digest]
+			if !ok {
+				bar = progress.NewBar(fmt.Sprintf("pulling %s...", resp.Digest[7:19]), resp.Total, resp.Completed)
+				bars[resp.Digest] = bar
+				p.Add(resp.Digest, bar)
+			}
+
+			bar.Set(resp.Completed)
+		} else if status != resp.Status {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			status = resp.Status
+			spinner = progress.NewSpinner(status)
+			p.Add(status, spinner)
+		}
+
+		return nil
+	}
+
+	request := api.PullRequest{Name: args[0], Insecure: insecure, MaxRate: maxRate}
+	if err := client.Pull(cmd.Context(), &request, fn); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type generateContextKey string
+
+type runOptions struct {
+	Model       string
+	ParentModel string
+	Prompt      string
+	Messages    []api.Message
+	WordWrap    bool
+	Format      string
+	System      string
+	Template    string
+	Images      []api.ImageData
+	Options     map[string]interface{}
+	MultiModal  bool
+	KeepAlive   *api.Duration
+}
+
+type displayResponseState struct {
+	lineLength int
 	wordBuffer string
 }
 
@@ -1224,8 +2112,28 @@ func NewCLI() *cobra.Command {
 		RunE:    CreateHandler,
 	}
 
-	createCmd.Flags().StringP("file", "f", "Modelfile", "Name of the Modelfile")
+	createCmd.Flags().StringP("file", "f", "Modelfile", "Name of the Modelfile, or a .json or .yaml spec")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_0)")
+	createCmd.Flags().StringArray("var", nil, "Set a Modelfile variable (NAME=VALUE)")
+
+	lintCmd := &cobra.Command{
+		Use:     "lint [MODELFILE]",
+		Short:   "Check a Modelfile for problems",
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    LintHandler,
+	}
+
+	lintCmd.Flags().StringArray("var", nil, "Set a Modelfile variable (NAME=VALUE)")
+
+	fmtCmd := &cobra.Command{
+		Use:   "fmt [MODELFILE...]",
+		Short: "Format Modelfiles",
+		RunE:  FormatHandler,
+	}
+
+	fmtCmd.Flags().BoolP("write", "w", false, "Write the formatted Modelfiles back to their files")
+	fmtCmd.Flags().Bool("check", false, "List the Modelfiles which aren't formatted, and fail if there are any")
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -1240,6 +2148,8 @@ func NewCLI() *cobra.Command {
 	showCmd.Flags().Bool("parameters", false, "Show parameters of a model")
 	showCmd.Flags().Bool("template", false, "Show template of a model")
 	showCmd.Flags().Bool("system", false, "Show system message of a model")
+	showCmd.Flags().String("spec", "", "Show the model as a spec in yaml or json")
+	showCmd.Flags().Lookup("spec").NoOptDefVal = "yaml"
 
 	runCmd := &cobra.Command{
 		Use:     "run MODEL [PROMPT]",
@@ -1271,6 +2181,7 @@ func NewCLI() *cobra.Command {
 	}
 
 	pullCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pullCmd.Flags().String("max-rate", "", "Limit the download rate per second, e.g. 10MB")
 
 	pushCmd := &cobra.Command{
 		Use:     "push MODEL",
@@ -1281,6 +2192,8 @@ func NewCLI() *cobra.Command {
 	}
 
 	pushCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pushCmd.Flags().Bool("sign", false, "Push a signature of the model made with your Ollama key")
+	pushCmd.Flags().String("max-rate", "", "Limit the upload rate per second, e.g. 10MB")
 
 	listCmd := &cobra.Command{
 		Use:     "list",
@@ -1305,6 +2218,154 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	aliasCmd := &cobra.Command{
+		Use:   "alias [NAME MODEL]",
+		Short: "Point an alias at a model, or list aliases",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 && len(args) != 2 {
+				return fmt.Errorf("accepts 0 or 2 arg(s), received %d", len(args))
+			}
+			return nil
+		},
+		PreRunE: checkServerHeartbeat,
+		RunE:    AliasHandler,
+	}
+
+	exportCmd := &cobra.Command{
+		Use:     "export MODEL",
+		Short:   "Export a model to an OCI image layout tarball",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ExportHandler,
+	}
+
+	exportCmd.Flags().StringP("output", "o", "-", "Name of the tarball to write, - for stdout")
+
+	importCmd := &cobra.Command{
+		Use:     "import FILE",
+		Short:   "Import models from an OCI image layout tarball",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ImportHandler,
+	}
+
+	importCmd.Flags().String("name", "", "Name of the imported model, if the tarball holds a single model")
+
+	verifyCmd := &cobra.Command{
+		Use:     "verify [MODEL]",
+		Short:   "Check models for missing and corrupt blobs",
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    VerifyHandler,
+	}
+
+	verifyCmd.Flags().Bool("repair", false, "Pull missing and corrupt blobs again")
+	verifyCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+
+	gcCmd := &cobra.Command{
+		Use:     "gc",
+		Short:   "Remove files no model uses",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    GCHandler,
+	}
+
+	gcCmd.Flags().Bool("dry-run", false, "Show what would be removed without removing it")
+
+	diffCmd := &cobra.Command{
+		Use:     "diff MODEL MODEL",
+		Short:   "Show the differences between two models",
+		Args:    cobra.ExactArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    DiffHandler,
+	}
+
+	diffCmd.Flags().Bool("json", false, "Output the differences as JSON")
+
+	templateCmd := &cobra.Command{
+		Use:   "template",
+		Short: "Work with model templates",
+	}
+
+	templateRenderCmd := &cobra.Command{
+		Use:     "render MODEL",
+		Short:   "Render a chat with a model's template",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    RenderTemplateHandler,
+	}
+
+	templateRenderCmd.Flags().StringArrayP("message", "m", nil, "Add a message (ROLE=CONTENT)")
+	templateRenderCmd.Flags().StringP("file", "f", "", "Read messages from a JSON file, or - for stdin")
+	templateRenderCmd.Flags().String("system", "", "Add a system message before the messages")
+	templateRenderCmd.Flags().StringArray("image", nil, "Attach an image to the last message")
+	templateRenderCmd.Flags().String("template", "", "Use the template in a file instead of the model's")
+	templateRenderCmd.Flags().String("overflow", "", "How to handle messages which exceed the context window (truncate, middle, content, summarize, error)")
+	templateRenderCmd.Flags().Bool("json", false, "Output the prompt and statistics as JSON")
+	templateCmd.AddCommand(templateRenderCmd)
+
+	sessionCmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage conversations stored by the server",
+	}
+
+	sessionCreateCmd := &cobra.Command{
+		Use:     "create MODEL",
+		Short:   "Create a session with a model",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    CreateSessionHandler,
+	}
+
+	sessionCreateCmd.Flags().String("system", "", "Start the session with a system message")
+
+	sessionListCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List sessions",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    ListSessionsHandler,
+	}
+
+	sessionShowCmd := &cobra.Command{
+		Use:     "show ID",
+		Short:   "Show the history of a session",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ShowSessionHandler,
+	}
+
+	sessionShowCmd.Flags().Bool("json", false, "Output the session as JSON")
+
+	sessionForkCmd := &cobra.Command{
+		Use:     "fork ID",
+		Short:   "Copy a session into a new session",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ForkSessionHandler,
+	}
+
+	sessionForkCmd.Flags().Int("messages", 0, "Number of messages to copy, all if 0")
+
+	sessionDeleteCmd := &cobra.Command{
+		Use:     "rm ID [ID...]",
+		Short:   "Remove a session",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    DeleteSessionHandler,
+	}
+
+	sessionCmd.AddCommand(sessionCreateCmd, sessionListCmd, sessionShowCmd, sessionForkCmd, sessionDeleteCmd)
+
+	duCmd := &cobra.Command{
+		Use:     "du [MODEL]",
+		Short:   "Show the disk space used by models",
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    DiskUsageHandler,
+	}
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1319,6 +2380,7 @@ func NewCLI() *cobra.Command {
 
 	for _, cmd := range []*cobra.Command{
 		createCmd,
+		lintCmd,
 		showCmd,
 		runCmd,
 		pullCmd,
@@ -1326,6 +2388,19 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		psCmd,
 		copyCmd,
+		aliasCmd,
+		exportCmd,
+		importCmd,
+		verifyCmd,
+		gcCmd,
+		duCmd,
+		diffCmd,
+		templateRenderCmd,
+		sessionCreateCmd,
+		sessionListCmd,
+		sessionShowCmd,
+		sessionForkCmd,
+		sessionDeleteCmd,
 		deleteCmd,
 		serveCmd,
 	} {
@@ -1356,6 +2431,8 @@ func NewCLI() *cobra.Command {
 	rootCmd.AddCommand(
 		serveCmd,
 		createCmd,
+		lintCmd,
+		fmtCmd,
 		showCmd,
 		runCmd,
 		pullCmd,
@@ -1363,6 +2440,15 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		psCmd,
 		copyCmd,
+		aliasCmd,
+		exportCmd,
+		importCmd,
+		verifyCmd,
+		gcCmd,
+		duCmd,
+		diffCmd,
+		templateCmd,
+		sessionCmd,
 		deleteCmd,
 	)
 
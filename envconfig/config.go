@@ -12,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ollama/ollama/format"
 )
 
 type OllamaHost struct {
@@ -37,12 +39,20 @@ var (
 	Host *OllamaHost
 	// Set via OLLAMA_KEEP_ALIVE in the environment
 	KeepAlive time.Duration
+	// Set via OLLAMA_KV_CACHE_TYPE in the environment
+	KVCacheType string
 	// Set via OLLAMA_LLM_LIBRARY in the environment
 	LLMLibrary string
+	// Set via OLLAMA_MAX_DOWNLOAD_RATE in the environment
+	MaxDownloadRate int64
 	// Set via OLLAMA_MAX_LOADED_MODELS in the environment
 	MaxRunners int
 	// Set via OLLAMA_MAX_QUEUE in the environment
 	MaxQueuedRequests int
+	// Set via OLLAMA_MAX_STORE_SIZE in the environment
+	MaxStoreSize int64
+	// Set via OLLAMA_MAX_UPLOAD_RATE in the environment
+	MaxUploadRate int64
 	// Set via OLLAMA_MAX_VRAM in the environment
 	MaxVRAM uint64
 	// Set via OLLAMA_MODELS in the environment
@@ -53,12 +63,30 @@ var (
 	NoPrune bool
 	// Set via OLLAMA_NUM_PARALLEL in the environment
 	NumParallel int
+	// Set via OLLAMA_PINNED_MODELS in the environment
+	PinnedModels []string
+	// Set via OLLAMA_PROMPT_CACHE in the environment
+	PromptCache bool
+	// Set via OLLAMA_REGISTRY_AUTH in the environment
+	RegistryAuth string
+	// Set via OLLAMA_REGISTRY_CA in the environment
+	RegistryCA string
+	// Set via OLLAMA_REGISTRY_CACHE in the environment
+	RegistryCache bool
+	// Set via OLLAMA_REGISTRY_MIRRORS in the environment
+	RegistryMirrors []string
 	// Set via OLLAMA_RUNNERS_DIR in the environment
 	RunnersDir string
 	// Set via OLLAMA_SCHED_SPREAD in the environment
 	SchedSpread bool
 	// Set via OLLAMA_TMPDIR in the environment
 	TmpDir string
+	// Set via OLLAMA_TRANSFER_PARTS in the environment
+	TransferParts int
+	// Set via OLLAMA_TRUSTED_KEYS in the environment
+	TrustedKeys string
+	// Set via OLLAMA_VERIFY_SIGNATURES in the environment
+	VerifySignatures string
 	// Set via OLLAMA_INTEL_GPU in the environment
 	IntelGpu bool
 
@@ -86,18 +114,31 @@ func AsMap() map[string]EnvVar {
 		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention, "Enabled flash attention"},
 		"OLLAMA_HOST":              {"OLLAMA_HOST", Host, "IP Address for the ollama server (default 127.0.0.1:11434)"},
 		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive, "The duration that models stay loaded in memory (default \"5m\")"},
+		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KVCacheType, "Data type of the KV cache, e.g. q8_0 or q4_0 (default \"f16\")"},
 		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary, "Set LLM library to bypass autodetection"},
+		"OLLAMA_MAX_DOWNLOAD_RATE": {"OLLAMA_MAX_DOWNLOAD_RATE", MaxDownloadRate, "Maximum download rate of all pulls in bytes per second, e.g. 10MB"},
 		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners, "Maximum number of loaded models per GPU"},
 		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueuedRequests, "Maximum number of queued requests"},
+		"OLLAMA_MAX_STORE_SIZE":    {"OLLAMA_MAX_STORE_SIZE", MaxStoreSize, "Maximum size of the model store, e.g. 500GB; least recently used models are removed to make room"},
+		"OLLAMA_MAX_UPLOAD_RATE":   {"OLLAMA_MAX_UPLOAD_RATE", MaxUploadRate, "Maximum upload rate of all pushes in bytes per second, e.g. 10MB"},
 		"OLLAMA_MAX_VRAM":          {"OLLAMA_MAX_VRAM", MaxVRAM, "Maximum VRAM"},
 		"OLLAMA_MODELS":            {"OLLAMA_MODELS", ModelsDir, "The path to the models directory"},
 		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory, "Do not preserve readline history"},
 		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune, "Do not prune model blobs on startup"},
 		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel, "Maximum number of parallel requests"},
 		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", AllowOrigins, "A comma separated list of allowed origins"},
+		"OLLAMA_PINNED_MODELS":     {"OLLAMA_PINNED_MODELS", PinnedModels, "A comma separated list of models which are never removed to make room"},
+		"OLLAMA_PROMPT_CACHE":      {"OLLAMA_PROMPT_CACHE", PromptCache, "Save evaluated prompt prefixes to disk and restore them after model reloads"},
+		"OLLAMA_REGISTRY_AUTH":     {"OLLAMA_REGISTRY_AUTH", RegistryAuth, "Path to a Docker config.json with registry credentials (default \"~/.docker/config.json\")"},
+		"OLLAMA_REGISTRY_CA":       {"OLLAMA_REGISTRY_CA", RegistryCA, "Path to a PEM bundle of CA certificates trusted for registries"},
+		"OLLAMA_REGISTRY_CACHE":    {"OLLAMA_REGISTRY_CACHE", RegistryCache, "Serve pulled models to other Ollama servers as a pull-through cache on /v2/"},
+		"OLLAMA_REGISTRY_MIRRORS":  {"OLLAMA_REGISTRY_MIRRORS", RegistryMirrors, "A comma separated list of registry mirror URLs tried before the registry"},
 		"OLLAMA_RUNNERS_DIR":       {"OLLAMA_RUNNERS_DIR", RunnersDir, "Location for runners"},
 		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread, "Always schedule model across all GPUs"},
 		"OLLAMA_TMPDIR":            {"OLLAMA_TMPDIR", TmpDir, "Location for temporary files"},
+		"OLLAMA_TRANSFER_PARTS":    {"OLLAMA_TRANSFER_PARTS", TransferParts, "Maximum number of parts of a blob downloaded or uploaded at once (default 64)"},
+		"OLLAMA_TRUSTED_KEYS":      {"OLLAMA_TRUSTED_KEYS", TrustedKeys, "Path to an authorized_keys file of keys trusted to sign pulled models"},
+		"OLLAMA_VERIFY_SIGNATURES": {"OLLAMA_VERIFY_SIGNATURES", VerifySignatures, "Whether to warn about or refuse pulls without a trusted signature: warn, enforce or off (default \"warn\")"},
 	}
 	if runtime.GOOS != "darwin" {
 		ret["CUDA_VISIBLE_DEVICES"] = EnvVar{"CUDA_VISIBLE_DEVICES", CudaVisibleDevices, "Set which NVIDIA devices are visible"}
@@ -156,6 +197,8 @@ func LoadConfig() {
 		}
 	}
 
+	KVCacheType = strings.ToLower(clean("OLLAMA_KV_CACHE_TYPE"))
+
 	RunnersDir = clean("OLLAMA_RUNNERS_DIR")
 	if runtime.GOOS == "windows" && RunnersDir == "" {
 		// On Windows we do not carry the payloads inside the main executable
@@ -194,6 +237,17 @@ func LoadConfig() {
 
 	TmpDir = clean("OLLAMA_TMPDIR")
 
+	TrustedKeys = clean("OLLAMA_TRUSTED_KEYS")
+	VerifySignatures = "warn"
+	if verify := strings.ToLower(clean("OLLAMA_VERIFY_SIGNATURES")); verify != "" {
+		switch verify {
+		case "warn", "enforce", "off":
+			VerifySignatures = verify
+		default:
+			slog.Error("invalid setting, ignoring", "OLLAMA_VERIFY_SIGNATURES", verify)
+		}
+	}
+
 	userLimit := clean("OLLAMA_MAX_VRAM")
 	if userLimit != "" {
 		avail, err := strconv.ParseUint(userLimit, 10, 64)
@@ -204,6 +258,30 @@ func LoadConfig() {
 		}
 	}
 
+	MaxStoreSize = loadBytes("OLLAMA_MAX_STORE_SIZE")
+
+	MaxDownloadRate = loadBytes("OLLAMA_MAX_DOWNLOAD_RATE")
+	MaxUploadRate = loadBytes("OLLAMA_MAX_UPLOAD_RATE")
+
+	TransferParts = 0
+	if tc := clean("OLLAMA_TRANSFER_PARTS"); tc != "" {
+		val, err := strconv.Atoi(tc)
+		if err != nil || val <= 0 {
+			slog.Error("invalid setting, ignoring", "OLLAMA_TRANSFER_PARTS", tc, "error", err)
+		} else {
+			TransferParts = val
+		}
+	}
+
+	PinnedModels = nil
+	if pinned := clean("OLLAMA_PINNED_MODELS"); pinned != "" {
+		for _, name := range strings.Split(pinned, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				PinnedModels = append(PinnedModels, name)
+			}
+		}
+	}
+
 	LLMLibrary = clean("OLLAMA_LLM_LIBRARY")
 
 	if onp := clean("OLLAMA_NUM_PARALLEL"); onp != "" {
@@ -228,6 +306,32 @@ func LoadConfig() {
 		}
 	}
 
+	if pc := clean("OLLAMA_PROMPT_CACHE"); pc != "" {
+		p, err := strconv.ParseBool(pc)
+		if err == nil {
+			PromptCache = p
+		}
+	}
+
+	RegistryAuth = clean("OLLAMA_REGISTRY_AUTH")
+	RegistryCA = clean("OLLAMA_REGISTRY_CA")
+
+	if rc := clean("OLLAMA_REGISTRY_CACHE"); rc != "" {
+		c, err := strconv.ParseBool(rc)
+		if err == nil {
+			RegistryCache = c
+		}
+	}
+
+	RegistryMirrors = nil
+	if mirrors := clean("OLLAMA_REGISTRY_MIRRORS"); mirrors != "" {
+		for _, mirror := range strings.Split(mirrors, ",") {
+			if mirror = strings.TrimSpace(mirror); mirror != "" {
+				RegistryMirrors = append(RegistryMirrors, mirror)
+			}
+		}
+	}
+
 	if noprune := clean("OLLAMA_NOPRUNE"); noprune != "" {
 		NoPrune = true
 	}
@@ -351,6 +455,23 @@ func getOllamaHost() (*OllamaHost, error) {
 	}, nil
 }
 
+// loadBytes parses a size such as 500GB in the environment, returning 0 if
+// it is not set or invalid.
+func loadBytes(key string) int64 {
+	s := clean(key)
+	if s == "" {
+		return 0
+	}
+
+	b, err := format.ParseBytes(s)
+	if err != nil {
+		slog.Error("invalid setting, ignoring", key, s, "error", err)
+		return 0
+	}
+
+	return b
+}
+
 func loadKeepAlive(ka string) {
 	v, err := strconv.Atoi(ka)
 	if err != nil {
@@ -3,6 +3,9 @@ package format
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 const (
@@ -63,3 +66,48 @@ func HumanBytes2(b uint64) string {
 		return fmt.Sprintf("%d B", b)
 	}
 }
+
+// ParseBytes parses a size such as "512", "200GB" or "1.5 TiB" into bytes.
+// Units are case insensitive and decimal unless they're binary, e.g. GiB.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+
+	number, unit := s, ""
+	if i >= 0 {
+		number, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	var multiplier float64
+	switch strings.ToLower(unit) {
+	case "", "b":
+		multiplier = Byte
+	case "k", "kb":
+		multiplier = KiloByte
+	case "m", "mb":
+		multiplier = MegaByte
+	case "g", "gb":
+		multiplier = GigaByte
+	case "t", "tb":
+		multiplier = TeraByte
+	case "kib":
+		multiplier = KibiByte
+	case "mib":
+		multiplier = MebiByte
+	case "gib":
+		multiplier = GibiByte
+	case "tib":
+		multiplier = GibiByte * 1024
+	default:
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+	}
+
+	return int64(value * multiplier), nil
+}
@@ -0,0 +1,45 @@
+package format
+
+import (
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected int64
+	}
+
+	testCases := []testCase{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"200GB", 200 * GigaByte},
+		{"200 gb", 200 * GigaByte},
+		{"1.5TB", 1500 * GigaByte},
+		{"10G", 10 * GigaByte},
+		{"4GiB", 4 * GibiByte},
+		{"1TiB", 1024 * GibiByte},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			result, err := ParseBytes(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, result)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "GB", "-1GB", "10 parsecs"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseBytes(input); err == nil {
+				t.Errorf("Expected an error for %q", input)
+			}
+		})
+	}
+}
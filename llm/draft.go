@@ -0,0 +1,32 @@
+package llm
+
+import (
+	"sync/atomic"
+
+	"github.com/ollama/ollama/api"
+)
+
+// draftStats accumulates how many tokens a runner's draft model proposed
+// during speculative decoding and how many of them the model accepted.
+type draftStats struct {
+	count    atomic.Int64
+	accepted atomic.Int64
+}
+
+func (d *draftStats) add(count, accepted int) {
+	d.count.Add(int64(count))
+	d.accepted.Add(int64(accepted))
+}
+
+func (d *draftStats) stats() *api.DraftStats {
+	stats := api.DraftStats{
+		Count:    d.count.Load(),
+		Accepted: d.accepted.Load(),
+	}
+
+	if stats.Count > 0 {
+		stats.AcceptanceRate = float64(stats.Accepted) / float64(stats.Count)
+	}
+
+	return &stats
+}
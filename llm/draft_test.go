@@ -0,0 +1,23 @@
+package llm
+
+import "testing"
+
+func TestDraftStats(t *testing.T) {
+	var d draftStats
+
+	if stats := d.stats(); stats.Count != 0 || stats.AcceptanceRate != 0 {
+		t.Errorf("expected empty stats, got %+v", stats)
+	}
+
+	d.add(8, 6)
+	d.add(4, 0)
+
+	stats := d.stats()
+	if stats.Count != 12 || stats.Accepted != 6 {
+		t.Errorf("expected 6 of 12 accepted, got %d of %d", stats.Accepted, stats.Count)
+	}
+
+	if stats.AcceptanceRate != 0.5 {
+		t.Errorf("expected acceptance rate 0.5, got %f", stats.AcceptanceRate)
+	}
+}
@@ -43,6 +43,7 @@
 #include <windows.h>
 #endif
 
+#include <algorithm>
 #include <cstddef>
 #include <thread>
 #include <chrono>
@@ -62,6 +63,11 @@ struct server_params {
     bool slots_endpoint = true;
     bool metrics_endpoint = false;
     int n_threads_http = -1;
+
+    std::string slot_save_path;
+
+    // LoRA adapters and their default scales
+    std::vector<std::tuple<std::string, float>> lora_adapters;
 };
 
 bool server_verbose = false;
@@ -98,6 +104,12 @@ struct slot_params {
     json input_suffix;
 };
 
+struct lora_adapter {
+    std::string path;
+    float scale; // default scale, used when a request doesn't choose adapters
+    struct llama_lora_adapter *adapter = nullptr;
+};
+
 struct slot_image {
     int32_t id;
 
@@ -158,6 +170,15 @@ struct server_slot {
 
     int32_t n_past_se = 0; // self-extend
 
+    // speculative decoding
+    std::vector<llama_token> cache_tokens_dft; // tokens held in the draft model's KV cache
+    int32_t n_draft          = 0; // number of tokens proposed by the draft model
+    int32_t n_draft_accepted = 0; // number of proposed tokens accepted by the target model
+
+    // LoRA adapter scales for the current task and for the tokens in the KV cache
+    std::vector<float> lora_scales;
+    std::vector<float> cache_lora_scales;
+
     // multimodal
     std::vector<slot_image> images;
 
@@ -187,6 +208,8 @@ struct server_slot {
         n_sent_token_probs     = 0;
         ga_i                   = 0;
         n_past_se              = 0;
+        n_draft                = 0;
+        n_draft_accepted       = 0;
 
         generated_token_probs.clear();
 
@@ -245,6 +268,7 @@ struct server_slot {
         return json
         {
             {"prompt_n",               n_prompt_tokens_processed},
+            {"prompt_cached_n",        n_prompt_tokens - n_prompt_tokens_processed},
             {"prompt_ms",              t_prompt_processing},
             {"prompt_per_token_ms",    t_prompt_processing / n_prompt_tokens_processed},
             {"prompt_per_second",      1e3 / t_prompt_processing * n_prompt_tokens_processed},
@@ -253,6 +277,9 @@ struct server_slot {
             {"predicted_ms",           t_token_generation},
             {"predicted_per_token_ms", t_token_generation / n_decoded},
             {"predicted_per_second",   1e3 / t_token_generation * n_decoded},
+
+            {"draft_n",                n_draft},
+            {"draft_accepted_n",       n_draft_accepted},
         };
     }
 
@@ -336,6 +363,10 @@ struct llama_server_context
 
     clip_ctx *clp_ctx = nullptr;
 
+    // draft model for speculative decoding
+    llama_model *model_dft = nullptr;
+    llama_context *ctx_dft = nullptr;
+
     gpt_params params;
 
     llama_batch batch;
@@ -364,6 +395,14 @@ struct llama_server_context
 
     server_metrics metrics;
 
+    std::string slot_save_path;
+
+    // adapters are applied to the whole context, so each batch only holds
+    // slots using the same scales
+    std::vector<lora_adapter> lora_adapters;
+    std::vector<float> lora_applied;
+    size_t lora_turn = 0; // slot whose scales the next batch starts from
+
     ~llama_server_context()
     {
         if (clp_ctx)
@@ -382,6 +421,16 @@ struct llama_server_context
             llama_free_model(model);
             model = nullptr;
         }
+        if (ctx_dft)
+        {
+            llama_free(ctx_dft);
+            ctx_dft = nullptr;
+        }
+        if (model_dft)
+        {
+            llama_free_model(model_dft);
+            model_dft = nullptr;
+        }
     }
 
     bool load_model(const gpt_params &params_)
@@ -419,6 +468,21 @@ struct llama_server_context
             }
         }
 
+        for (lora_adapter &la : lora_adapters)
+        {
+            la.adapter = llama_lora_adapter_init(model, la.path.c_str());
+            if (la.adapter == nullptr)
+            {
+                LOG_ERROR("unable to load lora adapter", {{"adapter", la.path}});
+                return false;
+            }
+        }
+        apply_lora(lora_defaults());
+
+        if (!params.model_draft.empty() && !load_draft_model()) {
+            return false;
+        }
+
         n_ctx = llama_n_ctx(ctx);
 
         add_bos_token = llama_should_add_bos_token(model);
@@ -426,6 +490,41 @@ struct llama_server_context
         return true;
     }
 
+    bool load_draft_model() {
+        gpt_params params_dft = params;
+        params_dft.model        = params.model_draft;
+        params_dft.n_gpu_layers = params.n_gpu_layers_draft;
+        params_dft.mmproj.clear();
+
+        std::tie(model_dft, ctx_dft) = llama_init_from_gpt_params(params_dft);
+        if (model_dft == nullptr)
+        {
+            LOG_ERROR("unable to load draft model", {{"model", params.model_draft}});
+            return false;
+        }
+
+        // the draft proposes token ids that are checked by the target, so both
+        // models must share the same vocabulary
+        if (llama_vocab_type(model_dft) != llama_vocab_type(model) ||
+            llama_n_vocab(model_dft) != llama_n_vocab(model))
+        {
+            LOG_ERROR("draft model vocabulary does not match the model", {
+                {"model",         params.model},
+                {"n_vocab",       llama_n_vocab(model)},
+                {"draft",         params.model_draft},
+                {"n_vocab_draft", llama_n_vocab(model_dft)},
+            });
+            llama_free(ctx_dft);
+            llama_free_model(model_dft);
+            ctx_dft   = nullptr;
+            model_dft = nullptr;
+            return false;
+        }
+
+        LOG_INFO("loaded draft model", {{"model", params.model_draft}, {"n_draft", params.n_draft}});
+        return true;
+    }
+
     void initialize() {
         // create slots
         all_slots_are_idle = true;
@@ -524,6 +623,58 @@ struct llama_server_context
         return prompt_tokens;
     }
 
+    std::vector<float> lora_defaults() const {
+        std::vector<float> scales;
+        for (const lora_adapter &la : lora_adapters)
+        {
+            scales.push_back(la.scale);
+        }
+        return scales;
+    }
+
+    // lora_scales reads the adapters requested in data as [{"id": 0, "scale": 0.5}, ...].
+    // Adapters which aren't listed are disabled, without a list the default scales apply.
+    bool lora_scales(const json &data, std::vector<float> &scales) const {
+        scales = lora_defaults();
+
+        const auto &lora = data.find("lora");
+        if (lora == data.end() || !lora->is_array())
+        {
+            return true;
+        }
+
+        std::fill(scales.begin(), scales.end(), 0.0f);
+        for (const auto &entry : *lora)
+        {
+            const int id = json_value(entry, "id", -1);
+            if (id < 0 || id >= (int) lora_adapters.size())
+            {
+                LOG_ERROR("invalid lora adapter id", {{"id", id}, {"n_adapters", lora_adapters.size()}});
+                return false;
+            }
+            scales[id] = json_value(entry, "scale", lora_adapters[id].scale);
+        }
+
+        return true;
+    }
+
+    void apply_lora(const std::vector<float> &scales) {
+        if (scales == lora_applied)
+        {
+            return;
+        }
+
+        llama_lora_adapter_clear(ctx);
+        for (size_t i = 0; i < lora_adapters.size(); i++)
+        {
+            if (scales[i] != 0.0f)
+            {
+                llama_lora_adapter_set(ctx, lora_adapters[i].adapter, scales[i]);
+            }
+        }
+        lora_applied = scales;
+    }
+
     server_slot* get_slot(int id) {
         int64_t t_last = ggml_time_us();
         server_slot *last_used = nullptr;
@@ -574,6 +725,18 @@ struct llama_server_context
         slot->sparams.n_probs           = json_value(data, "n_probs",           default_sparams.n_probs);
         slot->sparams.min_keep          = json_value(data, "min_keep",          default_sparams.min_keep);
 
+        if (!lora_scales(data, slot->lora_scales))
+        {
+            return false;
+        }
+
+        if (slot->lora_scales != slot->cache_lora_scales)
+        {
+            // the cached KV was computed with other adapters and can't be reused
+            slot->cache_tokens.clear();
+            slot->cache_lora_scales = slot->lora_scales;
+        }
+
         if (slot->n_predict > 0 && slot->params.n_predict > slot->n_predict) {
             // Might be better to reject the request with a 400 ?
             LOG_WARNING("Max tokens to predict exceeds server configuration", {
@@ -811,6 +974,14 @@ struct llama_server_context
     void kv_cache_clear() {
         // clear the entire KV cache
         llama_kv_cache_clear(ctx);
+        if (ctx_dft)
+        {
+            llama_kv_cache_clear(ctx_dft);
+            for (server_slot &slot : slots)
+            {
+                slot.cache_tokens_dft.clear();
+            }
+        }
         clean_kv_cache = false;
     }
 
@@ -1387,25 +1558,26 @@ struct llama_server_context
         return std::string(str1.begin(), mismatch_pair.first);
     }
 
-    // Find the slot that has the greatest common prefix
-    server_slot *prefix_slot(const json &prompt) {
+    // Find the idle slot whose cached tokens share the longest prefix with the
+    // prompt so multi-turn conversations keep reusing their KV cache
+    server_slot *prefix_slot(const json &prompt, const std::vector<float> &scales) {
         if (!prompt.is_string()) {
             return nullptr;
         }
 
-        std::string prompt_str = prompt.get<std::string>();
+        const std::vector<llama_token> prompt_tokens = tokenize(prompt, system_prompt.empty() && add_bos_token);
         server_slot *slot = nullptr;
         size_t longest = 0;
 
         for (server_slot &s : slots) {
-            if (s.available() && s.prompt.is_string()) {
-                std::string s_prompt = s.prompt.get<std::string>();
-                std::string prefix = common_prefix(s_prompt, prompt_str);
+            if (!s.available() || s.cache_lora_scales != scales) {
+                continue;
+            }
 
-                if (prefix.size() > longest) {
-                    slot = &s;
-                    longest = prefix.size();
-                }
+            const size_t n = common_part(s.cache_tokens, prompt_tokens);
+            if (n > longest || (n == longest && n > 0 && slot != nullptr && s.t_last_used < slot->t_last_used)) {
+                slot = &s;
+                longest = n;
             }
         }
 
@@ -1415,7 +1587,7 @@ struct llama_server_context
 
         LOG_DEBUG("slot with common prefix found", {{
             "slot_id", slot->id,
-            "characters", longest
+            "tokens", longest
         }});
         return slot;
     }
@@ -1425,7 +1597,20 @@ struct llama_server_context
         switch (task.type)
         {
             case TASK_TYPE_COMPLETION: {
-                server_slot *slot = prefix_slot(task.data["prompt"]);
+                server_slot *slot = nullptr;
+                const int id_slot = json_value(task.data, "slot_id", -1);
+                for (server_slot &s : slots) {
+                    if (s.id == id_slot && s.available()) {
+                        slot = &s;
+                        break;
+                    }
+                }
+                if (slot == nullptr) {
+                    // invalid adapters are rejected when the slot is launched
+                    std::vector<float> scales;
+                    lora_scales(task.data, scales);
+                    slot = prefix_slot(task.data["prompt"], scales);
+                }
                 if (slot == nullptr)
                 {
                     // if no slot is available, we defer this task for processing later
@@ -1460,6 +1645,116 @@ struct llama_server_context
             case TASK_TYPE_NEXT_RESPONSE: {
                 // do nothing
             } break;
+            case TASK_TYPE_SLOT_SAVE: {
+                server_slot *slot = nullptr;
+                const int id_slot = json_value(task.data, "slot_id", -1);
+                for (server_slot &s : slots) {
+                    if (s.id == id_slot) {
+                        slot = &s;
+                        break;
+                    }
+                }
+                if (slot == nullptr)
+                {
+                    send_error(task, "invalid slot id");
+                    break;
+                }
+                if (!slot->available())
+                {
+                    // the slot is still releasing or was picked up by another task
+                    queue_tasks.defer(task);
+                    break;
+                }
+
+                const std::string filename = json_value(task.data, "filename", std::string());
+                if (!is_valid_slot_file_name(filename))
+                {
+                    send_error(task, "invalid filename");
+                    break;
+                }
+
+                const int64_t t_start = ggml_time_us();
+                const std::string filepath = slot_save_path + filename;
+                const size_t token_count = slot->cache_tokens.size();
+                const size_t nwrite = llama_state_seq_save_file(ctx, filepath.c_str(), slot->id, slot->cache_tokens.data(), token_count);
+
+                task_result res;
+                res.id = task.id;
+                res.multitask_id = task.multitask_id;
+                res.stop = true;
+                res.error = false;
+                res.result_json = json
+                {
+                    {"slot_id",   slot->id},
+                    {"filename",  filename},
+                    {"n_saved",   token_count},
+                    {"n_written", nwrite},
+                    {"tokens",    slot->cache_tokens},
+                    {"t_save_ms", (ggml_time_us() - t_start) / 1000.0}
+                };
+                queue_results.send(res);
+            } break;
+            case TASK_TYPE_SLOT_RESTORE: {
+                server_slot *slot = nullptr;
+                const int id_slot = json_value(task.data, "slot_id", -1);
+                for (server_slot &s : slots) {
+                    if (s.id == id_slot) {
+                        slot = &s;
+                        break;
+                    }
+                }
+                if (slot == nullptr)
+                {
+                    send_error(task, "invalid slot id");
+                    break;
+                }
+                if (!slot->available())
+                {
+                    queue_tasks.defer(task);
+                    break;
+                }
+
+                const std::string filename = json_value(task.data, "filename", std::string());
+                if (!is_valid_slot_file_name(filename))
+                {
+                    send_error(task, "invalid filename");
+                    break;
+                }
+
+                const int64_t t_start = ggml_time_us();
+                const std::string filepath = slot_save_path + filename;
+                std::vector<llama_token> tokens(slot->n_ctx);
+                size_t token_count = 0;
+                const size_t nread = llama_state_seq_load_file(ctx, filepath.c_str(), slot->id, tokens.data(), tokens.size(), &token_count);
+                if (nread == 0)
+                {
+                    slot->cache_tokens.clear();
+                    send_error(task, "unable to restore slot, no available space in KV cache or invalid slot save file");
+                    break;
+                }
+                tokens.resize(token_count);
+
+                slot->cache_tokens = tokens;
+                // saved prompts are only restored for requests using the default adapters
+                slot->cache_lora_scales = lora_defaults();
+                // keep the prompt in sync so prefix_slot prefers this slot for matching prompts
+                slot->prompt = tokens_to_str(ctx, tokens.cbegin(), tokens.cend());
+
+                task_result res;
+                res.id = task.id;
+                res.multitask_id = task.multitask_id;
+                res.stop = true;
+                res.error = false;
+                res.result_json = json
+                {
+                    {"slot_id",      slot->id},
+                    {"filename",     filename},
+                    {"n_restored",   token_count},
+                    {"n_read",       nread},
+                    {"t_restore_ms", (ggml_time_us() - t_start) / 1000.0}
+                };
+                queue_results.send(res);
+            } break;
             case TASK_TYPE_METRICS: {
                 json slots_data        = json::array();
                 int n_idle_slots       = 0;
@@ -1546,6 +1841,163 @@ struct llama_server_context
         queue_results.send(result);
     }
 
+    // draft_tokens greedily proposes up to n_max tokens following the slot's
+    // last sampled token. The draft KV cache is synced with the slot's tokens
+    // first, so only tokens the draft model hasn't seen are evaluated.
+    std::vector<llama_token> draft_tokens(server_slot &slot, int32_t n_max)
+    {
+        std::vector<llama_token> draft;
+
+        std::vector<llama_token> tokens = system_tokens;
+        tokens.insert(tokens.end(), slot.cache_tokens.begin(), slot.cache_tokens.end());
+
+        // the last token must always be evaluated to get its logits
+        size_t n_keep = std::min(common_part(slot.cache_tokens_dft, tokens), tokens.size() - 1);
+        llama_kv_cache_seq_rm(ctx_dft, slot.id, n_keep, -1);
+        slot.cache_tokens_dft.resize(n_keep);
+
+        llama_batch batch_dft = llama_batch_init(params.n_batch, 0, 1);
+        for (size_t i = n_keep; i < tokens.size(); i += params.n_batch)
+        {
+            llama_batch_clear(batch_dft);
+            const size_t n_tokens = std::min((size_t) params.n_batch, tokens.size() - i);
+            for (size_t j = 0; j < n_tokens; j++)
+            {
+                llama_batch_add(batch_dft, tokens[i + j], i + j, { slot.id }, i + j == tokens.size() - 1);
+            }
+
+            if (llama_decode(ctx_dft, batch_dft) != 0)
+            {
+                LOG_WARNING("failed to evaluate tokens with the draft model", {{"slot_id", slot.id}});
+                llama_kv_cache_seq_rm(ctx_dft, slot.id, i, -1);
+                llama_batch_free(batch_dft);
+                return draft;
+            }
+            slot.cache_tokens_dft.insert(slot.cache_tokens_dft.end(), tokens.begin() + i, tokens.begin() + i + n_tokens);
+        }
+
+        const int32_t n_vocab = llama_n_vocab(model_dft);
+        int32_t idx = batch_dft.n_tokens - 1;
+        for (int32_t i = 0; i < n_max; i++)
+        {
+            const float *logits = llama_get_logits_ith(ctx_dft, idx);
+            const llama_token id = std::max_element(logits, logits + n_vocab) - logits;
+            if (llama_token_is_eog(model_dft, id))
+            {
+                break;
+            }
+            draft.push_back(id);
+
+            if (i == n_max - 1)
+            {
+                break;
+            }
+
+            llama_batch_clear(batch_dft);
+            llama_batch_add(batch_dft, id, slot.cache_tokens_dft.size(), { slot.id }, true);
+            if (llama_decode(ctx_dft, batch_dft) != 0)
+            {
+                break;
+            }
+            slot.cache_tokens_dft.push_back(id);
+            idx = 0;
+        }
+
+        llama_batch_free(batch_dft);
+        return draft;
+    }
+
+    // speculate evaluates the slot's pending token together with the draft's
+    // proposals in a single batch and keeps the longest prefix the target
+    // model agrees with, plus the token it samples after that prefix
+    void speculate(server_slot &slot)
+    {
+        int32_t n_max = std::min(params.n_draft, slot.n_ctx - slot.n_past - 2);
+        if (slot.n_remaining > 0)
+        {
+            n_max = std::min(n_max, slot.n_remaining - 1);
+        }
+        if (n_max <= 0)
+        {
+            return;
+        }
+
+        const std::vector<llama_token> draft = draft_tokens(slot, n_max);
+        if (draft.empty())
+        {
+            return;
+        }
+
+        apply_lora(slot.lora_scales);
+
+        const int32_t n_past = system_tokens.size() + slot.n_past;
+        llama_batch_clear(batch);
+        llama_batch_add(batch, slot.sampled, n_past, { slot.id }, true);
+        for (size_t i = 0; i < draft.size(); i++)
+        {
+            llama_batch_add(batch, draft[i], n_past + 1 + i, { slot.id }, true);
+        }
+
+        if (llama_decode(ctx, batch) != 0)
+        {
+            LOG_WARNING("failed to verify draft tokens", {{"slot_id", slot.id}, {"n_draft", draft.size()}});
+            llama_kv_cache_seq_rm(ctx, slot.id, n_past, -1);
+            return;
+        }
+
+        // the pending token is now in the KV cache
+        slot.n_past += 1;
+        slot.n_draft += draft.size();
+
+        for (size_t i = 0; i <= draft.size(); i++)
+        {
+            completion_token_output result;
+            const llama_token id = llama_sampling_sample(slot.ctx_sampling, ctx, NULL, i);
+
+            llama_sampling_accept(slot.ctx_sampling, ctx, id, true);
+
+            slot.n_decoded += 1;
+            result.tok = id;
+
+            llama_token_data_array cur_p = { slot.ctx_sampling->cur.data(), slot.ctx_sampling->cur.size(), false };
+            const int32_t n_probs = slot.sparams.n_probs;
+            if (slot.sparams.temp <= 0 && n_probs > 0)
+            {
+                llama_sample_softmax(ctx, &cur_p);
+            }
+
+            for (size_t j = 0; j < std::min(cur_p.size, (size_t)n_probs); ++j)
+            {
+                result.probs.push_back({cur_p.data[j].id, cur_p.data[j].p});
+            }
+
+            const bool accepted = i < draft.size() && id == draft[i];
+            if (accepted)
+            {
+                // already evaluated as part of the draft
+                slot.n_past += 1;
+                slot.n_draft_accepted += 1;
+            }
+
+            if (!process_token(result, slot))
+            {
+                slot.release();
+                slot.print_timings();
+                send_final_response(slot);
+                metrics.on_prediction(slot);
+                break;
+            }
+
+            if (!accepted)
+            {
+                break;
+            }
+        }
+
+        // drop the rejected draft tokens from the KV cache
+        llama_kv_cache_seq_rm(ctx, slot.id, system_tokens.size() + slot.n_past, -1);
+    }
+
     bool update_slots() {
         if (system_need_update)
         {
@@ -1610,6 +2062,37 @@ struct llama_server_context
             }
         }
 
+        // pick the adapter scales for this batch, rotating between slots so
+        // requests using other adapters aren't starved
+        const std::vector<float> *batch_lora = nullptr;
+        bool lora_deferred = false;
+        if (!lora_adapters.empty())
+        {
+            for (size_t i = 0; i < slots.size() && batch_lora == nullptr; i++)
+            {
+                const server_slot &slot = slots[(lora_turn + i) % slots.size()];
+                if (slot.command == LOAD_PROMPT || (slot.state == PROCESSING && slot.command != RELEASE))
+                {
+                    batch_lora = &slot.lora_scales;
+                    lora_turn = (lora_turn + i + 1) % slots.size();
+                }
+            }
+
+            if (batch_lora != nullptr)
+            {
+                apply_lora(*batch_lora);
+            }
+        }
+
+        auto lora_compatible = [&](const server_slot &slot) {
+            if (batch_lora == nullptr || slot.lora_scales == *batch_lora)
+            {
+                return true;
+            }
+            lora_deferred = true;
+            return false;
+        };
+
         // decode any currently ongoing sequences
         LOG_VERBOSE("decoding ongoing sequences", {});
         for (auto & slot : slots)
@@ -1635,7 +2118,7 @@ struct llama_server_context
                 continue;
             }
 
-            if (slot.state == IDLE)
+            if (slot.state == IDLE || !lora_compatible(slot))
             {
                 continue;
             }
@@ -1670,7 +2153,7 @@ struct llama_server_context
                 }
 
                 // need process the prompt
-                if (slot.state == IDLE && slot.command == LOAD_PROMPT)
+                if (slot.state == IDLE && slot.command == LOAD_PROMPT && lora_compatible(slot))
                 {
                     slot.state = PROCESSING;
                     slot.command = NONE;
@@ -1743,8 +2226,6 @@ struct llama_server_context
                             slot.n_past -= 1;
                         }
 
-                        slot.n_prompt_tokens_processed = slot.n_prompt_tokens;
-
                         if (slot.ga_n != 1)
                         {
                             int ga_i = 0;
@@ -1790,6 +2271,12 @@ struct llama_server_context
                         }
                     }
 
+                    if (slot.params.cache_prompt)
+                    {
+                        // only count the tokens which weren't already in the KV cache
+                        slot.n_prompt_tokens_processed = slot.n_prompt_tokens - slot.n_past;
+                    }
+
                     int p0 = (int) system_tokens.size() + slot.n_past;
                     LOG_DEBUG("kv cache rm [p0, end)", {
                         { "slot_id", slot.id },
@@ -1855,7 +2342,8 @@ struct llama_server_context
 
         if (batch.n_tokens == 0)
         {
-            all_slots_are_idle = true;
+            // slots waiting for their adapters are picked up by the next batch
+            all_slots_are_idle = !lora_deferred;
             return true;
         }
 
@@ -1980,6 +2468,19 @@ struct llama_server_context
             }
         }
 
+        if (ctx_dft)
+        {
+            for (auto & slot : slots)
+            {
+                if (slot.state != PROCESSING || slot.command == RELEASE || slot.embedding ||
+                    slot.n_decoded == 0 || slot.ga_n != 1 || !slot.has_next_token)
+                {
+                    continue;
+                }
+                speculate(slot);
+            }
+        }
+
         LOG_VERBOSE("slots updated", {});
         return true;
     }
@@ -2050,8 +2551,8 @@ static void server_print_usage(const char *argv0, const gpt_params &params,
     printf("                            model path (default: %s)\n", params.model.c_str());
     printf("  -a ALIAS, --alias ALIAS\n");
     printf("                            set an alias for the model, will be added as `model` field in completion response\n");
-    printf("  --lora FNAME              apply LoRA adapter (implies --no-mmap)\n");
-    printf("  --lora-base FNAME         optional model to use as a base for the layers modified by the LoRA adapter\n");
+    printf("  --lora FNAME              apply LoRA adapter\n");
+    printf("  --lora-scaled FNAME S     apply LoRA adapter with user defined scaling S, requests may choose adapters by index with \"lora\"\n");
     printf("  --host                    ip address to listen (default  (default: %s)\n", sparams.hostname.c_str());
     printf("  --port PORT               port to listen (default  (default: %d)\n", sparams.port);
     printf("  --path PUBLIC_PATH        path from which to serve static files (default %s)\n", sparams.public_path.c_str());
@@ -2069,10 +2570,18 @@ static void server_print_usage(const char *argv0, const gpt_params &params,
     printf("  -ctv TYPE, --cache-type-v TYPE\n");
     printf("                            KV cache data type for V (default: f16)\n");
     printf("  --mmproj MMPROJ_FILE      path to a multimodal projector file for LLaVA.\n");
+    printf("  -md FNAME, --model-draft FNAME\n");
+    printf("                            draft model for speculative decoding (default: unused)\n");
+    printf("  --draft N                 number of tokens to draft for speculative decoding (default: %d)\n", params.n_draft);
+    if (llama_supports_gpu_offload()) {
+        printf("  -ngld N, --n-gpu-layers-draft N\n");
+        printf("                            number of layers of the draft model to store in VRAM\n");
+    }
     printf("  --log-format              log output format: json or text (default: json)\n");
     printf("  --log-disable             disables logging to a file.\n");
     printf("  --slots-endpoint-disable  disables slots monitoring endpoint.\n");
     printf("  --metrics                 enable prometheus compatible metrics endpoint (default: %s).\n", sparams.metrics_endpoint ? "enabled" : "disabled");
+    printf("  --slot-save-path PATH     path to save and restore slot kv cache (default: disabled)\n");
     printf("\n");
     printf("  -n, --n-predict           maximum tokens to predict (default: %d)\n", params.n_predict);
     printf("  --override-kv KEY=TYPE:VALUE\n");
@@ -2418,8 +2927,7 @@ static void server_params_parse(int argc, char **argv, server_params &sparams, g
                 invalid_param = true;
                 break;
             }
-            params.lora_adapter.emplace_back(argv[i], 1.0f);
-            params.use_mmap = false;
+            sparams.lora_adapters.emplace_back(argv[i], 1.0f);
         }
         else if (arg == "--lora-scaled")
         {
@@ -2428,23 +2936,13 @@ static void server_params_parse(int argc, char **argv, server_params &sparams, g
                 invalid_param = true;
                 break;
             }
-            const char * lora_adapter = argv[i];
+            const char * lora_path = argv[i];
             if (++i >= argc)
             {
                 invalid_param = true;
                 break;
             }
-            params.lora_adapter.emplace_back(lora_adapter, std::stof(argv[i]));
-            params.use_mmap = false;
-        }
-        else if (arg == "--lora-base")
-        {
-            if (++i >= argc)
-            {
-                invalid_param = true;
-                break;
-            }
-            params.lora_base = argv[i];
+            sparams.lora_adapters.emplace_back(lora_path, std::stof(argv[i]));
         }
         else if (arg == "-v" || arg == "--verbose")
         {
@@ -2516,6 +3014,39 @@ static void server_params_parse(int argc, char **argv, server_params &sparams, g
             }
             params.mmproj = argv[i];
         }
+        else if (arg == "-md" || arg == "--model-draft")
+        {
+            if (++i >= argc)
+            {
+                invalid_param = true;
+                break;
+            }
+            params.model_draft = argv[i];
+        }
+        else if (arg == "--draft")
+        {
+            if (++i >= argc)
+            {
+                invalid_param = true;
+                break;
+            }
+            params.n_draft = std::stoi(argv[i]);
+        }
+        else if (arg == "-ngld" || arg == "--n-gpu-layers-draft")
+        {
+            if (++i >= argc)
+            {
+                invalid_param = true;
+                break;
+            }
+            if (llama_supports_gpu_offload()) {
+                params.n_gpu_layers_draft = std::stoi(argv[i]);
+            } else {
+                LOG_WARNING("Not compiled with GPU offload support, --n-gpu-layers-draft option will be ignored. "
+                        "See main README.md for information on enabling GPU BLAS support",
+                        {{"n_gpu_layers_draft", params.n_gpu_layers_draft}});
+            }
+        }
         else if (arg == "--log-format")
         {
             if (++i >= argc)
@@ -2550,6 +3081,24 @@ static void server_params_parse(int argc, char **argv, server_params &sparams, g
         {
             sparams.metrics_endpoint = true;
         }
+        else if (arg == "--slot-save-path")
+        {
+            if (++i >= argc)
+            {
+                invalid_param = true;
+                break;
+            }
+            sparams.slot_save_path = argv[i];
+#if defined(_WIN32)
+            const char separator = '\\';
+#else
+            const char separator = '/';
+#endif
+            if (!sparams.slot_save_path.empty() && sparams.slot_save_path.back() != separator)
+            {
+                sparams.slot_save_path += separator;
+            }
+        }
         else if (arg == "--chat-template")
         {
             if (++i >= argc)
@@ -2752,6 +3301,14 @@ int main(int argc, char **argv) {
     llama_server_context llama;
 
     server_params_parse(argc, argv, sparams, params);
+    llama.slot_save_path = sparams.slot_save_path;
+    for (const auto &adapter : sparams.lora_adapters)
+    {
+        lora_adapter la;
+        la.path  = std::get<0>(adapter);
+        la.scale = std::get<1>(adapter);
+        llama.lora_adapters.push_back(la);
+    }
 
     if (params.model_alias == "unknown")
     {
@@ -3174,6 +3731,47 @@ int main(int argc, char **argv) {
                 return res.set_content(data.dump(), "application/json; charset=utf-8");
             });
 
+    const auto handle_slot_action = [&llama, &sparams](const httplib::Request &req, httplib::Response &res, task_type type)
+    {
+        res.set_header("Access-Control-Allow-Origin", req.get_header_value("Origin"));
+        if (sparams.slot_save_path.empty())
+        {
+            res.status = 501;
+            res.set_content(R"({"error": "slot save path is not configured"})", "application/json; charset=utf-8");
+            return;
+        }
+
+        task_server task;
+        task.id = llama.queue_tasks.get_new_id();
+        task.type = type;
+        task.target_id = -1;
+        task.data = json::parse(req.body);
+
+        llama.queue_results.add_waiting_task_id(task.id);
+        llama.queue_tasks.post(task);
+
+        task_result result = llama.queue_results.recv(task.id);
+        llama.queue_results.remove_waiting_task_id(task.id);
+
+        if (result.error)
+        {
+            res.status = 400;
+            res.set_content(json{{"error", result.result_json["content"]}}.dump(), "application/json; charset=utf-8");
+            return;
+        }
+        res.set_content(result.result_json.dump(), "application/json; charset=utf-8");
+    };
+
+    svr.Post("/slots/save", [&handle_slot_action](const httplib::Request &req, httplib::Response &res)
+            {
+                handle_slot_action(req, res, TASK_TYPE_SLOT_SAVE);
+            });
+
+    svr.Post("/slots/restore", [&handle_slot_action](const httplib::Request &req, httplib::Response &res)
+            {
+                handle_slot_action(req, res, TASK_TYPE_SLOT_RESTORE);
+            });
+
     svr.Post("/embedding", [&llama](const httplib::Request &req, httplib::Response &res)
             {
                 res.set_header("Access-Control-Allow-Origin", req.get_header_value("Origin"));
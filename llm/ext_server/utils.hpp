@@ -22,6 +22,7 @@
 
 #pragma once
 
+#include <cctype>
 #include <string>
 #include <vector>
 #include <set>
@@ -70,7 +71,9 @@ enum task_type {
     TASK_TYPE_COMPLETION,
     TASK_TYPE_CANCEL,
     TASK_TYPE_NEXT_RESPONSE,
-    TASK_TYPE_METRICS
+    TASK_TYPE_METRICS,
+    TASK_TYPE_SLOT_SAVE,
+    TASK_TYPE_SLOT_RESTORE
 };
 
 struct task_server {
@@ -577,6 +580,23 @@ static size_t common_part(const std::vector<llama_token> &a, const std::vector<l
     return i;
 }
 
+// slot save files must be plain names inside --slot-save-path
+static bool is_valid_slot_file_name(const std::string &filename)
+{
+    if (filename.empty() || filename.size() > 255 || filename[0] == '.')
+    {
+        return false;
+    }
+    for (const char c : filename)
+    {
+        if (!(std::isalnum(static_cast<unsigned char>(c)) || c == '-' || c == '_' || c == '.'))
+        {
+            return false;
+        }
+    }
+    return filename.find("..") == std::string::npos;
+}
+
 static bool ends_with(const std::string &str, const std::string &suffix)
 {
     return str.size() >= suffix.size() &&
@@ -35,6 +35,17 @@ func (kv KV) u64(key string) uint64 {
 	}
 }
 
+func (kv KV) f32(key string) float32 {
+	switch v := kv[key].(type) {
+	case float32:
+		return v
+	case float64:
+		return float32(v)
+	default:
+		return 0
+	}
+}
+
 func (kv KV) Architecture() string {
 	if s, ok := kv["general.architecture"].(string); ok {
 		return s
@@ -107,11 +118,40 @@ func (kv KV) ContextLength() uint64 {
 	return kv.u64(fmt.Sprintf("%s.context_length", kv.Architecture()))
 }
 
+func (kv KV) RopeFrequencyBase() float32 {
+	return kv.f32(fmt.Sprintf("%s.rope.freq_base", kv.Architecture()))
+}
+
+func (kv KV) RopeScalingType() string {
+	s, _ := kv[fmt.Sprintf("%s.rope.scaling.type", kv.Architecture())].(string)
+	return s
+}
+
+func (kv KV) RopeScalingFactor() float32 {
+	return kv.f32(fmt.Sprintf("%s.rope.scaling.factor", kv.Architecture()))
+}
+
 func (kv KV) ChatTemplate() string {
 	s, _ := kv["tokenizer.chat_template"].(string)
 	return s
 }
 
+// EOSToken returns the text of the EOS token or an empty string if the
+// tokens weren't collected when decoding.
+func (kv KV) EOSToken() string {
+	tokens, ok := kv["tokenizer.ggml.tokens"].(*array)
+	if _, hasID := kv["tokenizer.ggml.eos_token_id"]; !ok || !hasID {
+		return ""
+	}
+
+	if id := kv.u64("tokenizer.ggml.eos_token_id"); id < uint64(len(tokens.values)) {
+		s, _ := tokens.values[id].(string)
+		return s
+	}
+
+	return ""
+}
+
 type Tensors []*Tensor
 
 func (ts Tensors) Layers() map[string]Layer {
@@ -501,6 +501,7 @@ func writeGGUFArray[S ~[]E, E any](llm *gguf, w io.Writer, t uint32, s S) error
 var ggufKVOrder = map[string][]string{
 	"llama": {
 		"general.architecture",
+		"general.type",
 		"general.name",
 		"llama.vocab_size",
 		"llama.context_length",
@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/gpu"
+)
+
+var ErrKVCacheType = errors.New("invalid kv_cache_type")
+
+// kvCacheTypes maps the KV cache data types supported by the runner to the
+// average size of an element in bytes, including quantization block scales
+var kvCacheTypes = map[string]float64{
+	"f32":    4,
+	"f16":    2,
+	"q8_0":   34.0 / 32,
+	"q5_1":   24.0 / 32,
+	"q5_0":   22.0 / 32,
+	"q4_1":   20.0 / 32,
+	"q4_0":   18.0 / 32,
+	"iq4_nl": 18.0 / 32,
+}
+
+// KVCacheType returns the KV cache data type for opts. The kv_cache_type
+// option takes precedence over OLLAMA_KV_CACHE_TYPE, which takes precedence
+// over the f16_kv option.
+func KVCacheType(opts api.Options) string {
+	if opts.KVCacheType != "" {
+		return strings.ToLower(opts.KVCacheType)
+	}
+
+	if envconfig.KVCacheType != "" {
+		return envconfig.KVCacheType
+	}
+
+	if !opts.F16KV {
+		return "f32"
+	}
+
+	return "f16"
+}
+
+// ValidateKVCacheType returns an error if the runner doesn't support the KV
+// cache data type or if the type requires flash attention and
+// OLLAMA_FLASH_ATTENTION is off.
+func ValidateKVCacheType(t string) error {
+	if _, ok := kvCacheTypes[t]; !ok {
+		types := make([]string, 0, len(kvCacheTypes))
+		for k := range kvCacheTypes {
+			types = append(types, k)
+		}
+		slices.Sort(types)
+
+		return fmt.Errorf("%w %q, must be one of %s", ErrKVCacheType, t, strings.Join(types, ", "))
+	}
+
+	if kvCacheRequiresFlashAttention(t) && !envconfig.FlashAttention {
+		return fmt.Errorf("%w %q, quantized KV cache requires flash attention, set OLLAMA_FLASH_ATTENTION=1", ErrKVCacheType, t)
+	}
+
+	return nil
+}
+
+// the runner can only quantize the V cache with flash attention
+func kvCacheRequiresFlashAttention(t string) bool {
+	return t != "f16" && t != "f32"
+}
+
+// flashAttentionEnabled reports whether the runner uses flash attention on
+// gpus
+func flashAttentionEnabled(gpus gpu.GpuInfoList) bool {
+	return envconfig.FlashAttention && flashAttentionSupported(gpus)
+}
+
+// effectiveKVCacheType returns the KV cache data type the runner allocates
+// on gpus, which is f16 if the type for opts requires flash attention and it
+// isn't enabled. Memory estimates and runner flags must both use it.
+func effectiveKVCacheType(opts api.Options, gpus gpu.GpuInfoList) string {
+	t := KVCacheType(opts)
+	if kvCacheRequiresFlashAttention(t) && !flashAttentionEnabled(gpus) {
+		return "f16"
+	}
+
+	return t
+}
+
+// flashAttentionSupported reports whether flash attention can be used on all
+// of the gpus, only cuda (compute capability 7+) and metal support it
+func flashAttentionSupported(gpus gpu.GpuInfoList) bool {
+	for _, g := range gpus {
+		if g.Library != "metal" && (g.Library != "cuda" || g.DriverMajor < 7) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// kvCacheSize returns the memory needed by the KV cache of numCtx tokens
+// when elements are stored as the given data type
+func kvCacheSize(ggml *GGML, numCtx uint64, cacheType string) uint64 {
+	bytes, ok := kvCacheTypes[cacheType]
+	if !ok {
+		bytes = kvCacheTypes["f16"]
+	}
+
+	elements := numCtx * ggml.KV().BlockCount() * (ggml.KV().EmbeddingHeadCountK() + ggml.KV().EmbeddingHeadCountV()) * ggml.KV().HeadCountKV()
+	return uint64(float64(elements) * bytes)
+}
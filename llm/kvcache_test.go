@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/gpu"
+)
+
+func TestKVCacheType(t *testing.T) {
+	t.Cleanup(func() { envconfig.KVCacheType = "" })
+
+	opts := api.DefaultOptions()
+	if got := KVCacheType(opts); got != "f16" {
+		t.Errorf("expected f16, got %s", got)
+	}
+
+	opts.F16KV = false
+	if got := KVCacheType(opts); got != "f32" {
+		t.Errorf("expected f32, got %s", got)
+	}
+
+	envconfig.KVCacheType = "q4_0"
+	if got := KVCacheType(opts); got != "q4_0" {
+		t.Errorf("expected q4_0 from the environment, got %s", got)
+	}
+
+	opts.KVCacheType = "Q8_0"
+	if got := KVCacheType(opts); got != "q8_0" {
+		t.Errorf("expected q8_0 from the options, got %s", got)
+	}
+}
+
+func TestValidateKVCacheType(t *testing.T) {
+	t.Cleanup(func() { envconfig.FlashAttention = false })
+
+	cases := []struct {
+		cacheType      string
+		flashAttention bool
+		valid          bool
+	}{
+		{"f16", false, true},
+		{"f32", false, true},
+		{"q8_0", false, false},
+		{"q8_0", true, true},
+		{"q4_0", true, true},
+		{"q2_k", true, false},
+		{"", true, false},
+	}
+
+	for _, tt := range cases {
+		envconfig.FlashAttention = tt.flashAttention
+		err := ValidateKVCacheType(tt.cacheType)
+		if tt.valid && err != nil {
+			t.Errorf("%q (flash attention %t): unexpected error %v", tt.cacheType, tt.flashAttention, err)
+		} else if !tt.valid && !errors.Is(err, ErrKVCacheType) {
+			t.Errorf("%q (flash attention %t): expected ErrKVCacheType, got %v", tt.cacheType, tt.flashAttention, err)
+		}
+	}
+}
+
+func TestFlashAttentionSupported(t *testing.T) {
+	cases := []struct {
+		gpus      gpu.GpuInfoList
+		supported bool
+	}{
+		{gpu.GpuInfoList{{Library: "metal"}}, true},
+		{gpu.GpuInfoList{{Library: "cuda", DriverMajor: 8}, {Library: "cuda", DriverMajor: 7}}, true},
+		{gpu.GpuInfoList{{Library: "cuda", DriverMajor: 8}, {Library: "cuda", DriverMajor: 6}}, false},
+		{gpu.GpuInfoList{{Library: "rocm"}}, false},
+		{gpu.GpuInfoList{{Library: "cpu"}}, false},
+	}
+
+	for _, tt := range cases {
+		if got := flashAttentionSupported(tt.gpus); got != tt.supported {
+			t.Errorf("%v: expected %t, got %t", tt.gpus, tt.supported, got)
+		}
+	}
+}
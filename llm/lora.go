@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	ErrAdapterNotLoaded = errors.New("adapter not loaded")
+
+	// ErrLegacyAdapter is returned for LoRA adapters in the legacy ggla
+	// format, which the runner can't load.
+	ErrLegacyAdapter = errors.New("ggla adapters are no longer supported, convert the adapter to GGUF")
+)
+
+// checkAdapter returns ErrLegacyAdapter if the adapter at path is in the
+// legacy ggla format.
+func checkAdapter(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var magic uint32
+	if err := binary.Read(f, binary.LittleEndian, &magic); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if magic == FILE_MAGIC_GGLA {
+		return fmt.Errorf("%w: %s", ErrLegacyAdapter, path)
+	}
+
+	return nil
+}
+
+// Adapter is a LoRA adapter applied to a completion at Scale.
+type Adapter struct {
+	Path  string
+	Scale float32
+}
+
+type loraScale struct {
+	ID    int     `json:"id"`
+	Scale float32 `json:"scale"`
+}
+
+// loraScales maps the adapters active for a request onto the adapters the
+// runner loaded. Loaded adapters that aren't active get a scale of 0 so one
+// runner can serve every combination of its adapters. It also reports whether
+// the result matches the scales the runner starts with, which is what saved
+// prompts were evaluated with.
+func loraScales(loaded []string, active []Adapter) ([]loraScale, bool, error) {
+	scales := make([]loraScale, len(loaded))
+	for i := range loaded {
+		scales[i].ID = i
+	}
+
+	for _, a := range active {
+		found := false
+		for i, path := range loaded {
+			if path == a.Path {
+				scales[i].Scale = a.Scale
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, false, fmt.Errorf("%w: %s", ErrAdapterNotLoaded, a.Path)
+		}
+	}
+
+	defaults := true
+	for _, s := range scales {
+		if s.Scale != 1 {
+			defaults = false
+		}
+	}
+
+	return scales, defaults, nil
+}
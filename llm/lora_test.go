@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoraScales(t *testing.T) {
+	loaded := []string{"/blobs/a", "/blobs/b"}
+
+	_, defaults, err := loraScales(loaded, []Adapter{{Path: "/blobs/a", Scale: 1}, {Path: "/blobs/b", Scale: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !defaults {
+		t.Errorf("expected every adapter at scale 1 to match the defaults")
+	}
+
+	scales, defaults, err := loraScales(loaded, []Adapter{{Path: "/blobs/b", Scale: 0.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []loraScale{{0, 0}, {1, 0.5}}; !slices.Equal(scales, expect) {
+		t.Errorf("expected %v, got %v", expect, scales)
+	}
+
+	if defaults {
+		t.Errorf("expected disabled adapter not to match the defaults")
+	}
+
+	scales, _, err = loraScales(loaded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []loraScale{{0, 0}, {1, 0}}; !slices.Equal(scales, expect) {
+		t.Errorf("expected every adapter disabled, got %v", scales)
+	}
+
+	if _, _, err := loraScales(loaded, []Adapter{{Path: "/blobs/c", Scale: 1}}); !errors.Is(err, ErrAdapterNotLoaded) {
+		t.Errorf("expected ErrAdapterNotLoaded, got %v", err)
+	}
+}
+
+func TestCheckAdapter(t *testing.T) {
+	dir := t.TempDir()
+
+	ggla := filepath.Join(dir, "ggla")
+	if err := os.WriteFile(ggla, binary.LittleEndian.AppendUint32(nil, FILE_MAGIC_GGLA), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkAdapter(ggla); !errors.Is(err, ErrLegacyAdapter) {
+		t.Errorf("expected ErrLegacyAdapter, got %v", err)
+	}
+
+	gguf := filepath.Join(dir, "gguf")
+	if err := os.WriteFile(gguf, binary.LittleEndian.AppendUint32(nil, FILE_MAGIC_GGUF_LE), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkAdapter(gguf); err != nil {
+		t.Errorf("expected gguf adapter to be accepted, got %v", err)
+	}
+}
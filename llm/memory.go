@@ -12,12 +12,12 @@ import (
 )
 
 // This algorithm looks for a complete fit to determine if we need to unload other models
-func PredictServerFit(allGpus gpu.GpuInfoList, ggml *GGML, adapters, projectors []string, opts api.Options) (bool, uint64) {
+func PredictServerFit(allGpus gpu.GpuInfoList, ggml *GGML, adapters, projectors []string, draft string, opts api.Options) (bool, uint64) {
 	// Split up the GPUs by type and try them
 	var estimatedVRAM uint64
 	for _, gpus := range allGpus.ByLibrary() {
 		var layerCount int
-		estimate := EstimateGPULayers(gpus, ggml, projectors, opts)
+		estimate := EstimateGPULayers(gpus, ggml, projectors, draft, opts)
 		layerCount, estimatedVRAM = estimate.Layers, estimate.VRAMSize
 		if opts.NumGPU < 0 {
 			if layerCount > 0 && layerCount >= int(ggml.KV().BlockCount()+1) {
@@ -51,6 +51,9 @@ type MemoryEstimate struct {
 	// For multi-GPU scenarios, this is the size in bytes per GPU
 	GPUSizes []uint64
 
+	// Number of draft model layers to offload, the draft model is either fully loaded on the first GPU or not at all
+	DraftLayers int
+
 	// internal fields for logging purposes
 	inferenceLibrary    string
 	layersRequested     int
@@ -62,11 +65,15 @@ type MemoryEstimate struct {
 	memoryLayerOutput   uint64
 	graphFullOffload    uint64
 	graphPartialOffload uint64
+	draftSize           uint64
+	numCtx              int
+	numCtxTrain         uint64
+	ropeFrequencyScale  float32
 }
 
 // Given a model and one or more GPU targets, predict how many layers and bytes we can load, and the total size
 // The GPUs provided must all be the same Library
-func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts api.Options) MemoryEstimate {
+func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, draft string, opts api.Options) MemoryEstimate {
 	// Graph size for a partial offload, applies to all GPUs
 	var graphPartialOffload uint64
 
@@ -79,6 +86,10 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 	// Projectors loaded into GPU0 only
 	var projectorSize uint64
 
+	// Draft model weights and KV cache, loaded into GPU0 only if it fits
+	var draftLayers, draftSize uint64
+	var draftOnGPU bool
+
 	// Conditional output size on GPU 0
 	var memoryLayerOutput uint64
 
@@ -107,6 +118,10 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 		opts.NumCtx = max(opts.NumCtx, 2048)
 	}
 
+	if draft != "" {
+		draftLayers, draftSize = draftMemoryRequirements(draft, uint64(opts.NumCtx), effectiveKVCacheType(opts, gpus))
+	}
+
 	layers := ggml.Tensors().Layers()
 	// add one layer worth of memory as a buffer
 	if blk0, ok := layers["blk.0"]; ok {
@@ -115,15 +130,16 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 		slog.Warn("model missing blk.0 layer size")
 	}
 
-	// fp16 k,v = sizeof(float16) * n_ctx * n_layer * (n_embd_head_k + n_embd_head_v) * n_head_kv
-	var kv uint64 = 2 * uint64(opts.NumCtx) * ggml.KV().BlockCount() * (ggml.KV().EmbeddingHeadCountK() + ggml.KV().EmbeddingHeadCountV()) * ggml.KV().HeadCountKV()
+	// k,v = sizeof(kv_cache_type) * n_ctx * n_layer * (n_embd_head_k + n_embd_head_v) * n_head_kv
+	kv := kvCacheSize(ggml, uint64(opts.NumCtx), effectiveKVCacheType(opts, gpus))
 
 	// KV is proportional to the number of layers
 	layerSize += kv / ggml.KV().BlockCount()
 
 	graphPartialOffload, graphFullOffload = ggml.GraphSize(uint64(opts.NumCtx), uint64(min(opts.NumCtx, opts.NumBatch)))
 	if graphPartialOffload == 0 {
-		graphPartialOffload = ggml.KV().GQA() * kv / 6
+		// the graph size doesn't depend on how the cache is stored
+		graphPartialOffload = ggml.KV().GQA() * kvCacheSize(ggml, uint64(opts.NumCtx), "f16") / 6
 	}
 	if graphFullOffload == 0 {
 		graphFullOffload = graphPartialOffload
@@ -168,10 +184,20 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 			slog.Debug("gpu has too little memory to allocate any layers", "gpu", gpus[i])
 			continue
 		}
+		// The draft model goes on the first GPU only if it leaves room for at least one layer of the main model
+		if len(gpusWithSpace) == 0 && draftSize > 0 && gpus[i].FreeMemory >= gzo+draftSize+max(graphPartialOffload, graphFullOffload)+gpus[i].MinimumMemory+2*layerSize {
+			draftOnGPU = true
+			gpuZeroOverhead += draftSize
+		}
 		gpusWithSpace = append(gpusWithSpace, gs{i, &gpus[i]})
 		gpuAllocations[i] += gpus[i].MinimumMemory + layerSize // We hold off on graph until we know partial vs. full
 	}
 
+	// Otherwise the draft model is loaded into system memory
+	if !draftOnGPU {
+		overflow += draftSize
+	}
+
 	var gpuZeroID int
 	if len(gpusWithSpace) > 0 {
 		gpuZeroID = gpusWithSpace[0].i
@@ -287,6 +313,10 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 		memoryLayerOutput:   memoryLayerOutput,
 		graphFullOffload:    graphFullOffload,
 		graphPartialOffload: graphPartialOffload,
+		draftSize:           draftSize,
+		numCtx:              opts.NumCtx,
+		numCtxTrain:         ggml.KV().ContextLength(),
+		ropeFrequencyScale:  opts.RopeFrequencyScale,
 	}
 
 	if gpus[0].Library == "cpu" {
@@ -302,6 +332,9 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 	estimate.TotalSize = memoryRequiredTotal
 	estimate.TensorSplit = tensorSplit
 	estimate.GPUSizes = gpuAllocations
+	if draftOnGPU {
+		estimate.DraftLayers = int(draftLayers)
+	}
 	return estimate
 }
 
@@ -319,6 +352,15 @@ func (m MemoryEstimate) log() {
 			// multi-gpu split for tensors
 			"split", m.TensorSplit,
 		),
+		slog.Group(
+			"context",
+			// requested context size across all parallel sequences, the KV cache grows linearly with it
+			"size", m.numCtx,
+			// context size the model was trained with
+			"trained", m.numCtxTrain,
+			// RoPE frequency scale used to extend the trained context, 0 for the model default
+			"rope_freq_scale", m.ropeFrequencyScale,
+		),
 		slog.Group(
 			"memory",
 			// memory available by GPU for offloading
@@ -350,6 +392,8 @@ func (m MemoryEstimate) log() {
 				// memory of graph when not fully offloaded
 				"partial", format.HumanBytes2(m.graphPartialOffload),
 			),
+			// memory of the draft model including its KV cache
+			"draft", format.HumanBytes2(m.draftSize),
 		),
 	)
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"os"
+	"slices"
 	"testing"
 
 	"github.com/ollama/ollama/api"
@@ -60,7 +61,7 @@ func TestEstimateGPULayers(t *testing.T) {
 	projectors := []string{}
 	opts := api.DefaultOptions()
 	t.Run("cpu", func(t *testing.T) {
-		estimate := EstimateGPULayers(gpus, ggml, projectors, opts)
+		estimate := EstimateGPULayers(gpus, ggml, projectors, "", opts)
 		assert.Equal(t, 0, estimate.Layers)
 		assert.Equal(t, uint64(0), estimate.Graph)
 	})
@@ -111,7 +112,7 @@ func TestEstimateGPULayers(t *testing.T) {
 			gpus[1].FreeMemory += gpuMinimumMemory + layerSize + s.layer1*layerSize + 1
 			gpus[0].FreeMemory += max(graphFullOffload, graphPartialOffload)
 			gpus[1].FreeMemory += max(graphFullOffload, graphPartialOffload)
-			estimate := EstimateGPULayers(gpus, ggml, projectors, opts)
+			estimate := EstimateGPULayers(gpus, ggml, projectors, "", opts)
 			assert.Equal(t, int(s.expect0+s.expect1), estimate.Layers, "scenario %d: %v", i, s)
 			assert.Equal(t, fmt.Sprintf("%d,%d", s.expect0, s.expect1), estimate.TensorSplit, "scenario %d: %v", i, s)
 			var layerSums uint64
@@ -127,4 +128,55 @@ func TestEstimateGPULayers(t *testing.T) {
 			}
 		})
 	}
+	t.Run("kv cache type", func(t *testing.T) {
+		envconfig.FlashAttention = true
+		t.Cleanup(func() { envconfig.FlashAttention = false })
+
+		fa := slices.Clone(gpus)
+		for i := range fa {
+			fa[i].DriverMajor = 7
+		}
+
+		f16 := EstimateGPULayers(fa, ggml, projectors, "", opts)
+
+		q8opts := opts
+		q8opts.KVCacheType = "q8_0"
+		q8 := EstimateGPULayers(fa, ggml, projectors, "", q8opts)
+
+		assert.Equal(t, f16.kv*17/32, q8.kv)
+		assert.Less(t, q8.TotalSize, f16.TotalSize)
+
+		// the runner falls back to f16 without flash attention
+		assert.Equal(t, f16.kv, EstimateGPULayers(gpus, ggml, projectors, "", q8opts).kv)
+
+		envconfig.FlashAttention = false
+		assert.Equal(t, f16.kv, EstimateGPULayers(fa, ggml, projectors, "", q8opts).kv)
+	})
+
+	t.Run("draft", func(t *testing.T) {
+		// the dummy model is its own draft
+		draftLayers, draftSize := draftMemoryRequirements(f.Name(), uint64(opts.NumCtx), "f16")
+
+		gpus := []gpu.GpuInfo{{Library: "cuda", MinimumMemory: gpuMinimumMemory}}
+		gpus[0].FreeMemory = gpuMinimumMemory + layerSize + uint64(inputLayerCount)*layerSize + memoryLayerOutput + max(graphFullOffload, graphPartialOffload) + 1
+
+		// the draft doesn't fit, so it's loaded into system memory without
+		// displacing the main model
+		estimate := EstimateGPULayers(gpus, ggml, projectors, f.Name(), opts)
+		assert.Equal(t, inputLayerCount+1, estimate.Layers)
+		assert.Equal(t, 0, estimate.DraftLayers)
+		assert.Equal(t, draftSize, estimate.TotalSize-estimate.VRAMSize)
+
+		gpus[0].FreeMemory += draftSize
+		estimate = EstimateGPULayers(gpus, ggml, projectors, f.Name(), opts)
+		assert.Equal(t, inputLayerCount+1, estimate.Layers)
+		assert.Equal(t, int(draftLayers), estimate.DraftLayers)
+		assert.Equal(t, estimate.VRAMSize, estimate.TotalSize)
+
+		// without a GPU the draft still counts towards the total
+		cpu := EstimateGPULayers([]gpu.GpuInfo{{Library: "cpu"}}, ggml, projectors, "", opts)
+		estimate = EstimateGPULayers([]gpu.GpuInfo{{Library: "cpu"}}, ggml, projectors, f.Name(), opts)
+		assert.Equal(t, 0, estimate.DraftLayers)
+		assert.Equal(t, cpu.TotalSize+draftSize, estimate.TotalSize)
+	})
 }
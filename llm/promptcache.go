@@ -0,0 +1,455 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// Prompts shorter than this are cheap to evaluate and aren't worth persisting
+const promptCacheMinTokens = 256
+
+// Maximum number of saved prefixes kept per model, least recently used are evicted first
+const promptCacheMaxEntries = 16
+
+const promptCacheIndex = "index.json"
+
+// promptCache persists the KV state of evaluated prompt prefixes so they can be
+// restored into a runner slot after the runner is unloaded or reloaded.
+// Entries are stored under OLLAMA_MODELS/cache/prompts, keyed by the model
+// digest and a hash of the cached token prefix.
+type promptCache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries []promptCacheEntry
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	saves  atomic.Int64
+}
+
+type promptCacheEntry struct {
+	Name     string    `json:"name"`
+	Tokens   []int     `json:"tokens"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+func promptCacheRoot() string {
+	return filepath.Join(envconfig.ModelsDir, "cache", "prompts")
+}
+
+// promptCacheKey identifies the KV layout a saved state is valid for. The model
+// digest comes first so all variants of a model can be found by prefix.
+func promptCacheKey(model string, adapters []string, opts api.Options) string {
+	h := sha256.New()
+	for _, adapter := range adapters {
+		fmt.Fprintf(h, "adapter=%s\n", filepath.Base(adapter))
+	}
+	fmt.Fprintf(h, "kv_cache_type=%s\n", KVCacheType(opts))
+	fmt.Fprintf(h, "rope=%v\n", ropeParams(opts))
+	return fmt.Sprintf("%s-%x", filepath.Base(model), h.Sum(nil)[:8])
+}
+
+func newPromptCache(model string, adapters []string, opts api.Options) (*promptCache, error) {
+	c := &promptCache{dir: filepath.Join(promptCacheRoot(), promptCacheKey(model, adapters, opts))}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(filepath.Join(c.dir, promptCacheIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bts, &c.entries); err != nil {
+		slog.Warn("discarding corrupt prompt cache index", "dir", c.dir, "error", err)
+		c.entries = nil
+	}
+
+	return c, nil
+}
+
+// RemovePromptCache deletes all saved prompt prefixes for the model blob with the given digest
+func RemovePromptCache(digest string) error {
+	matches, err := filepath.Glob(filepath.Join(promptCacheRoot(), strings.ReplaceAll(digest, ":", "-")+"-*"))
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		if err := os.RemoveAll(match); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func commonPrefix[S ~[]E, E comparable](a, b S) int {
+	var n int
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// lookup returns the saved entry sharing the longest prefix with tokens and the
+// length of that prefix. Prompts too short to be worth caching are not counted
+// as misses.
+func (c *promptCache) lookup(tokens []int) (promptCacheEntry, int, bool) {
+	if len(tokens) < promptCacheMinTokens {
+		return promptCacheEntry{}, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best promptCacheEntry
+	var longest int
+	for _, e := range c.entries {
+		if n := commonPrefix(e.Tokens, tokens); n > longest {
+			best, longest = e, n
+		}
+	}
+
+	if longest < promptCacheMinTokens {
+		c.misses.Add(1)
+		return promptCacheEntry{}, 0, false
+	}
+
+	return best, longest, true
+}
+
+// shouldSave reports whether tokens extend the saved entries by enough to be worth persisting
+func (c *promptCache) shouldSave(tokens []int) bool {
+	if len(tokens) < promptCacheMinTokens {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.entries {
+		if commonPrefix(e.Tokens, tokens)+promptCacheMinTokens > len(tokens) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filename derives a stable file name from the token prefix
+func (c *promptCache) filename(tokens []int) string {
+	h := sha256.New()
+	for _, t := range tokens {
+		binary.Write(h, binary.LittleEndian, int32(t)) //nolint:errcheck
+	}
+	return fmt.Sprintf("%x.bin", h.Sum(nil))
+}
+
+// add records a saved state. Entries made redundant by the new prefix and the
+// least recently used entries beyond the limit are removed.
+func (c *promptCache) add(name string, tokens []int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var remove []string
+	c.entries = slices.DeleteFunc(c.entries, func(e promptCacheEntry) bool {
+		if e.Name == name {
+			return true
+		}
+
+		if commonPrefix(e.Tokens, tokens) == len(e.Tokens) {
+			remove = append(remove, e.Name)
+			return true
+		}
+
+		return false
+	})
+
+	c.entries = append(c.entries, promptCacheEntry{Name: name, Tokens: tokens, LastUsed: time.Now()})
+	c.saves.Add(1)
+
+	if len(c.entries) > promptCacheMaxEntries {
+		slices.SortFunc(c.entries, func(a, b promptCacheEntry) int {
+			return b.LastUsed.Compare(a.LastUsed)
+		})
+
+		for _, e := range c.entries[promptCacheMaxEntries:] {
+			remove = append(remove, e.Name)
+		}
+		c.entries = c.entries[:promptCacheMaxEntries]
+	}
+
+	for _, name := range remove {
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to remove prompt cache entry", "name", name, "error", err)
+		}
+	}
+
+	return c.writeIndex()
+}
+
+// touch marks the entry as used so it survives eviction
+func (c *promptCache) touch(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.entries {
+		if c.entries[i].Name == name {
+			c.entries[i].LastUsed = time.Now()
+		}
+	}
+
+	if err := c.writeIndex(); err != nil {
+		slog.Warn("failed to update prompt cache index", "error", err)
+	}
+}
+
+// remove drops an entry which could not be restored
+func (c *promptCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = slices.DeleteFunc(c.entries, func(e promptCacheEntry) bool {
+		return e.Name == name
+	})
+
+	if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("failed to remove prompt cache entry", "name", name, "error", err)
+	}
+
+	if err := c.writeIndex(); err != nil {
+		slog.Warn("failed to update prompt cache index", "error", err)
+	}
+}
+
+// writeIndex must be called with mu held
+func (c *promptCache) writeIndex() error {
+	bts, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(c.dir, promptCacheIndex+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(bts); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(c.dir, promptCacheIndex))
+}
+
+func (c *promptCache) stats() *api.PromptCacheStats {
+	return &api.PromptCacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Saves:  c.saves.Load(),
+	}
+}
+
+type slotState struct {
+	ID     int `json:"id"`
+	State  int `json:"state"`
+	Prompt any `json:"prompt"`
+}
+
+// slotIdle matches the IDLE slot_state of the llama.cpp server
+const slotIdle = 0
+
+type slotActionRequest struct {
+	SlotID   int    `json:"slot_id"`
+	Filename string `json:"filename"`
+}
+
+type slotSaveResponse struct {
+	Tokens []int `json:"tokens"`
+}
+
+func (s *llmServer) slots(ctx context.Context) ([]slotState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/slots", s.port), nil)
+	if err != nil {
+		return nil, fmt.Errorf("slots request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do slots request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read slots request: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	var slots []slotState
+	if err := json.Unmarshal(body, &slots); err != nil {
+		return nil, fmt.Errorf("unmarshal slots response: %w", err)
+	}
+
+	return slots, nil
+}
+
+// slotAction saves or restores the KV state of a slot to a file in the prompt cache directory
+func (s *llmServer) slotAction(ctx context.Context, action string, slotID int, filename string, v any) error {
+	data, err := json.Marshal(slotActionRequest{SlotID: slotID, Filename: filename})
+	if err != nil {
+		return fmt.Errorf("marshaling slot %s data: %w", action, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/slots/%s", s.port, action), bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("slot %s request: %w", action, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do slot %s request: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read slot %s request: %w", action, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s", body)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// restorePrompt loads the longest saved prefix of prompt into an idle slot, unless
+// a slot already holds at least as much of it. It returns the prompt tokens and
+// the slot the completion should run in, or -1 to let the runner pick. A
+// session's slot is kept as is.
+func (s *llmServer) restorePrompt(ctx context.Context, prompt string, slotID int) ([]int, int) {
+	tokens, err := s.Tokenize(ctx, prompt)
+	if err != nil {
+		slog.Debug("prompt cache lookup skipped", "error", err)
+		return nil, slotID
+	}
+
+	if slotID >= 0 {
+		return tokens, slotID
+	}
+
+	entry, n, ok := s.promptCache.lookup(tokens)
+	if !ok {
+		return tokens, -1
+	}
+
+	cached, err := s.Detokenize(ctx, tokens[:n])
+	if err != nil {
+		slog.Debug("prompt cache lookup skipped", "error", err)
+		return tokens, -1
+	}
+
+	slots, err := s.slots(ctx)
+	if err != nil {
+		slog.Debug("prompt cache lookup skipped", "error", err)
+		return tokens, -1
+	}
+
+	// restore into the idle slot with the least useful contents
+	target, shortest := -1, len(prompt)+1
+	for _, slot := range slots {
+		if slot.State != slotIdle {
+			continue
+		}
+
+		p, _ := slot.Prompt.(string)
+		common := commonPrefix([]byte(p), []byte(prompt))
+		if common >= len(cached) {
+			// already warm in memory, nothing to restore
+			return tokens, slot.ID
+		}
+
+		if common < shortest {
+			target, shortest = slot.ID, common
+		}
+	}
+
+	if target < 0 {
+		return tokens, -1
+	}
+
+	if err := s.slotAction(ctx, "restore", target, entry.Name, nil); err != nil {
+		slog.Warn("failed to restore prompt cache", "name", entry.Name, "error", err)
+		s.promptCache.misses.Add(1)
+		s.promptCache.remove(entry.Name)
+		return tokens, -1
+	}
+
+	slog.Debug("restored prompt cache", "name", entry.Name, "slot", target, "tokens", n)
+	s.promptCache.hits.Add(1)
+	s.promptCache.touch(entry.Name)
+	return tokens, target
+}
+
+// savePrompt persists the KV state of the slot which evaluated tokens when it
+// adds enough to what is already cached. It runs after the completion has been
+// returned to the caller so the save doesn't delay the response.
+func (s *llmServer) savePrompt(slotID int, tokens []int) {
+	if !s.promptCache.shouldSave(tokens) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	name := s.promptCache.filename(tokens)
+
+	var resp slotSaveResponse
+	if err := s.slotAction(ctx, "save", slotID, name, &resp); err != nil {
+		slog.Warn("failed to save prompt cache", "slot", slotID, "error", err)
+		return
+	}
+
+	if err := s.promptCache.add(name, resp.Tokens); err != nil {
+		slog.Warn("failed to update prompt cache index", "error", err)
+		return
+	}
+
+	slog.Debug("saved prompt cache", "name", name, "slot", slotID, "tokens", len(resp.Tokens))
+}
@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func seq(start, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = start + i
+	}
+	return s
+}
+
+func TestPromptCache(t *testing.T) {
+	envconfig.ModelsDir = t.TempDir()
+
+	c, err := newPromptCache("/models/blobs/sha256-abc", nil, api.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short := seq(0, promptCacheMinTokens-1)
+	if c.shouldSave(short) {
+		t.Error("short prompts should not be saved")
+	}
+
+	if _, _, ok := c.lookup(short); ok {
+		t.Error("short prompts should not match")
+	}
+
+	if c.stats().Misses != 0 {
+		t.Error("short prompts should not count as misses")
+	}
+
+	system := seq(0, promptCacheMinTokens*2)
+	if !c.shouldSave(system) {
+		t.Fatal("expected long prompt to be saved")
+	}
+
+	name := c.filename(system)
+	if err := os.WriteFile(filepath.Join(c.dir, name), []byte("state"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.add(name, system); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := append(append([]int{}, system...), seq(10000, 10)...)
+	entry, n, ok := c.lookup(prompt)
+	if !ok || entry.Name != name || n != len(system) {
+		t.Errorf("expected %s to match %d tokens, got %s %d", name, len(system), entry.Name, n)
+	}
+
+	if c.shouldSave(prompt) {
+		t.Error("prompts mostly covered by an existing entry should not be saved")
+	}
+
+	// a longer prefix replaces the entry it extends
+	longer := append(append([]int{}, system...), seq(10000, promptCacheMinTokens)...)
+	if err := c.add(c.filename(longer), longer); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(c.dir, name)); !os.IsNotExist(err) {
+		t.Error("expected superseded entry to be removed")
+	}
+
+	// the index survives a runner restart
+	reloaded, err := newPromptCache("/models/blobs/sha256-abc", nil, api.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, n, ok := reloaded.lookup(prompt); !ok || n != len(system)+10 {
+		t.Errorf("expected reloaded cache to match %d tokens, got %d", len(system)+10, n)
+	}
+
+	if _, _, ok := reloaded.lookup(seq(50000, promptCacheMinTokens)); ok {
+		t.Error("unexpected match")
+	}
+
+	if s := reloaded.stats(); s.Misses != 1 {
+		t.Errorf("expected 1 miss, got %d", s.Misses)
+	}
+
+	if err := RemovePromptCache("sha256:abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(c.dir); !os.IsNotExist(err) {
+		t.Error("expected prompt cache to be removed with the model")
+	}
+}
+
+func TestPromptCacheEviction(t *testing.T) {
+	envconfig.ModelsDir = t.TempDir()
+
+	c, err := newPromptCache("sha256-abc", nil, api.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range promptCacheMaxEntries + 2 {
+		tokens := seq(i*100000, promptCacheMinTokens)
+		if err := c.add(c.filename(tokens), tokens); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(c.entries) != promptCacheMaxEntries {
+		t.Fatalf("expected %d entries, got %d", promptCacheMaxEntries, len(c.entries))
+	}
+
+	if _, _, ok := c.lookup(seq(0, promptCacheMinTokens)); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+}
+
+func TestPromptCacheKey(t *testing.T) {
+	opts := api.DefaultOptions()
+	base := promptCacheKey("/blobs/sha256-abc", nil, opts)
+	if base != promptCacheKey("/other/sha256-abc", nil, opts) {
+		t.Error("key should only depend on the blob")
+	}
+
+	if base == promptCacheKey("/blobs/sha256-abc", []string{"/blobs/sha256-def"}, opts) {
+		t.Error("adapters change the KV state")
+	}
+
+	opts.F16KV = false
+	if base == promptCacheKey("/blobs/sha256-abc", nil, opts) {
+		t.Error("kv type changes the KV state")
+	}
+}
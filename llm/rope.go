@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/ollama/ollama/api"
+)
+
+var ErrRopeOptions = errors.New("invalid rope options")
+
+// ValidateRopeOptions checks the RoPE and YaRN options in opts against the
+// model's metadata. opts.NumCtx must be the context size of a single sequence.
+func ValidateRopeOptions(ggml *GGML, opts api.Options) error {
+	switch opts.RopeScalingType {
+	case "", "none", "linear", "yarn":
+	default:
+		return fmt.Errorf("%w: rope_scaling_type must be one of \"none\", \"linear\" or \"yarn\"", ErrRopeOptions)
+	}
+
+	for _, o := range []struct {
+		name  string
+		value float32
+	}{
+		{"rope_freq_base", opts.RopeFrequencyBase},
+		{"yarn_ext_factor", opts.YarnExtFactor},
+		{"yarn_attn_factor", opts.YarnAttnFactor},
+		{"yarn_beta_fast", opts.YarnBetaFast},
+		{"yarn_beta_slow", opts.YarnBetaSlow},
+	} {
+		if o.value < 0 {
+			return fmt.Errorf("%w: %s must not be negative", ErrRopeOptions, o.name)
+		}
+	}
+
+	if opts.RopeFrequencyScale < 0 || opts.RopeFrequencyScale > 1 {
+		return fmt.Errorf("%w: rope_freq_scale must be between 0 and 1", ErrRopeOptions)
+	}
+
+	kv := ggml.KV()
+	scalingType := cmp.Or(opts.RopeScalingType, kv.RopeScalingType())
+	if scalingType == "none" && opts.RopeFrequencyScale != 0 && opts.RopeFrequencyScale != 1 {
+		return fmt.Errorf("%w: rope_freq_scale has no effect with rope_scaling_type \"none\"", ErrRopeOptions)
+	}
+
+	if scalingType != "yarn" && (opts.YarnExtFactor > 0 || opts.YarnAttnFactor > 0 || opts.YarnBetaFast > 0 || opts.YarnBetaSlow > 0) {
+		return fmt.Errorf("%w: yarn options require rope_scaling_type \"yarn\"", ErrRopeOptions)
+	}
+
+	trained := kv.ContextLength()
+	if trained == 0 || uint64(opts.NumCtx) <= trained {
+		return nil
+	}
+
+	if opts.RopeFrequencyScale > 0 {
+		// scaling the frequencies by s stretches the trained context by 1/s
+		if supported := uint64(float64(trained) / float64(opts.RopeFrequencyScale)); uint64(opts.NumCtx) > supported {
+			return fmt.Errorf("%w: num_ctx %d exceeds the %d tokens supported by the model's %d token context with rope_freq_scale %s",
+				ErrRopeOptions, opts.NumCtx, supported, trained, strconv.FormatFloat(float64(opts.RopeFrequencyScale), 'g', -1, 32))
+		}
+	} else if scalingType == "" || scalingType == "none" {
+		slog.Warn("num_ctx is larger than the model's training context and no rope scaling is set, output quality may degrade", "num_ctx", opts.NumCtx, "n_ctx_train", trained)
+	}
+
+	return nil
+}
+
+// ropeParams returns the runner flags for the RoPE and YaRN options in opts
+func ropeParams(opts api.Options) []string {
+	var params []string
+	if opts.RopeScalingType != "" {
+		params = append(params, "--rope-scaling", opts.RopeScalingType)
+	}
+
+	for _, p := range []struct {
+		flag  string
+		value float32
+	}{
+		{"--rope-freq-base", opts.RopeFrequencyBase},
+		{"--rope-freq-scale", opts.RopeFrequencyScale},
+		{"--yarn-ext-factor", opts.YarnExtFactor},
+		{"--yarn-attn-factor", opts.YarnAttnFactor},
+		{"--yarn-beta-fast", opts.YarnBetaFast},
+		{"--yarn-beta-slow", opts.YarnBetaSlow},
+	} {
+		if p.value > 0 {
+			params = append(params, p.flag, strconv.FormatFloat(float64(p.value), 'g', -1, 32))
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestValidateRopeOptions(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := NewGGUFV3(binary.LittleEndian).Encode(f, KV{
+		"general.architecture":      "llama",
+		"llama.context_length":      uint32(4096),
+		"llama.rope.freq_base":      float32(10000),
+		"tokenizer.ggml.tokens":     []string{" "},
+		"tokenizer.ggml.scores":     []float32{0},
+		"tokenizer.ggml.token_type": []int32{0},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ggml, err := LoadModel(f.Name(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		runner api.Runner
+		valid  bool
+	}{
+		{"defaults", api.Runner{NumCtx: 2048}, true},
+		{"longer than trained", api.Runner{NumCtx: 8192}, true},
+		{"linear", api.Runner{NumCtx: 8192, RopeScalingType: "linear", RopeFrequencyScale: 0.5}, true},
+		{"scale too small for context", api.Runner{NumCtx: 16384, RopeFrequencyScale: 0.5}, false},
+		{"yarn", api.Runner{NumCtx: 16384, RopeScalingType: "yarn", RopeFrequencyScale: 0.25, YarnBetaFast: 32}, true},
+		{"yarn options without yarn", api.Runner{NumCtx: 2048, YarnExtFactor: 0.5}, false},
+		{"unknown type", api.Runner{NumCtx: 2048, RopeScalingType: "ntk"}, false},
+		{"scale with none", api.Runner{NumCtx: 2048, RopeScalingType: "none", RopeFrequencyScale: 0.5}, false},
+		{"scale above one", api.Runner{NumCtx: 2048, RopeFrequencyScale: 2}, false},
+		{"negative base", api.Runner{NumCtx: 2048, RopeFrequencyBase: -1}, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRopeOptions(ggml, api.Options{Runner: tt.runner})
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error %v", err)
+			} else if !tt.valid && !errors.Is(err, ErrRopeOptions) {
+				t.Errorf("expected ErrRopeOptions, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRopeParams(t *testing.T) {
+	if params := ropeParams(api.Options{}); len(params) != 0 {
+		t.Errorf("expected no params, got %v", params)
+	}
+
+	params := ropeParams(api.Options{Runner: api.Runner{
+		RopeScalingType:    "yarn",
+		RopeFrequencyBase:  500000,
+		RopeFrequencyScale: 0.25,
+		YarnBetaFast:       32,
+	}})
+
+	expect := []string{"--rope-scaling", "yarn", "--rope-freq-base", "500000", "--rope-freq-scale", "0.25", "--yarn-beta-fast", "32"}
+	if !slices.Equal(params, expect) {
+		t.Errorf("expected %v, got %v", expect, params)
+	}
+}
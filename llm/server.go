@@ -40,6 +40,8 @@ type LlamaServer interface {
 	EstimatedVRAM() uint64 // Total VRAM across all GPUs
 	EstimatedTotal() uint64
 	EstimatedVRAMByGPU(gpuID string) uint64
+	PromptCacheStats() *api.PromptCacheStats
+	DraftStats() *api.DraftStats
 }
 
 // llmServer is an instance of the llama.cpp server
@@ -57,6 +59,18 @@ type llmServer struct {
 	loadDuration time.Duration   // Record how long it took the model to load
 	loadProgress float32
 
+	// Persisted prompt prefixes, nil unless OLLAMA_PROMPT_CACHE is set
+	promptCache *promptCache
+
+	// Slot each conversation session last ran in
+	sessions slotSessions
+
+	// Speculative decoding counters, nil unless a draft model is loaded
+	draft *draftStats
+
+	// LoRA adapters loaded into the runner, in the order passed to it
+	adapters []string
+
 	sem *semaphore.Weighted
 }
 
@@ -82,7 +96,7 @@ func LoadModel(model string, maxArraySize int) (*GGML, error) {
 
 // NewLlamaServer will run a server for the given GPUs
 // The gpu list must be a single family.
-func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, projectors []string, opts api.Options, numParallel int) (LlamaServer, error) {
+func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, projectors []string, draft string, opts api.Options, numParallel int) (LlamaServer, error) {
 	var err error
 	var cpuRunner string
 	var estimate MemoryEstimate
@@ -104,11 +118,12 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 	if opts.NumGPU == 0 {
 		gpus = gpu.GetCPUInfo()
 	}
+
 	if len(gpus) == 1 && gpus[0].Library == "cpu" {
 		cpuRunner = serverForCpu()
-		estimate = EstimateGPULayers(gpus, ggml, projectors, opts)
+		estimate = EstimateGPULayers(gpus, ggml, projectors, draft, opts)
 	} else {
-		estimate = EstimateGPULayers(gpus, ggml, projectors, opts)
+		estimate = EstimateGPULayers(gpus, ggml, projectors, draft, opts)
 
 		switch {
 		case gpus[0].Library == "metal" && estimate.VRAMSize > systemTotalMemory:
@@ -119,6 +134,8 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 			// Don't bother loading into the GPU if no layers can fit
 			cpuRunner = serverForCpu()
 			gpus = gpu.GetCPUInfo()
+			// the KV cache type may differ on the CPU
+			estimate = EstimateGPULayers(gpus, ggml, projectors, draft, opts)
 		case opts.NumGPU < 0 && estimate.Layers > 0 && gpus[0].Library != "cpu":
 			opts.NumGPU = estimate.Layers
 		}
@@ -139,10 +156,6 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 	// Loop through potential servers
 	finalErr := errors.New("no suitable llama servers found")
 
-	if len(adapters) > 1 {
-		return nil, errors.New("ollama supports only one lora adapter, but multiple were provided")
-	}
-
 	availableServers := getAvailableServers()
 	if len(availableServers) == 0 {
 		if runtime.GOOS != "windows" {
@@ -203,9 +216,13 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--main-gpu", fmt.Sprintf("%d", opts.MainGPU))
 	}
 
-	if len(adapters) > 0 {
-		// TODO: applying multiple adapters is not supported by the llama.cpp server yet
-		params = append(params, "--lora", adapters[0])
+	for _, adapter := range adapters {
+		// models created before ggla adapters were rejected may still have one
+		if err := checkAdapter(adapter); err != nil {
+			return nil, err
+		}
+
+		params = append(params, "--lora", adapter)
 	}
 
 	if len(projectors) > 0 {
@@ -213,22 +230,37 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--mmproj", projectors[0])
 	}
 
+	if draft != "" {
+		params = append(params, "--model-draft", draft)
+		if opts.NumGPU >= 0 {
+			params = append(params, "--n-gpu-layers-draft", fmt.Sprintf("%d", estimate.DraftLayers))
+		}
+	}
+
 	if opts.NumThread > 0 {
 		params = append(params, "--threads", fmt.Sprintf("%d", opts.NumThread))
 	}
 
-	if !opts.F16KV {
-		params = append(params, "--memory-f32")
+	params = append(params, ropeParams(opts)...)
+
+	// the KV cache type was estimated with the same gpus
+	flashAttnEnabled := flashAttentionEnabled(gpus)
+
+	kvCacheType := effectiveKVCacheType(opts, gpus)
+	if kvCacheType != KVCacheType(opts) {
+		slog.Warn("flash attention is not enabled, using f16 KV cache", "kv_cache_type", KVCacheType(opts))
 	}
+	opts.KVCacheType = kvCacheType
 
-	flashAttnEnabled := envconfig.FlashAttention
+	switch kvCacheType {
+	case "f16":
+	case "f32":
+		params = append(params, "--memory-f32")
+	default:
+		params = append(params, "--cache-type-k", kvCacheType, "--cache-type-v", kvCacheType)
+	}
 
 	for _, g := range gpus {
-		// only cuda (compute capability 7+) and metal support flash attention
-		if g.Library != "metal" && (g.Library != "cuda" || g.DriverMajor < 7) {
-			flashAttnEnabled = false
-		}
-
 		// mmap has issues with partial offloading on metal
 		if g.Library == "metal" &&
 			uint64(opts.NumGPU) > 0 &&
@@ -266,6 +298,17 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--tensor-split", estimate.TensorSplit)
 	}
 
+	var cache *promptCache
+	if envconfig.PromptCache {
+		cache, err = newPromptCache(model, adapters, opts)
+		if err != nil {
+			slog.Warn("failed to initialize prompt cache, disabling", "error", err)
+			cache = nil
+		} else {
+			params = append(params, "--slot-save-path", cache.dir)
+		}
+	}
+
 	for i := range len(servers) {
 		dir := availableServers[servers[i]]
 		if dir == "" {
@@ -340,9 +383,15 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 			sem:         semaphore.NewWeighted(int64(numParallel)),
 			totalLayers: ggml.KV().BlockCount() + 1,
 			gpus:        gpus,
+			promptCache: cache,
+			adapters:    adapters,
 			done:        make(chan error, 1),
 		}
 
+		if draft != "" {
+			s.draft = &draftStats{}
+		}
+
 		s.cmd.Env = os.Environ()
 		s.cmd.Stdout = os.Stdout
 		s.cmd.Stderr = s.status
@@ -445,6 +494,30 @@ func projectorMemoryRequirements(filename string) uint64 {
 	return mem
 }
 
+// draftMemoryRequirements returns the number of layers in a draft model and
+// the memory needed to fully offload it, including its KV cache
+func draftMemoryRequirements(filename string, numCtx uint64, cacheType string) (uint64, uint64) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	ggml, _, err := DecodeGGML(file, 0)
+	if err != nil {
+		return 0, 0
+	}
+
+	var mem uint64
+	for _, layer := range ggml.Tensors().Layers() {
+		mem += layer.size()
+	}
+
+	mem += kvCacheSize(ggml, numCtx, cacheType)
+
+	return ggml.KV().BlockCount() + 1, mem
+}
+
 type ServerStatus int
 
 const ( // iota is reset to 0
@@ -674,12 +747,16 @@ type completion struct {
 	Prompt       string `json:"prompt"`
 	Stop         bool   `json:"stop"`
 	StoppedLimit bool   `json:"stopped_limit"`
+	SlotID       int    `json:"slot_id"`
 
 	Timings struct {
 		PredictedN  int     `json:"predicted_n"`
 		PredictedMS float64 `json:"predicted_ms"`
 		PromptN     int     `json:"prompt_n"`
+		PromptCache int     `json:"prompt_cached_n"`
 		PromptMS    float64 `json:"prompt_ms"`
+		DraftN      int     `json:"draft_n"`
+		DraftAccN   int     `json:"draft_accepted_n"`
 	}
 }
 
@@ -688,6 +765,12 @@ type CompletionRequest struct {
 	Format  string
 	Images  []ImageData
 	Options *api.Options
+
+	// Session routes requests of the same conversation to the same slot
+	Session string
+
+	// Adapters active for this request, any other loaded adapter is disabled
+	Adapters []Adapter
 }
 
 type CompletionResponse struct {
@@ -695,9 +778,12 @@ type CompletionResponse struct {
 	DoneReason         string
 	Done               bool
 	PromptEvalCount    int
+	PromptCachedCount  int
 	PromptEvalDuration time.Duration
 	EvalCount          int
 	EvalDuration       time.Duration
+	DraftCount         int
+	DraftAcceptedCount int
 }
 
 func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error {
@@ -745,6 +831,30 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		return fmt.Errorf("unexpected server status: %s", status.ToString())
 	}
 
+	// saved prompts were evaluated with every adapter at its default scale
+	restorable := true
+	if len(s.adapters) > 0 {
+		lora, defaults, err := loraScales(s.adapters, req.Adapters)
+		if err != nil {
+			return err
+		}
+
+		request["lora"] = lora
+		restorable = defaults
+	}
+
+	slotID := s.sessions.get(req.Session)
+
+	// image embeddings can't be restored from a saved prompt
+	var promptTokens []int
+	if s.promptCache != nil && restorable && len(req.Images) == 0 {
+		promptTokens, slotID = s.restorePrompt(ctx, req.Prompt, slotID)
+	}
+
+	if slotID >= 0 {
+		request["slot_id"] = slotID
+	}
+
 	if req.Format == "json" {
 		request["grammar"] = jsonGrammar
 		if !strings.Contains(strings.ToLower(req.Prompt), "json") {
@@ -842,10 +952,22 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 					Done:               true,
 					DoneReason:         doneReason,
 					PromptEvalCount:    c.Timings.PromptN,
+					PromptCachedCount:  c.Timings.PromptCache,
 					PromptEvalDuration: parseDurationMs(c.Timings.PromptMS),
 					EvalCount:          c.Timings.PredictedN,
 					EvalDuration:       parseDurationMs(c.Timings.PredictedMS),
+					DraftCount:         c.Timings.DraftN,
+					DraftAcceptedCount: c.Timings.DraftAccN,
 				})
+
+				if s.draft != nil {
+					s.draft.add(c.Timings.DraftN, c.Timings.DraftAccN)
+				}
+
+				s.sessions.set(req.Session, c.SlotID)
+				if promptTokens != nil {
+					go s.savePrompt(c.SlotID, promptTokens)
+				}
 				return nil
 			}
 		}
@@ -1064,6 +1186,20 @@ func (s *llmServer) EstimatedVRAMByGPU(gpuID string) uint64 {
 	return 0
 }
 
+func (s *llmServer) PromptCacheStats() *api.PromptCacheStats {
+	if s.promptCache == nil {
+		return nil
+	}
+	return s.promptCache.stats()
+}
+
+func (s *llmServer) DraftStats() *api.DraftStats {
+	if s.draft == nil {
+		return nil
+	}
+	return s.draft.stats()
+}
+
 func parseDurationMs(ms float64) time.Duration {
 	dur, err := time.ParseDuration(fmt.Sprintf("%fms", ms))
 	if err != nil {
@@ -0,0 +1,49 @@
+package llm
+
+import "sync"
+
+// slotSessions remembers which runner slot each conversation session last ran
+// in so follow-up turns land on the slot holding their cached prompt. A slot
+// only belongs to the session which used it last.
+type slotSessions struct {
+	mu    sync.Mutex
+	slots map[string]int
+}
+
+// get returns the slot for the session or -1 if there is none
+func (s *slotSessions) get(session string) int {
+	if session == "" {
+		return -1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slot, ok := s.slots[session]; ok {
+		return slot
+	}
+
+	return -1
+}
+
+func (s *slotSessions) set(session string, slot int) {
+	if session == "" || slot < 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.slots == nil {
+		s.slots = make(map[string]int)
+	}
+
+	// the slot's cache now holds this session, other sessions lost it
+	for k, v := range s.slots {
+		if v == slot {
+			delete(s.slots, k)
+		}
+	}
+
+	s.slots[session] = slot
+}
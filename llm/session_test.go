@@ -0,0 +1,33 @@
+package llm
+
+import "testing"
+
+func TestSlotSessions(t *testing.T) {
+	var s slotSessions
+
+	if slot := s.get("a"); slot != -1 {
+		t.Errorf("expected no slot, got %d", slot)
+	}
+
+	s.set("a", 1)
+	s.set("b", 2)
+	s.set("", 3)
+
+	if slot := s.get("a"); slot != 1 {
+		t.Errorf("expected slot 1, got %d", slot)
+	}
+
+	if slot := s.get(""); slot != -1 {
+		t.Errorf("expected no slot for empty session, got %d", slot)
+	}
+
+	// b takes over a's slot
+	s.set("b", 1)
+	if slot := s.get("a"); slot != -1 {
+		t.Errorf("expected a to lose its slot, got %d", slot)
+	}
+
+	if slot := s.get("b"); slot != 1 {
+		t.Errorf("expected slot 1, got %d", slot)
+	}
+}
@@ -169,10 +169,9 @@ func toChatCompletion(id string, r api.ChatResponse) ChatCompletion {
 			}(r.DoneReason),
 		}},
 		Usage: Usage{
-			// TODO: ollama returns 0 for prompt eval if the prompt was cached, but openai returns the actual count
-			PromptTokens:     r.PromptEvalCount,
+			PromptTokens:     r.PromptEvalCount + r.PromptCachedCount,
 			CompletionTokens: r.EvalCount,
-			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.PromptCachedCount + r.EvalCount,
 		},
 	}
 }
@@ -215,10 +214,9 @@ func toCompletion(id string, r api.GenerateResponse) Completion {
 			}(r.DoneReason),
 		}},
 		Usage: Usage{
-			// TODO: ollama returns 0 for prompt eval if the prompt was cached, but openai returns the actual count
-			PromptTokens:     r.PromptEvalCount,
+			PromptTokens:     r.PromptEvalCount + r.PromptCachedCount,
 			CompletionTokens: r.EvalCount,
-			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.PromptCachedCount + r.EvalCount,
 		},
 	}
 }
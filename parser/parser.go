@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -36,7 +39,7 @@ func (c Command) String() string {
 	switch c.Name {
 	case "model":
 		fmt.Fprintf(&sb, "FROM %s", c.Args)
-	case "license", "template", "system", "adapter":
+	case "license", "template", "system", "adapter", "draft", "include":
 		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), quote(c.Args))
 	case "message":
 		role, message, _ := strings.Cut(c.Args, ": ")
@@ -48,6 +51,41 @@ func (c Command) String() string {
 	return sb.String()
 }
 
+// Position is a line and column in a Modelfile, both starting at 1. File is
+// the path of the included file the position is in, and empty for positions
+// in the Modelfile itself.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File != "" {
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// ParseError is an error at a position in a Modelfile.
+type ParseError struct {
+	Pos Position
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Pos.File != "" {
+		return fmt.Sprintf("%s, line %d, column %d: %v", e.Pos.File, e.Pos.Line, e.Pos.Column, e.Err)
+	}
+
+	return fmt.Sprintf("line %d, column %d: %v", e.Pos.Line, e.Pos.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 type state int
 
 const (
@@ -62,16 +100,123 @@ const (
 var (
 	errMissingFrom        = errors.New("no FROM line")
 	errInvalidMessageRole = errors.New("message role must be one of \"system\", \"user\", or \"assistant\"")
-	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", or \"message\"")
+	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"draft\", \"parameter\", \"message\", or \"include\"")
+	errIncludeCycle       = errors.New("include cycle")
+	errUnsetVariable      = errors.New("variable is not set")
 )
 
+// ParseOptions controls how INCLUDE commands and variables are resolved.
+type ParseOptions struct {
+	// Dir is the directory relative INCLUDE paths are resolved against.
+	Dir string
+
+	// Lookup returns the value of a variable. ${NAME} and ${NAME:-default}
+	// in command arguments are replaced with the value, and $${ with ${.
+	// Variables are left as they are if Lookup is nil.
+	Lookup func(name string) (string, bool)
+
+	// includes are the files being included, to detect cycles
+	includes []string
+
+	// keepIncludes keeps INCLUDE commands rather than resolving them
+	keepIncludes bool
+}
+
 func ParseFile(r io.Reader) (*File, error) {
+	return ParseFileWithOptions(r, ParseOptions{})
+}
+
+// ParseFileWithOptions is like ParseFile but resolves INCLUDE commands and
+// variables with opts.
+func ParseFileWithOptions(r io.Reader, opts ParseOptions) (*File, error) {
+	f, _, errs := parseFile(r, "", opts, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	if err := checkFrom(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ParseFileAll is like ParseFileWithOptions but doesn't stop at the first
+// error. The rest of a line with an error is skipped, and the commands which
+// could be parsed are returned with the position of each and an error for
+// each line which couldn't.
+func ParseFileAll(r io.Reader, opts ParseOptions) (*File, []Position, []error) {
+	f, positions, errs := parseFile(r, "", opts, true)
+	if f == nil {
+		return nil, nil, errs
+	}
+
+	if err := checkFrom(f); err != nil {
+		errs = append(errs, err)
+	}
+
+	return f, positions, errs
+}
+
+func checkFrom(f *File) error {
+	if !slices.ContainsFunc(f.Commands, func(cmd Command) bool { return cmd.Name == "model" }) {
+		return errMissingFrom
+	}
+
+	return nil
+}
+
+// parseFile parses the Modelfile read from r, which is named filename in
+// positions unless it's the top level Modelfile.
+func parseFile(r io.Reader, filename string, opts ParseOptions, all bool) (*File, []Position, []error) {
 	var cmd Command
 	var curr state
 	var b bytes.Buffer
 	var role string
 
 	var f File
+	var positions []Position
+	var errs []error
+
+	// pos is the position of the current rune and start the position of the
+	// current command
+	var pos, start Position
+	line, col := 1, 0
+
+	// emit substitutes the variables in the arguments of a parsed command and
+	// adds it, or the commands of the file it includes
+	emit := func(cmd Command) error {
+		if expands(cmd.Name) {
+			args, err := expand(cmd.Args, opts.Lookup)
+			if err != nil {
+				return err
+			}
+
+			cmd.Args = args
+		}
+		if cmd.Name != "include" || opts.keepIncludes {
+			f.Commands = append(f.Commands, cmd)
+			positions = append(positions, start)
+			return nil
+		}
+
+		included, includedPositions, includedErrs := parseInclude(cmd.Args, opts, all)
+		for _, err := range includedErrs {
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				err = &ParseError{Pos: start, Err: err}
+			}
+
+			errs = append(errs, err)
+		}
+
+		if included != nil {
+			f.Commands = append(f.Commands, included.Commands...)
+			positions = append(positions, includedPositions...)
+		}
+
+		return nil
+	}
 
 	tr := unicode.BOMOverride(unicode.UTF8.NewDecoder())
 	br := bufio.NewReader(transform.NewReader(r, tr))
@@ -81,14 +226,48 @@ func ParseFile(r io.Reader) (*File, error) {
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return nil, err
+			return nil, nil, []error{err}
+		}
+
+		pos = Position{File: filename, Line: line, Column: col + 1}
+		newline := isNewline(r)
+		if r == '\n' {
+			line, col = line+1, 0
+		} else {
+			col++
+		}
+
+		// fail records a syntax error. Unless all errors are wanted, parsing
+		// stops. Otherwise the rest of the line is skipped.
+		fail := func(pos Position, err error) bool {
+			errs = append(errs, &ParseError{Pos: pos, Err: err})
+			if !all {
+				return true
+			}
+
+			cmd, role = Command{}, ""
+			b.Reset()
+			curr = stateComment
+			if newline {
+				curr = stateNil
+			}
+
+			return false
 		}
 
 		next, r, err := parseRuneForState(r, curr)
 		if errors.Is(err, io.ErrUnexpectedEOF) {
-			return nil, fmt.Errorf("%w: %s", err, b.String())
+			if fail(pos, fmt.Errorf("%w: %s", err, b.String())) {
+				return nil, nil, errs
+			}
+
+			continue
 		} else if err != nil {
-			return nil, err
+			if fail(pos, err) {
+				return nil, nil, errs
+			}
+
+			continue
 		}
 
 		// process the state transition, some transitions need to be intercepted and redirected
@@ -96,7 +275,11 @@ func ParseFile(r io.Reader) (*File, error) {
 			switch curr {
 			case stateName:
 				if !isValidCommand(b.String()) {
-					return nil, errInvalidCommand
+					if fail(start, errInvalidCommand) {
+						return nil, nil, errs
+					}
+
+					continue
 				}
 
 				// next state sometimes depends on the current buffer value
@@ -117,17 +300,23 @@ func ParseFile(r io.Reader) (*File, error) {
 				cmd.Name = b.String()
 			case stateMessage:
 				if !isValidMessageRole(b.String()) {
-					return nil, errInvalidMessageRole
+					if fail(start, errInvalidMessageRole) {
+						return nil, nil, errs
+					}
+
+					continue
 				}
 
 				role = b.String()
 			case stateComment, stateNil:
-				// pass
+				if next == stateName {
+					start = pos
+				}
 			case stateValue:
 				s, ok := unquote(strings.TrimSpace(b.String()))
 				if !ok || isSpace(r) {
 					if _, err := b.WriteRune(r); err != nil {
-						return nil, err
+						return nil, nil, []error{err}
 					}
 
 					continue
@@ -139,7 +328,17 @@ func ParseFile(r io.Reader) (*File, error) {
 				}
 
 				cmd.Args = s
-				f.Commands = append(f.Commands, cmd)
+				if err := emit(cmd); err != nil {
+					if fail(start, err) {
+						return nil, nil, errs
+					}
+
+					continue
+				}
+
+				if !all && len(errs) > 0 {
+					return nil, nil, errs
+				}
 			}
 
 			b.Reset()
@@ -148,7 +347,7 @@ func ParseFile(r io.Reader) (*File, error) {
 
 		if strconv.IsPrint(r) {
 			if _, err := b.WriteRune(r); err != nil {
-				return nil, err
+				return nil, nil, []error{err}
 			}
 		}
 	}
@@ -160,7 +359,8 @@ func ParseFile(r io.Reader) (*File, error) {
 	case stateValue:
 		s, ok := unquote(strings.TrimSpace(b.String()))
 		if !ok {
-			return nil, io.ErrUnexpectedEOF
+			errs = append(errs, &ParseError{Pos: start, Err: io.ErrUnexpectedEOF})
+			break
 		}
 
 		if role != "" {
@@ -168,18 +368,153 @@ func ParseFile(r io.Reader) (*File, error) {
 		}
 
 		cmd.Args = s
-		f.Commands = append(f.Commands, cmd)
+		if err := emit(cmd); err != nil {
+			errs = append(errs, &ParseError{Pos: start, Err: err})
+		}
 	default:
-		return nil, io.ErrUnexpectedEOF
+		errs = append(errs, &ParseError{Pos: start, Err: io.ErrUnexpectedEOF})
 	}
 
-	for _, cmd := range f.Commands {
-		if cmd.Name == "model" {
-			return &f, nil
+	if !all && len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	return &f, positions, errs
+}
+
+// parseInclude parses the Modelfile fragment at path. Unlike a Modelfile, a
+// fragment doesn't need a FROM command.
+func parseInclude(path string, opts ParseOptions, all bool) (*File, []Position, []error) {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+
+		path = filepath.Join(home, path[2:])
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(opts.Dir, path)
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	if slices.Contains(opts.includes, path) {
+		return nil, nil, []error{fmt.Errorf("%w: %s", errIncludeCycle, strings.Join(append(opts.includes, path), " -> "))}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	defer f.Close()
+
+	opts.Dir = filepath.Dir(path)
+	opts.includes = append(slices.Clip(opts.includes), path)
+	included, positions, errs := parseFile(f, path, opts, all)
+	if included != nil {
+		for i, cmd := range included.Commands {
+			included.Commands[i].Args = resolveIncludedPath(cmd, opts.Dir)
+		}
+	}
+
+	return included, positions, errs
+}
+
+// resolveIncludedPath returns the argument of a FROM or ADAPTER command of an
+// included file, made absolute if it is the path of a file relative to dir.
+// Other arguments, such as model names, are returned as they are.
+func resolveIncludedPath(cmd Command, dir string) string {
+	if cmd.Name != "model" && cmd.Name != "adapter" {
+		return cmd.Args
+	}
+
+	if cmd.Args == "" || filepath.IsAbs(cmd.Args) || cmd.Args == "~" || strings.HasPrefix(cmd.Args, "~/") {
+		return cmd.Args
+	}
+
+	path := filepath.Join(dir, cmd.Args)
+	if _, err := os.Stat(path); err != nil {
+		return cmd.Args
+	}
+
+	return path
+}
+
+// expands reports whether variables are substituted in the arguments of the
+// command name. Text which is passed to the model as it is, such as a system
+// prompt, is left alone since it may contain ${...} of its own.
+func expands(name string) bool {
+	switch name {
+	case "template", "system", "message", "license":
+		return false
+	default:
+		return true
+	}
+}
+
+// expand replaces the variables in s with their values from lookup.
+func expand(s string, lookup func(string) (string, bool)) (string, error) {
+	if lookup == nil || !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			// $${ is an escaped ${
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		sb.WriteString(s[:i])
+
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("unterminated variable %q", s[i:])
+		}
+
+		name, fallback, hasFallback := strings.Cut(s[i+2:i+j], ":-")
+		if !isValidVariable(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+
+		value, ok := lookup(name)
+		if !ok || (hasFallback && value == "") {
+			if !hasFallback {
+				return "", fmt.Errorf("%w: %s", errUnsetVariable, name)
+			}
+
+			value = fallback
+		}
+
+		sb.WriteString(value)
+		s = s[i+j+1:]
+	}
+}
+
+func isValidVariable(name string) bool {
+	if name == "" || isNumber(rune(name[0])) {
+		return false
+	}
+
+	for _, r := range name {
+		if !isAlpha(r) && !isNumber(r) && r != '_' {
+			return false
 		}
 	}
 
-	return nil, errMissingFrom
+	return true
 }
 
 func parseRuneForState(r rune, cs state) (state, rune, error) {
@@ -296,7 +631,7 @@ func isValidMessageRole(role string) bool {
 
 func isValidCommand(cmd string) bool {
 	switch strings.ToLower(cmd) {
-	case "from", "license", "template", "system", "adapter", "parameter", "message":
+	case "from", "license", "template", "system", "adapter", "draft", "parameter", "message", "include":
 		return true
 	default:
 		return false
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"unicode/utf16"
@@ -19,6 +21,7 @@ func TestParseFileFile(t *testing.T) {
 	input := `
 FROM model1
 ADAPTER adapter1
+DRAFT draft1
 LICENSE MIT
 PARAMETER param1 value1
 PARAMETER param2 value2
@@ -39,6 +42,7 @@ TEMPLATE """{{ if .System }}<|start_header_id|>system<|end_header_id|>
 	expectedCommands := []Command{
 		{Name: "model", Args: "model1"},
 		{Name: "adapter", Args: "adapter1"},
+		{Name: "draft", Args: "draft1"},
 		{Name: "license", Args: "MIT"},
 		{Name: "param1", Args: "value1"},
 		{Name: "param2", Args: "value2"},
@@ -182,6 +186,169 @@ BADCOMMAND param1 value1
 `
 	_, err := ParseFile(strings.NewReader(input))
 	require.ErrorIs(t, err, errInvalidCommand)
+
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, Position{Line: 3, Column: 1}, perr.Pos)
+}
+
+func TestParseFileAll(t *testing.T) {
+	input := `FROM foo
+BADCOMMAND param1 value1
+PARAMETER temperature 0.5
+MESSAGE robot hello
+  SYSTEM """
+unterminated`
+
+	f, positions, errs := ParseFileAll(strings.NewReader(input), ParseOptions{})
+
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "temperature", Args: "0.5"},
+	}, f.Commands)
+
+	assert.Equal(t, []Position{{Line: 1, Column: 1}, {Line: 3, Column: 1}}, positions)
+
+	require.Len(t, errs, 3)
+
+	for i, want := range []struct {
+		pos Position
+		err error
+	}{
+		{Position{Line: 2, Column: 1}, errInvalidCommand},
+		{Position{Line: 4, Column: 1}, errInvalidMessageRole},
+		{Position{Line: 5, Column: 3}, io.ErrUnexpectedEOF},
+	} {
+		var perr *ParseError
+		require.ErrorAs(t, errs[i], &perr)
+		assert.Equal(t, want.pos, perr.Pos)
+		require.ErrorIs(t, errs[i], want.err)
+	}
+
+	_, _, errs = ParseFileAll(strings.NewReader("SYSTEM hello"), ParseOptions{})
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], errMissingFrom)
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "shared"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared", "params"), []byte("PARAMETER temperature 0.5\nINCLUDE system\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared", "system"), []byte("SYSTEM \"\"\"You are a helpful assistant.\"\"\""), 0o644))
+
+	input := `FROM foo
+INCLUDE shared/params
+PARAMETER num_ctx 4096
+`
+
+	f, err := ParseFileWithOptions(strings.NewReader(input), ParseOptions{Dir: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "temperature", Args: "0.5"},
+		{Name: "system", Args: "You are a helpful assistant."},
+		{Name: "num_ctx", Args: "4096"},
+	}, f.Commands)
+
+	assert.Equal(t, "FROM foo\nPARAMETER temperature 0.5\nSYSTEM You are a helpful assistant.\nPARAMETER num_ctx 4096\n", f.String())
+
+	t.Run("positions", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bad"), []byte("PARAMETER top_k 10\n  BADCOMMAND x\n"), 0o644))
+
+		f, positions, errs := ParseFileAll(strings.NewReader("FROM foo\nINCLUDE bad\nINCLUDE missing"), ParseOptions{Dir: dir})
+		assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "top_k", Args: "10"}}, f.Commands)
+		assert.Equal(t, []Position{{Line: 1, Column: 1}, {File: filepath.Join(dir, "bad"), Line: 1, Column: 1}}, positions)
+
+		require.Len(t, errs, 2)
+
+		var perr *ParseError
+		require.ErrorAs(t, errs[0], &perr)
+		assert.Equal(t, Position{File: filepath.Join(dir, "bad"), Line: 2, Column: 3}, perr.Pos)
+		require.ErrorIs(t, errs[0], errInvalidCommand)
+
+		require.ErrorAs(t, errs[1], &perr)
+		assert.Equal(t, Position{Line: 3, Column: 1}, perr.Pos)
+		require.ErrorIs(t, errs[1], os.ErrNotExist)
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "shared", "adapter.gguf"), nil, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "shared", "adapters"), []byte("FROM llama3\nADAPTER ./adapter.gguf\nADAPTER missing.gguf\nADAPTER "+filepath.Join(dir, "other.gguf")+"\n"), 0o644))
+
+		f, err := ParseFileWithOptions(strings.NewReader("INCLUDE shared/adapters"), ParseOptions{Dir: dir})
+		require.NoError(t, err)
+
+		assert.Equal(t, []Command{
+			{Name: "model", Args: "llama3"},
+			{Name: "adapter", Args: filepath.Join(dir, "shared", "adapter.gguf")},
+			{Name: "adapter", Args: "missing.gguf"},
+			{Name: "adapter", Args: filepath.Join(dir, "other.gguf")},
+		}, f.Commands)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("INCLUDE b"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b"), []byte("SYSTEM hi\nINCLUDE a"), 0o644))
+
+		_, err := ParseFileWithOptions(strings.NewReader("FROM foo\nINCLUDE a"), ParseOptions{Dir: dir})
+		require.ErrorIs(t, err, errIncludeCycle)
+
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, Position{File: filepath.Join(dir, "b"), Line: 2, Column: 1}, perr.Pos)
+	})
+}
+
+func TestParseFileVariables(t *testing.T) {
+	vars := map[string]string{"BASE": "llama3", "TEMP": "0.7", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	input := `FROM ${BASE}:8b
+PARAMETER temperature ${TEMP}
+PARAMETER num_ctx ${CTX:-2048}
+PARAMETER stop ${EMPTY:-<|end|>}
+PARAMETER stop $${NOT_A_VAR}
+TEMPLATE """{{ .Prompt }} ${HOME}"""
+SYSTEM Your home is ${HOME}.
+MESSAGE user Where is ${MISSING}?
+LICENSE ${MISSING}
+`
+
+	f, err := ParseFileWithOptions(strings.NewReader(input), ParseOptions{Lookup: lookup})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "llama3:8b"},
+		{Name: "temperature", Args: "0.7"},
+		{Name: "num_ctx", Args: "2048"},
+		{Name: "stop", Args: "<|end|>"},
+		{Name: "stop", Args: "${NOT_A_VAR}"},
+		// text passed to the model is left alone
+		{Name: "template", Args: "{{ .Prompt }} ${HOME}"},
+		{Name: "system", Args: "Your home is ${HOME}."},
+		{Name: "message", Args: "user: Where is ${MISSING}?"},
+		{Name: "license", Args: "${MISSING}"},
+	}, f.Commands)
+
+	f, err = ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, "${BASE}:8b", f.Commands[0].Args)
+
+	for _, tt := range []struct {
+		input string
+		err   string
+	}{
+		{"FROM foo\nPARAMETER seed ${MISSING}", "line 2, column 1: variable is not set: MISSING"},
+		{"FROM foo\nADAPTER ${1X}", "line 2, column 1: invalid variable name \"1X\""},
+		{"FROM ${BASE", "line 1, column 1: unterminated variable \"${BASE\""},
+	} {
+		_, err := ParseFileWithOptions(strings.NewReader(tt.input), ParseOptions{Lookup: lookup})
+		require.EqualError(t, err, tt.err)
+	}
 }
 
 func TestParseFileMessages(t *testing.T) {
@@ -519,6 +686,7 @@ func TestParseFileFormatParseFile(t *testing.T) {
 		`
 FROM foo
 ADAPTER adapter1
+DRAFT draft1
 LICENSE MIT
 PARAMETER param1 value1
 PARAMETER param2 value2
@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ParseAdapter splits the name= and scale= options off the end of the
+// argument of an ADAPTER command, returning the adapter reference that
+// remains in From.
+func ParseAdapter(args string) (api.AdapterSpec, error) {
+	adapter := api.AdapterSpec{From: args}
+	for {
+		i := strings.LastIndexAny(adapter.From, " \t")
+		if i < 0 {
+			break
+		}
+
+		key, value, ok := strings.Cut(adapter.From[i+1:], "=")
+		if !ok {
+			break
+		}
+
+		switch key {
+		case "name":
+			if value == "" {
+				return api.AdapterSpec{}, errors.New("adapter name is empty")
+			}
+
+			adapter.Name = value
+		case "scale":
+			scale, err := strconv.ParseFloat(value, 32)
+			if err != nil || scale <= 0 {
+				return api.AdapterSpec{}, fmt.Errorf("invalid adapter scale: %s", value)
+			}
+
+			adapter.Scale = float32(scale)
+		default:
+			return adapter, nil
+		}
+
+		adapter.From = strings.TrimRight(adapter.From[:i], " \t")
+	}
+
+	return adapter, nil
+}
+
+// FormatAdapter returns the argument of an ADAPTER command for adapter.
+func FormatAdapter(adapter api.AdapterSpec) string {
+	args := adapter.From
+	if adapter.Name != "" {
+		args += " name=" + adapter.Name
+	}
+
+	if adapter.Scale != 0 && adapter.Scale != 1 {
+		args += " scale=" + strconv.FormatFloat(float64(adapter.Scale), 'f', -1, 32)
+	}
+
+	return args
+}
+
+// ParseSpec converts a structured model definition to the Modelfile with the
+// same commands.
+func ParseSpec(spec api.ModelSpec) (*File, error) {
+	if spec.From == "" {
+		return nil, errMissingFrom
+	}
+
+	var f File
+	f.Commands = append(f.Commands, Command{Name: "model", Args: spec.From})
+	for _, projector := range spec.Projectors {
+		f.Commands = append(f.Commands, Command{Name: "model", Args: projector})
+	}
+
+	for _, adapter := range spec.Adapters {
+		if adapter.From == "" {
+			return nil, errors.New("adapter from is empty")
+		}
+
+		f.Commands = append(f.Commands, Command{Name: "adapter", Args: FormatAdapter(adapter)})
+	}
+
+	if spec.Draft != "" {
+		f.Commands = append(f.Commands, Command{Name: "draft", Args: spec.Draft})
+	}
+
+	if spec.Template != "" {
+		f.Commands = append(f.Commands, Command{Name: "template", Args: spec.Template})
+	}
+
+	if spec.System != "" {
+		f.Commands = append(f.Commands, Command{Name: "system", Args: spec.System})
+	}
+
+	// sort parameters so the same spec always gives the same Modelfile
+	keys := make([]string, 0, len(spec.Parameters))
+	for k := range spec.Parameters {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		switch v := spec.Parameters[k].(type) {
+		case []any:
+			for _, s := range v {
+				f.Commands = append(f.Commands, Command{Name: k, Args: formatParam(s)})
+			}
+		case []string:
+			for _, s := range v {
+				f.Commands = append(f.Commands, Command{Name: k, Args: s})
+			}
+		default:
+			f.Commands = append(f.Commands, Command{Name: k, Args: formatParam(v)})
+		}
+	}
+
+	for _, msg := range spec.Messages {
+		if !isValidMessageRole(msg.Role) {
+			return nil, errInvalidMessageRole
+		}
+
+		f.Commands = append(f.Commands, Command{Name: "message", Args: msg.Role + ": " + msg.Content})
+	}
+
+	for _, license := range spec.License {
+		f.Commands = append(f.Commands, Command{Name: "license", Args: license})
+	}
+
+	return &f, nil
+}
+
+// formatParam formats a parameter value as it's written in a Modelfile. JSON
+// numbers decode as float64, which %v would format in exponent notation
+// that integer options don't accept.
+func formatParam(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// Spec converts the Modelfile to a structured model definition. Parameters
+// are converted to the types of their options.
+func (f File) Spec() (*api.ModelSpec, error) {
+	var spec api.ModelSpec
+	params := make(map[string][]string)
+	for _, c := range f.Commands {
+		switch c.Name {
+		case "model":
+			if spec.From == "" {
+				spec.From = c.Args
+			} else {
+				spec.Projectors = append(spec.Projectors, c.Args)
+			}
+		case "adapter":
+			adapter, err := ParseAdapter(c.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			spec.Adapters = append(spec.Adapters, adapter)
+		case "draft":
+			spec.Draft = c.Args
+		case "template":
+			spec.Template = c.Args
+		case "system":
+			spec.System = c.Args
+		case "message":
+			role, content, _ := strings.Cut(c.Args, ": ")
+			spec.Messages = append(spec.Messages, api.Message{Role: role, Content: content})
+		case "license":
+			spec.License = append(spec.License, c.Args)
+		case "include":
+			return nil, errors.New("INCLUDE must be resolved before converting to a spec")
+		default:
+			params[c.Name] = append(params[c.Name], c.Args)
+		}
+	}
+
+	if spec.From == "" {
+		return nil, errMissingFrom
+	}
+
+	if len(params) > 0 {
+		var err error
+		spec.Parameters, err = api.FormatParams(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &spec, nil
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpec(t *testing.T) {
+	spec := api.ModelSpec{
+		From:       "llama3",
+		Projectors: []string{"./mmproj.gguf"},
+		Adapters:   []api.AdapterSpec{{From: "./sql.gguf", Name: "sql", Scale: 0.5}, {From: "./chat.gguf"}},
+		Draft:      "llama3:8b",
+		Template:   "{{ .System }} {{ .Prompt }}",
+		System:     "You are a helpful assistant.",
+		Parameters: map[string]any{"temperature": 0.5, "num_ctx": 4096, "stop": []any{"<|end|>", "<|user|>"}},
+		Messages:   []api.Message{{Role: "user", Content: "hello"}, {Role: "assistant", Content: "hi"}},
+		License:    []string{"MIT"},
+	}
+
+	f, err := ParseSpec(spec)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "llama3"},
+		{Name: "model", Args: "./mmproj.gguf"},
+		{Name: "adapter", Args: "./sql.gguf name=sql scale=0.5"},
+		{Name: "adapter", Args: "./chat.gguf"},
+		{Name: "draft", Args: "llama3:8b"},
+		{Name: "template", Args: "{{ .System }} {{ .Prompt }}"},
+		{Name: "system", Args: "You are a helpful assistant."},
+		{Name: "num_ctx", Args: "4096"},
+		{Name: "stop", Args: "<|end|>"},
+		{Name: "stop", Args: "<|user|>"},
+		{Name: "temperature", Args: "0.5"},
+		{Name: "message", Args: "user: hello"},
+		{Name: "message", Args: "assistant: hi"},
+		{Name: "license", Args: "MIT"},
+	}, f.Commands)
+
+	// the Modelfile parses to the same commands
+	parsed, err := ParseFile(strings.NewReader(f.String()))
+	require.NoError(t, err)
+	assert.Equal(t, f.Commands, parsed.Commands)
+
+	actual, err := f.Spec()
+	require.NoError(t, err)
+
+	spec.Parameters = map[string]any{"temperature": float32(0.5), "num_ctx": int64(4096), "stop": []string{"<|end|>", "<|user|>"}}
+	assert.Equal(t, spec, *actual)
+
+	for _, tt := range []struct {
+		spec api.ModelSpec
+		err  string
+	}{
+		{api.ModelSpec{System: "hi"}, errMissingFrom.Error()},
+		{api.ModelSpec{From: "llama3", Messages: []api.Message{{Role: "robot"}}}, errInvalidMessageRole.Error()},
+		{api.ModelSpec{From: "llama3", Adapters: []api.AdapterSpec{{Name: "sql"}}}, "adapter from is empty"},
+	} {
+		_, err := ParseSpec(tt.spec)
+		require.EqualError(t, err, tt.err)
+	}
+
+	// JSON numbers decode as float64, large integers mustn't be formatted
+	// in exponent notation
+	var fromJSON api.ModelSpec
+	require.NoError(t, json.Unmarshal([]byte(`{"from": "llama3", "parameters": {"seed": 1234567, "num_predict": 10000000, "top_p": 0.9}}`), &fromJSON))
+
+	f, err = ParseSpec(fromJSON)
+	require.NoError(t, err)
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "llama3"},
+		{Name: "num_predict", Args: "10000000"},
+		{Name: "seed", Args: "1234567"},
+		{Name: "top_p", Args: "0.9"},
+	}, f.Commands)
+
+	actual, err = f.Spec()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"seed": int64(1234567), "num_predict": int64(10000000), "top_p": float32(0.9)}, actual.Parameters)
+
+	_, err = File{Commands: []Command{{Name: "model", Args: "llama3"}, {Name: "temprature", Args: "0.5"}}}.Spec()
+	require.EqualError(t, err, "unknown parameter 'temprature'")
+}
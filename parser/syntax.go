@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Syntax is a Modelfile as it is written, with its comments and layout.
+// Unlike a File, INCLUDE commands and variables are kept as they are.
+type Syntax struct {
+	Nodes []Node
+}
+
+// Node is a command, a comment or a blank line in a Modelfile.
+type Node struct {
+	Pos Position
+
+	// Raw is the source of the node, including its line ending. A command
+	// spans several lines if its value is quoted and has line breaks.
+	Raw string
+
+	// Command is the command in Raw, or nil for comments and blank lines.
+	Command *Command
+
+	// Keyword, Name and Value are the parts of a command as they are
+	// written. Name is the parameter name or message role, if any, and
+	// Value is quoted as it is in Raw.
+	Keyword, Name, Value string
+}
+
+// IsComment reports whether n is a comment.
+func (n Node) IsComment() bool {
+	return n.Command == nil && strings.HasPrefix(strings.TrimSpace(n.Raw), "#")
+}
+
+// IsBlank reports whether n is a blank line.
+func (n Node) IsBlank() bool {
+	return n.Command == nil && strings.TrimSpace(n.Raw) == ""
+}
+
+// ParseSyntax parses a Modelfile into a syntax tree, which reproduces the
+// Modelfile with String.
+func ParseSyntax(r io.Reader) (*Syntax, error) {
+	tr := unicode.BOMOverride(unicode.UTF8.NewDecoder())
+	bts, err := io.ReadAll(transform.NewReader(r, tr))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.SplitAfter(string(bts), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var s Syntax
+	for i := 0; i < len(lines); i++ {
+		n := Node{Pos: Position{Line: i + 1, Column: 1}, Raw: lines[i]}
+
+		text := strings.TrimLeft(lines[i], " \t")
+		if trimmed := strings.TrimRight(text, "\r\n"); trimmed == "" || trimmed[0] == '#' {
+			s.Nodes = append(s.Nodes, n)
+			continue
+		}
+
+		n.Pos.Column += len([]rune(lines[i])) - len([]rune(text))
+
+		// a command continues on the next lines until its value is complete
+		n.Keyword, text = cutField(text)
+		if lower := strings.ToLower(n.Keyword); lower == "parameter" || lower == "message" {
+			n.Name, text = cutField(text)
+		}
+
+		value := text
+		for {
+			if _, ok := unquote(strings.TrimSpace(value)); ok || i+1 >= len(lines) {
+				break
+			}
+
+			i++
+			n.Raw += lines[i]
+			value += lines[i]
+		}
+
+		n.Value = strings.TrimSpace(value)
+
+		opts := ParseOptions{keepIncludes: true}
+		f, _, errs := parseFile(strings.NewReader(n.Raw), "", opts, false)
+		if len(errs) > 0 {
+			var perr *ParseError
+			if errors.As(errs[0], &perr) {
+				perr.Pos.Line += n.Pos.Line - 1
+			}
+
+			return nil, errs[0]
+		}
+
+		n.Command = &f.Commands[0]
+		s.Nodes = append(s.Nodes, n)
+	}
+
+	return &s, nil
+}
+
+// cutField returns the first field of s, which ends at a space, a tab or a
+// line ending, and the rest of s after the spaces and tabs following it.
+func cutField(s string) (field, rest string) {
+	if i := strings.IndexAny(s, " \t\r\n"); i >= 0 {
+		return s[:i], strings.TrimLeft(s[i:], " \t")
+	}
+
+	return s, ""
+}
+
+// String returns the Modelfile s was parsed from.
+func (s Syntax) String() string {
+	var sb strings.Builder
+	for _, n := range s.Nodes {
+		sb.WriteString(n.Raw)
+	}
+
+	return sb.String()
+}
+
+// Format returns the Modelfile in canonical form. Keywords are upper case
+// and separated from their arguments by one space, comments and commands
+// aren't indented, consecutive blank lines are collapsed, and lines end in a
+// single newline. Values, including their quoting, and comments are kept as
+// they are written.
+func (s Syntax) Format() string {
+	var sb strings.Builder
+	blank := false
+	for _, n := range s.Nodes {
+		switch {
+		case n.IsBlank():
+			blank = sb.Len() > 0
+			continue
+		case blank:
+			sb.WriteString("\n")
+			blank = false
+		}
+
+		if n.Command == nil {
+			sb.WriteString(strings.TrimSpace(n.Raw))
+		} else {
+			sb.WriteString(strings.ToUpper(n.Keyword))
+			if n.Name != "" {
+				sb.WriteString(" " + n.Name)
+			}
+
+			if n.Value != "" {
+				sb.WriteString(" " + n.Value)
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
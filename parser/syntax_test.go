@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyntax(t *testing.T) {
+	input := `# a comment
+  from llama3
+
+
+parameter temperature   0.5
+PARAMETER stop "<|eot_id|>"   
+	# an indented comment
+TEMPLATE """{{ .System }}
+
+# not a comment
+{{ .Prompt }}"""
+message user   hello
+include ./shared.modelfile
+SYSTEM ${SYSTEM}
+
+`
+
+	s, err := ParseSyntax(strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, input, s.String())
+
+	var commands []Command
+	var positions []Position
+	for _, n := range s.Nodes {
+		if n.Command != nil {
+			commands = append(commands, *n.Command)
+			positions = append(positions, n.Pos)
+		}
+	}
+
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "llama3"},
+		{Name: "temperature", Args: "0.5"},
+		{Name: "stop", Args: "<|eot_id|>"},
+		{Name: "template", Args: "{{ .System }}\n\n# not a comment\n{{ .Prompt }}"},
+		{Name: "message", Args: "user: hello"},
+		{Name: "include", Args: "./shared.modelfile"},
+		{Name: "system", Args: "${SYSTEM}"},
+	}, commands)
+
+	assert.Equal(t, []Position{
+		{Line: 2, Column: 3},
+		{Line: 5, Column: 1},
+		{Line: 6, Column: 1},
+		{Line: 8, Column: 1},
+		{Line: 12, Column: 1},
+		{Line: 13, Column: 1},
+		{Line: 14, Column: 1},
+	}, positions)
+
+	expect := `# a comment
+FROM llama3
+
+PARAMETER temperature 0.5
+PARAMETER stop "<|eot_id|>"
+# an indented comment
+TEMPLATE """{{ .System }}
+
+# not a comment
+{{ .Prompt }}"""
+MESSAGE user hello
+INCLUDE ./shared.modelfile
+SYSTEM ${SYSTEM}
+`
+
+	formatted := s.Format()
+	assert.Equal(t, expect, formatted)
+
+	// formatting is idempotent
+	s, err = ParseSyntax(strings.NewReader(formatted))
+	require.NoError(t, err)
+	assert.Equal(t, formatted, s.Format())
+}
+
+func TestParseSyntaxErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		pos   Position
+		err   error
+	}{
+		{"FROM foo\n\nBADCOMMAND x", Position{Line: 3, Column: 1}, errInvalidCommand},
+		{"FROM foo\nMESSAGE robot hi", Position{Line: 2, Column: 1}, errInvalidMessageRole},
+		{"FROM foo\n# comment\nSYSTEM \"\"\"\nunterminated\n", Position{Line: 3, Column: 1}, io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range cases {
+		_, err := ParseSyntax(strings.NewReader(tt.input))
+		require.ErrorIs(t, err, tt.err)
+
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, tt.pos, perr.Pos)
+	}
+}
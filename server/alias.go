@@ -0,0 +1,209 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errAliasIsModel = errors.New("a model with that name already exists")
+	errAliasSelf    = errors.New("an alias can't point at itself")
+)
+
+// aliasesMu serializes changes to aliases.json.
+var aliasesMu sync.Mutex
+
+// Alias is a name which refers to another model instead of a manifest of
+// its own.
+type Alias struct {
+	Name   model.Name
+	Target model.Name
+}
+
+func aliasesPath() string {
+	return filepath.Join(envconfig.ModelsDir, "aliases.json")
+}
+
+// readAliases reads the aliases in the models directory, keyed by the fully
+// qualified alias name.
+func readAliases() (map[string]string, error) {
+	aliases := make(map[string]string)
+
+	bts, err := os.ReadFile(aliasesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return aliases, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bts, &aliases); err != nil {
+		return nil, fmt.Errorf("%s: %w", aliasesPath(), err)
+	}
+
+	return aliases, nil
+}
+
+func writeAliases(aliases map[string]string) error {
+	bts, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(envconfig.ModelsDir, 0o755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a failed write doesn't lose aliases
+	tmp := aliasesPath() + ".tmp"
+	if err := os.WriteFile(tmp, bts, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, aliasesPath())
+}
+
+// Aliases returns all aliases sorted by name.
+func Aliases() ([]Alias, error) {
+	aliases, err := readAliases()
+	if err != nil {
+		return nil, err
+	}
+
+	var as []Alias
+	for name, target := range aliases {
+		as = append(as, Alias{Name: model.ParseName(name), Target: model.ParseName(target)})
+	}
+
+	slices.SortFunc(as, func(a, b Alias) int {
+		return cmp.Compare(a.Name.DisplayShortest(), b.Name.DisplayShortest())
+	})
+
+	return as, nil
+}
+
+// hasManifest reports whether a manifest is stored for n.
+func hasManifest(n model.Name) bool {
+	manifests, err := GetManifestPath()
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(manifests, n.Filepath()))
+	return err == nil
+}
+
+// resolveAlias returns the target of n if n is an alias. A model stored
+// under the same name takes precedence over an alias.
+func resolveAlias(n model.Name) (model.Name, bool) {
+	if !n.IsFullyQualified() || hasManifest(n) {
+		return n, false
+	}
+
+	aliases, err := readAliases()
+	if err != nil {
+		return n, false
+	}
+
+	target, ok := aliases[n.String()]
+	if !ok {
+		return n, false
+	}
+
+	return model.ParseName(target), true
+}
+
+// CreateAlias points name at target, replacing the target of an existing
+// alias. If target is itself an alias, name points at its target.
+func CreateAlias(name, target model.Name) error {
+	if !name.IsFullyQualified() {
+		return model.Unqualified(name)
+	}
+
+	if !target.IsFullyQualified() {
+		return model.Unqualified(target)
+	}
+
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	target, _ = resolveAlias(target)
+	if strings.EqualFold(name.String(), target.String()) {
+		return errAliasSelf
+	}
+
+	if !hasManifest(target) {
+		return fmt.Errorf("model %q not found: %w", target.DisplayShortest(), os.ErrNotExist)
+	}
+
+	ms, err := Manifests()
+	if err != nil {
+		return err
+	}
+
+	for n := range ms {
+		if strings.EqualFold(n.Filepath(), name.Filepath()) {
+			return errAliasIsModel
+		}
+	}
+
+	aliases, err := readAliases()
+	if err != nil {
+		return err
+	}
+
+	// retargeting aliases which point at name keeps them from pointing at
+	// an alias
+	for k, v := range aliases {
+		if v == name.String() {
+			aliases[k] = target.String()
+		}
+	}
+
+	aliases[name.String()] = target.String()
+	return writeAliases(aliases)
+}
+
+// DeleteAlias removes an alias. It reports false if name isn't an alias.
+func DeleteAlias(name model.Name) (bool, error) {
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	aliases, err := readAliases()
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := aliases[name.String()]; !ok {
+		return false, nil
+	}
+
+	delete(aliases, name.String())
+	return true, writeAliases(aliases)
+}
+
+// aliasesOf returns the aliases pointing at target.
+func aliasesOf(target model.Name) ([]model.Name, error) {
+	as, err := Aliases()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []model.Name
+	for _, a := range as {
+		if a.Target == target {
+			names = append(names, a.Name)
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestAliases(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+	for _, name := range []string{"test", "test2"} {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      name,
+			Modelfile: fmt.Sprintf("FROM %s\nSYSTEM %s", createBinFile(t, nil, nil), name),
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	alias := func(name, target string) int {
+		t.Helper()
+		return createRequest(t, s.AliasHandler, api.AliasRequest{Name: name, Target: target}).Code
+	}
+
+	aliases := func() []api.AliasResponse {
+		t.Helper()
+
+		w := createRequest(t, s.ListAliasesHandler, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.AliasesResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.Aliases
+	}
+
+	system := func(name string) string {
+		t.Helper()
+
+		m, err := GetModel(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return m.System
+	}
+
+	if code := alias("prod", "test"); code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", code)
+	}
+
+	if s := system("prod"); s != "test" {
+		t.Errorf("expected prod to resolve to test, got system %q", s)
+	}
+
+	m, err := ParseNamedManifest(model.ParseName("prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ParseNamedManifest(model.ParseName("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.digest != want.digest {
+		t.Errorf("expected prod manifest to be the manifest of test")
+	}
+
+	t.Run("list", func(t *testing.T) {
+		w := createRequest(t, s.ListModelsHandler, nil)
+
+		var resp api.ListResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		i := slices.IndexFunc(resp.Models, func(m api.ListModelResponse) bool { return m.Name == "prod:latest" })
+		if i < 0 {
+			t.Fatalf("expected prod in list, got %v", resp.Models)
+		}
+
+		if m := resp.Models[i]; m.Target != "test:latest" || m.Digest != want.digest {
+			t.Errorf("expected prod to point at test, got %+v", m)
+		}
+	})
+
+	t.Run("retarget", func(t *testing.T) {
+		if code := alias("prod", "test2"); code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", code)
+		}
+
+		if s := system("prod"); s != "test2" {
+			t.Errorf("expected prod to resolve to test2, got system %q", s)
+		}
+	})
+
+	t.Run("alias of alias", func(t *testing.T) {
+		if code := alias("staging", "prod"); code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", code)
+		}
+
+		want := []api.AliasResponse{
+			{Name: "prod:latest", Target: "test2:latest"},
+			{Name: "staging:latest", Target: "test2:latest"},
+		}
+
+		if got := aliases(); !slices.Equal(got, want) {
+			t.Errorf("expected aliases %v, got %v", want, got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if code := alias("test", "test2"); code != http.StatusBadRequest {
+			t.Errorf("expected an alias over a model to fail with 400, actual %d", code)
+		}
+
+		if code := alias("other", "missing"); code != http.StatusNotFound {
+			t.Errorf("expected an alias to a missing model to fail with 404, actual %d", code)
+		}
+
+		if code := alias("other", "other"); code != http.StatusBadRequest {
+			t.Errorf("expected an alias to itself to fail with 400, actual %d", code)
+		}
+	})
+
+	t.Run("delete target", func(t *testing.T) {
+		w := createRequest(t, s.DeleteModelHandler, api.DeleteRequest{Name: "test2"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.DeleteResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		var dangling []string
+		for _, a := range aliases() {
+			if !a.Missing {
+				t.Errorf("expected %s to be dangling", a.Name)
+			}
+
+			dangling = append(dangling, model.ParseName(a.Name).DisplayShortest())
+		}
+
+		if len(dangling) == 0 || !slices.Equal(dangling, resp.Aliases) {
+			t.Errorf("expected the delete response to list aliases %v, got %v", dangling, resp.Aliases)
+		}
+
+		if _, err := GetModel("prod"); err == nil {
+			t.Error("expected a dangling alias not to resolve")
+		}
+	})
+
+	t.Run("delete alias", func(t *testing.T) {
+		if code := alias("prod", "test"); code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", code)
+		}
+
+		if w := createRequest(t, s.DeleteModelHandler, api.DeleteRequest{Name: "prod"}); w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		if got := aliases(); len(got) != 1 || got[0].Name != "staging:latest" {
+			t.Errorf("expected only staging to be left, got %v", got)
+		}
+
+		if s := system("test"); s != "test" {
+			t.Errorf("expected deleting an alias to keep its target, got system %q", s)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"cmp"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -9,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -93,3 +95,106 @@ func getAuthorizationToken(ctx context.Context, challenge registryChallenge) (st
 
 	return token.Token, nil
 }
+
+// authenticate answers the authentication challenge of a registry, setting
+// the token or credentials to retry the request with in regOpts. Credentials
+// for host in the registry auth file are used for basic and standard bearer
+// token authentication. Without them, ollama.com's challenges are signed with
+// the local key and other registries are asked for an anonymous token. It
+// reports whether the signed challenge was answered anonymously.
+func authenticate(ctx context.Context, host, header string, regOpts *registryOptions) (anonymous bool, err error) {
+	creds, err := getRegistryCredentials(host)
+	if err != nil {
+		return false, err
+	}
+
+	scheme, _, _ := strings.Cut(header, " ")
+	challenge := parseRegistryChallenge(header)
+
+	switch {
+	case strings.EqualFold(scheme, "basic"):
+		if creds == nil {
+			return false, errUnauthorized
+		}
+
+		regOpts.Username, regOpts.Password = creds.Username, creds.Password
+	case creds != nil || !isOllamaHost(host):
+		regOpts.Token, err = getBearerToken(ctx, challenge, creds)
+		if err != nil {
+			return false, err
+		}
+	default:
+		regOpts.Token, err = getAuthorizationToken(ctx, challenge)
+		if err != nil {
+			return false, err
+		}
+
+		return getTokenSubject(regOpts.Token) == "anonymous", nil
+	}
+
+	return false, nil
+}
+
+// getBearerToken gets a token from the token server of a registry, see
+// https://distribution.github.io/distribution/spec/auth/token/
+func getBearerToken(ctx context.Context, challenge registryChallenge, creds *registryCredentials) (string, error) {
+	tokenURL, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return "", err
+	}
+
+	values := tokenURL.Query()
+	if challenge.Service != "" {
+		values.Add("service", challenge.Service)
+	}
+
+	for _, s := range strings.Fields(challenge.Scope) {
+		values.Add("scope", s)
+	}
+
+	tokenURL.RawQuery = values.Encode()
+
+	regOpts := &registryOptions{}
+	if creds != nil {
+		regOpts.Username, regOpts.Password = creds.Username, creds.Password
+	}
+
+	response, err := makeRequest(ctx, http.MethodGet, tokenURL, nil, nil, regOpts)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("%d: %v", response.StatusCode, err)
+	}
+
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return "", errUnauthorized
+	} else if response.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("%d: %s", response.StatusCode, body)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+
+	return cmp.Or(token.Token, token.AccessToken), nil
+}
+
+// isOllamaHost reports whether host is ollama.com's registry, which
+// authenticates with challenges signed by the local key.
+func isOllamaHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return host == DefaultRegistry || host == "ollama.com" ||
+		strings.HasSuffix(host, ".ollama.ai") || strings.HasSuffix(host, ".ollama.com")
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// registryCredentials are the credentials used to authenticate to a registry.
+type registryCredentials struct {
+	Username string
+	Password string
+}
+
+// dockerConfig is the part of a Docker config.json holding registry
+// credentials, as written by docker login.
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+type dockerAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// registryAuthPath returns the path of the Docker config.json to read
+// registry credentials from.
+func registryAuthPath() string {
+	if envconfig.RegistryAuth != "" {
+		return envconfig.RegistryAuth
+	}
+
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// getRegistryCredentials looks up the credentials for host in the registry
+// auth file, either stored inline or in a credential helper. It returns nil if
+// there are none.
+func getRegistryCredentials(host string) (*registryCredentials, error) {
+	p := registryAuthPath()
+	if p == "" {
+		return nil, nil
+	}
+
+	bts, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	if helper, ok := config.CredHelpers[host]; ok {
+		return credentialHelper(helper, host)
+	}
+
+	for key, auth := range config.Auths {
+		if registryHost(key) != host {
+			continue
+		}
+
+		if auth.Auth != "" {
+			bts, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid auth for %s: %w", p, key, err)
+			}
+
+			username, password, ok := strings.Cut(string(bts), ":")
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid auth for %s", p, key)
+			}
+
+			return &registryCredentials{Username: username, Password: password}, nil
+		} else if auth.Username != "" {
+			return &registryCredentials{Username: auth.Username, Password: auth.Password}, nil
+		}
+	}
+
+	if config.CredsStore != "" {
+		return credentialHelper(config.CredsStore, host)
+	}
+
+	return nil, nil
+}
+
+// registryHost returns the host of a key in the auths of a Docker config.json,
+// which may be a bare host or a URL.
+func registryHost(key string) string {
+	if _, rest, ok := strings.Cut(key, "://"); ok {
+		key = rest
+	}
+
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
+
+// credentialHelper gets the credentials for host from a Docker credential
+// helper, see https://github.com/docker/docker-credential-helpers
+func credentialHelper(helper, host string) (*registryCredentials, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("credential helper %s: %w: %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, fmt.Errorf("credential helper %s: %w", helper, err)
+	}
+
+	return &registryCredentials{Username: creds.Username, Password: creds.Secret}, nil
+}
+
+var registryClient struct {
+	sync.Mutex
+	ca     string
+	client *http.Client
+}
+
+// getRegistryClient returns the HTTP client for registry requests, which
+// trusts the CA certificates in OLLAMA_REGISTRY_CA besides the system ones.
+func getRegistryClient() (*http.Client, error) {
+	registryClient.Lock()
+	defer registryClient.Unlock()
+
+	if envconfig.RegistryCA == "" {
+		return http.DefaultClient, nil
+	} else if registryClient.client != nil && registryClient.ca == envconfig.RegistryCA {
+		return registryClient.client, nil
+	}
+
+	pem, err := os.ReadFile(envconfig.RegistryCA)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", envconfig.RegistryCA)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	registryClient.ca = envconfig.RegistryCA
+	registryClient.client = &http.Client{Transport: transport}
+	return registryClient.client, nil
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func writeRegistryAuth(t *testing.T, auths map[string]dockerAuth) {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), "config.json")
+	bts, err := json.Marshal(dockerConfig{Auths: auths})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, bts, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OLLAMA_REGISTRY_AUTH", p)
+}
+
+func TestGetRegistryCredentials(t *testing.T) {
+	writeRegistryAuth(t, map[string]dockerAuth{
+		"https://harbor.example.com": {Auth: base64.StdEncoding.EncodeToString([]byte("robot$ci:s3cr:et"))},
+		"zot.example.com:5000":       {Username: "alice", Password: "hunter2"},
+	})
+	envconfig.LoadConfig()
+
+	cases := []struct {
+		host   string
+		expect *registryCredentials
+	}{
+		{"harbor.example.com", &registryCredentials{Username: "robot$ci", Password: "s3cr:et"}},
+		{"zot.example.com:5000", &registryCredentials{Username: "alice", Password: "hunter2"}},
+		{"zot.example.com", nil},
+		{"registry.ollama.ai", nil},
+	}
+
+	for _, tt := range cases {
+		creds, err := getRegistryCredentials(tt.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (creds == nil) != (tt.expect == nil) || creds != nil && *creds != *tt.expect {
+			t.Errorf("%s: expected %+v, got %+v", tt.host, tt.expect, creds)
+		}
+	}
+}
+
+// testRegistry is a stand-in for an OCI registry which requires bearer tokens
+// issued for basic credentials and returns relative upload locations.
+type testRegistry struct {
+	*httptest.Server
+
+	// anonymous registries don't require a token
+	anonymous bool
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   map[string]*bytes.Buffer
+	requests  []*url.URL
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+
+	r := &testRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if username, password, ok := req.BasicAuth(); !ok || username != "robot" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"token": "t0k3n"})
+		return
+	}
+
+	if !r.anonymous && req.Header.Get("Authorization") != "Bearer t0k3n" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:library/test:pull,push"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req.URL)
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/library/test/")
+	switch {
+	case strings.HasPrefix(path, "manifests/"):
+		tag := strings.TrimPrefix(path, "manifests/")
+		if req.Method == http.MethodPut {
+			bts, _ := io.ReadAll(req.Body)
+			r.manifests[tag] = bts
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		bts, ok := r.manifests[tag]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Write(bts)
+	case path == "blobs/uploads/" && req.Method == http.MethodPost:
+		id := fmt.Sprintf("%d", len(r.uploads))
+		r.uploads[id] = &bytes.Buffer{}
+		w.Header().Set("Location", "/v2/library/test/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "blobs/uploads/"):
+		id := strings.TrimPrefix(path, "blobs/uploads/")
+		upload, ok := r.uploads[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		io.Copy(upload, req.Body)
+		if req.Method == http.MethodPut {
+			digest := req.URL.Query().Get("digest")
+			if fmt.Sprintf("sha256:%x", sha256.Sum256(upload.Bytes())) != digest {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			r.blobs[digest] = upload.Bytes()
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		w.Header().Set("Location", "/v2/library/test/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "blobs/"):
+		bts, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(bts))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// pushTestModel creates a model and pushes it to a new test registry, which
+// is trusted and has credentials configured.
+func pushTestModel(t *testing.T) (*testRegistry, model.Name, *Manifest) {
+	t.Helper()
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	r := newTestRegistry(t)
+	host := r.Listener.Addr().String()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OLLAMA_REGISTRY_CA", ca)
+	writeRegistryAuth(t, map[string]dockerAuth{
+		host: {Auth: base64.StdEncoding.EncodeToString([]byte("robot:secret"))},
+	})
+	envconfig.LoadConfig()
+
+	var s Server
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      host + "/library/test",
+		Modelfile: fmt.Sprintf("FROM %s\nSYSTEM hello", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	name := model.ParseName(host + "/library/test")
+	pushed, err := ParseNamedManifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PushModel(context.Background(), name.String(), &registryOptions{}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.blobs) != len(pushed.Layers)+1 {
+		t.Fatalf("expected %d blobs in the registry, got %d", len(pushed.Layers)+1, len(r.blobs))
+	}
+
+	return r, name, pushed
+}
+
+func TestPushPullRegistry(t *testing.T) {
+	_, name, pushed := pushTestModel(t)
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	fn := func(api.ProgressResponse) {}
+	if err := PullModel(context.Background(), name.String(), &registryOptions{}, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	pulled, err := ParseNamedManifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pulled.Config.Digest != pushed.Config.Digest || len(pulled.Layers) != len(pushed.Layers) {
+		t.Errorf("expected pulled manifest to match the pushed one")
+	}
+
+	// without credentials the token server refuses the request
+	writeRegistryAuth(t, nil)
+	envconfig.LoadConfig()
+
+	if err := PullModel(context.Background(), name.String(), &registryOptions{}, fn); err == nil {
+		t.Fatal("expected pull without credentials to fail")
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// DiffModels compares the layers, prompt settings, parameters and GGUF
+// metadata of two models.
+func DiffModels(from, to string) (*api.DiffResponse, error) {
+	fromManifest, fromModel, err := diffModel(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toManifest, toModel, err := diffModel(to)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := api.DiffResponse{Layers: diffLayers(fromManifest.Layers, toManifest.Layers), Changes: []api.FieldDiff{}}
+
+	diff := func(field, from, to string) {
+		if from != to {
+			resp.Changes = append(resp.Changes, api.FieldDiff{Field: field, From: from, To: to})
+		}
+	}
+
+	diff("template", fromModel.Template.String(), toModel.Template.String())
+	diff("system", fromModel.System, toModel.System)
+	diff("messages", formatMessages(fromModel.Messages), formatMessages(toModel.Messages))
+	diff("license", strings.Join(fromModel.License, "\n"), strings.Join(toModel.License, "\n"))
+
+	for _, k := range unionKeys(fromModel.Options, toModel.Options) {
+		diff("parameters."+k, formatDiffValue(fromModel.Options[k]), formatDiffValue(toModel.Options[k]))
+	}
+
+	// models with the same weights have the same metadata
+	if fromModel.ModelPath != toModel.ModelPath {
+		fromKV, err := getKVData(fromModel.ModelPath, true)
+		if err != nil {
+			return nil, err
+		}
+
+		toKV, err := getKVData(toModel.ModelPath, true)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range unionKeys(fromKV, toKV) {
+			diff("model_info."+k, formatDiffValue(fromKV[k]), formatDiffValue(toKV[k]))
+		}
+	}
+
+	return &resp, nil
+}
+
+func diffModel(name string) (*Manifest, *Model, error) {
+	n := model.ParseName(name)
+	if !n.IsValid() {
+		return nil, nil, fmt.Errorf("invalid model name: %s", name)
+	}
+
+	mf, err := ParseNamedManifest(n)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("model '%s' not found: %w", name, err)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := GetModel(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mf, m, nil
+}
+
+// diffLayers lists the layers of from which to shares or removes, followed by
+// the layers to adds, each in manifest order.
+func diffLayers(from, to []*Layer) []api.LayerDiff {
+	has := func(layers []*Layer, digest string) bool {
+		return slices.ContainsFunc(layers, func(l *Layer) bool { return l.Digest == digest })
+	}
+
+	layers := []api.LayerDiff{}
+	for _, l := range from {
+		status := "removed"
+		if has(to, l.Digest) {
+			status = "shared"
+		}
+
+		layers = append(layers, api.LayerDiff{MediaType: l.MediaType, Digest: l.Digest, Size: l.Size, Status: status})
+	}
+
+	for _, l := range to {
+		if !has(from, l.Digest) {
+			layers = append(layers, api.LayerDiff{MediaType: l.MediaType, Digest: l.Digest, Size: l.Size, Status: "added"})
+		}
+	}
+
+	return layers
+}
+
+func formatMessages(msgs []Message) string {
+	var sb strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&sb, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	return sb.String()
+}
+
+// formatDiffValue formats a parameter or metadata value as text, one line for
+// each element of short arrays. Long arrays, such as a tokenizer's tokens,
+// are summarized by their length and digest.
+func formatDiffValue(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Sprintf("%v", v)
+	}
+
+	if rv.Len() > 5 {
+		bts, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("[%d values]", rv.Len())
+		}
+
+		sum := sha256.Sum256(bts)
+		return fmt.Sprintf("[%d values, sha256:%x]", rv.Len(), sum[:6])
+	}
+
+	var lines []string
+	for i := range rv.Len() {
+		lines = append(lines, fmt.Sprintf("%v", rv.Index(i).Interface()))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// unionKeys returns the keys of a and b, sorted.
+func unionKeys[V any](a, b map[string]V) []string {
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for k := range m {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestDiffModels(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	for _, m := range []struct{ name, modelfile string }{
+		{"v1", fmt.Sprintf("FROM %s\nTEMPLATE \"{{ .System }}\n{{ .Prompt }}\"\nSYSTEM hello\nPARAMETER temperature 0.5\nPARAMETER stop <|end|>",
+			createBinFile(t, llm.KV{"general.architecture": "llama", "llama.context_length": uint32(2048)}, nil))},
+		{"v2", "FROM v1\nTEMPLATE \"{{ .System }}\n{{ .Prompt }}\n\"\nPARAMETER temperature 0.7\nPARAMETER num_ctx 4096\nMESSAGE user hi"},
+		{"v3", fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{"general.architecture": "llama", "llama.context_length": uint32(4096)}, nil))},
+	} {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      m.name,
+			Modelfile: m.modelfile,
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+		}
+	}
+
+	resp, err := DiffModels("v1", "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []string
+	for _, layer := range resp.Layers {
+		statuses = append(statuses, layer.MediaType[len("application/vnd.ollama.image."):]+" "+layer.Status)
+	}
+
+	if diff := cmp.Diff([]string{
+		"model shared",
+		"template removed",
+		"system shared",
+		"params removed",
+		"template added",
+		"messages added",
+		"params added",
+	}, statuses); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]api.FieldDiff{
+		{Field: "template", From: "{{ .System }}\n{{ .Prompt }}", To: "{{ .System }}\n{{ .Prompt }}\n"},
+		{Field: "messages", To: "user: hi\n"},
+		{Field: "parameters.num_ctx", To: "4096"},
+		{Field: "parameters.temperature", From: "0.5", To: "0.7"},
+	}, resp.Changes); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	resp, err = DiffModels("v2", "v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields []string
+	for _, change := range resp.Changes {
+		fields = append(fields, change.Field)
+	}
+
+	if diff := cmp.Diff([]string{
+		"template",
+		"system",
+		"messages",
+		"parameters.num_ctx",
+		"parameters.stop",
+		"parameters.temperature",
+		"model_info.llama.context_length",
+	}, fields); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := DiffModels("v1", "missing"); err == nil {
+		t.Fatal("expected an error for a missing model")
+	}
+}
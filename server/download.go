@@ -41,6 +41,15 @@ type blobDownload struct {
 
 	Parts []*blobDownloadPart
 
+	// limiter limits the rate of this download, in addition to the rate of
+	// all downloads
+	limiter *rateLimiter
+
+	// fallback is the registry the blob is downloaded from when it's
+	// downloaded from a mirror which fails
+	fallback     *url.URL
+	fallbackOpts *registryOptions
+
 	context.CancelFunc
 
 	done       bool
@@ -78,11 +87,29 @@ func (p *blobDownloadPart) StopsAt() int64 {
 	return p.Offset + p.Size
 }
 
-func (p *blobDownloadPart) Write(b []byte) (n int, err error) {
-	n = len(b)
-	p.blobDownload.Completed.Add(int64(n))
-	p.lastUpdated = time.Now()
-	return n, nil
+// partWriter writes the downloaded bytes of a part and records its progress.
+// The part file is saved at most once a second so a download interrupted by
+// a restart resumes close to where it stopped.
+type partWriter struct {
+	w     io.Writer
+	part  *blobDownloadPart
+	saved time.Time
+}
+
+func (w *partWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+
+	part := w.part
+	part.Completed += int64(n)
+	part.blobDownload.Completed.Add(int64(n))
+	part.lastUpdated = time.Now()
+
+	if err == nil && time.Since(w.saved) > time.Second {
+		w.saved = time.Now()
+		err = part.writePart(part.Name(), part)
+	}
+
+	return n, err
 }
 
 func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *registryOptions) error {
@@ -138,11 +165,19 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *r
 }
 
 func (b *blobDownload) Run(ctx context.Context, requestURL *url.URL, opts *registryOptions) {
-	b.err = b.run(ctx, requestURL, opts)
+	defer blobDownloadManager.Delete(b.Name)
+
+	err := b.run(ctx, requestURL, opts)
+	if err != nil && b.fallback != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, syscall.ENOSPC) {
+		// the parts the mirror completed are kept
+		slog.Info("registry mirror failed, downloading from the registry", "digest", b.Digest, "error", err)
+		err = b.run(ctx, b.fallback, b.fallbackOpts)
+	}
+
+	b.err = err
 }
 
 func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *registryOptions) error {
-	defer blobDownloadManager.Delete(b.Digest)
 	ctx, b.CancelFunc = context.WithCancel(ctx)
 
 	file, err := os.OpenFile(b.Name+"-partial", os.O_CREATE|os.O_RDWR, 0o644)
@@ -154,7 +189,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 	_ = file.Truncate(b.Total)
 
 	g, inner := errgroup.WithContext(ctx)
-	g.SetLimit(numDownloadParts)
+	g.SetLimit(transferParts(numDownloadParts))
 	for i := range b.Parts {
 		part := b.Parts[i]
 		if part.Completed == part.Size {
@@ -167,8 +202,9 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 				w := io.NewOffsetWriter(file, part.StartsAt())
 				err = b.downloadChunk(inner, requestURL, w, part, opts)
 				switch {
-				case errors.Is(err, context.Canceled), errors.Is(err, syscall.ENOSPC):
-					// return immediately if the context is canceled or the device is out of space
+				case errors.Is(err, context.Canceled), errors.Is(err, syscall.ENOSPC), errors.Is(err, os.ErrNotExist):
+					// return immediately if the context is canceled, the device is out of space
+					// or the blob is gone
 					return err
 				case errors.Is(err, errPartStalled):
 					try--
@@ -221,19 +257,21 @@ func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w
 		}
 		defer resp.Body.Close()
 
-		n, err := io.CopyN(w, io.TeeReader(resp.Body, part), part.Size-part.Completed)
-		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, io.ErrUnexpectedEOF) {
-			// rollback progress
-			b.Completed.Add(-n)
-			return err
+		body := &throttledReader{
+			ctx:      ctx,
+			r:        resp.Body,
+			limiters: []*rateLimiter{downloadLimiter, b.limiter},
+			// a throttled part isn't stalled
+			onWait: func(t time.Time) { part.lastUpdated = t },
 		}
 
-		part.Completed += n
+		// bytes written before an error are kept, the next attempt resumes
+		// after them
+		_, err = io.CopyN(&partWriter{w: w, part: part}, body, part.Size-part.Completed)
 		if err := b.writePart(part.Name(), part); err != nil {
 			return err
 		}
 
-		// return nil or context.Canceled or UnexpectedEOF (resumable)
 		return err
 	})
 
@@ -337,43 +375,67 @@ type downloadOpts struct {
 	digest  string
 	regOpts *registryOptions
 	fn      func(api.ProgressResponse)
+
+	// name is the file the blob is downloaded to instead of the blobs
+	// directory. An existing blob is not treated as a cache hit.
+	name string
 }
 
 // downloadBlob downloads a blob from the registry and stores it in the blobs directory
 func downloadBlob(ctx context.Context, opts downloadOpts) (cacheHit bool, _ error) {
-	fp, err := GetBlobsPath(opts.digest)
-	if err != nil {
-		return false, err
-	}
+	fp := opts.name
+	if fp == "" {
+		var err error
+		fp, err = GetBlobsPath(opts.digest)
+		if err != nil {
+			return false, err
+		}
 
-	fi, err := os.Stat(fp)
-	switch {
-	case errors.Is(err, os.ErrNotExist):
-	case err != nil:
-		return false, err
-	default:
-		opts.fn(api.ProgressResponse{
-			Status:    fmt.Sprintf("pulling %s", opts.digest[7:19]),
-			Digest:    opts.digest,
-			Total:     fi.Size(),
-			Completed: fi.Size(),
-		})
+		fi, err := os.Stat(fp)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return false, err
+		default:
+			opts.fn(api.ProgressResponse{
+				Status:    fmt.Sprintf("pulling %s", opts.digest[7:19]),
+				Digest:    opts.digest,
+				Total:     fi.Size(),
+				Completed: fi.Size(),
+			})
 
-		return true, nil
+			return true, nil
+		}
 	}
 
-	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest})
+	// downloads are shared by the file they're written to, a repair doesn't
+	// join a pull of the same blob or the other way round
+	data, ok := blobDownloadManager.LoadOrStore(fp, &blobDownload{Name: fp, Digest: opts.digest, limiter: newRateLimiter(opts.regOpts.MaxRate)})
 	download := data.(*blobDownload)
-	if !ok {
-		requestURL := opts.mp.BaseURL()
-		requestURL = requestURL.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest)
-		if err := download.Prepare(ctx, requestURL, opts.regOpts); err != nil {
-			blobDownloadManager.Delete(opts.digest)
+	if ok {
+		// a request joining a download in progress can only slow it down
+		download.limiter.lower(opts.regOpts.MaxRate)
+	} else {
+		requestURL, regOpts := blobURL(ctx, opts.mp, opts.digest, opts.regOpts)
+		if origin := registryBlobURL(opts.mp, opts.digest); requestURL.String() != origin.String() {
+			download.fallback, download.fallbackOpts = origin, opts.regOpts
+		}
+
+		err := download.Prepare(ctx, requestURL, regOpts)
+		if err != nil && download.fallback != nil && len(download.Parts) == 0 {
+			slog.Info("registry mirror failed, downloading from the registry", "digest", opts.digest, "error", err)
+			requestURL, regOpts = download.fallback, download.fallbackOpts
+			download.fallback = nil
+			err = download.Prepare(ctx, requestURL, regOpts)
+		}
+
+		if err != nil {
+			blobDownloadManager.Delete(fp)
 			return false, err
 		}
 
 		//nolint:contextcheck
-		go download.Run(context.Background(), requestURL, opts.regOpts)
+		go download.Run(context.Background(), requestURL, regOpts)
 	}
 
 	return false, download.Wait(ctx, opts.fn)
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+// gcGracePeriod is how long a blob is kept after it was written before it is
+// collected, so blobs of pulls and creates in progress aren't removed before
+// their manifest is written.
+const gcGracePeriod = time.Hour
+
+// partialExpiry is how long a partial download is kept after it was last
+// written to before it is collected. Pulling the blob again within it
+// resumes the download.
+const partialExpiry = 7 * 24 * time.Hour
+
+// blobRefs returns the models referencing each blob, sorted by name, and the
+// size of each blob.
+func blobRefs(manifests map[model.Name]*Manifest) (map[string][]model.Name, map[string]int64) {
+	refs := make(map[string][]model.Name)
+	sizes := make(map[string]int64)
+	for n, m := range manifests {
+		for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+			if !slices.Contains(refs[layer.Digest], n) {
+				refs[layer.Digest] = append(refs[layer.Digest], n)
+			}
+
+			sizes[layer.Digest] = layer.Size
+		}
+	}
+
+	for _, names := range refs {
+		slices.SortFunc(names, func(a, b model.Name) int {
+			return cmp.Compare(a.DisplayShortest(), b.DisplayShortest())
+		})
+	}
+
+	return refs, sizes
+}
+
+// CollectGarbage removes the blobs which no model references and returns
+// them. With dryRun nothing is removed. Blobs written within gcGracePeriod are
+// kept. Nothing is removed if any manifest can't be read, as the blobs it
+// references would be.
+func CollectGarbage(dryRun bool) (*api.GCResponse, error) {
+	ms, err := readManifests(true)
+	if err != nil {
+		return nil, fmt.Errorf("not collecting garbage: %w", err)
+	}
+
+	refs, _ := blobRefs(ms)
+	orphaned, err := orphanedBlobs(refs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := api.GCResponse{Blobs: []api.BlobInfo{}}
+	for _, blob := range orphaned {
+		p, err := GetBlobsPath(blob.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if time.Since(fi.ModTime()) < gcGracePeriod {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(p); err != nil {
+				return nil, err
+			}
+
+			if err := llm.RemovePromptCache(blob.Digest); err != nil {
+				slog.Info(fmt.Sprintf("couldn't remove prompt cache for '%s': %v", blob.Digest, err))
+			}
+		}
+
+		resp.Blobs = append(resp.Blobs, blob)
+		resp.Size += blob.Size
+	}
+
+	partials, err := expiredPartials()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, partial := range partials {
+		if !dryRun {
+			for _, p := range partial.files {
+				if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return nil, err
+				}
+			}
+		}
+
+		resp.Blobs = append(resp.Blobs, partial.BlobInfo)
+		resp.Size += partial.Size
+	}
+
+	return &resp, nil
+}
+
+type partialDownload struct {
+	api.BlobInfo
+	files []string
+}
+
+// expiredPartials returns the partial downloads which haven't been written to
+// within partialExpiry and aren't in progress.
+func expiredPartials() ([]partialDownload, error) {
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(blobs, "*-partial*"))
+	if err != nil {
+		return nil, err
+	}
+
+	partials := make(map[string]*partialDownload)
+	modified := make(map[string]time.Time)
+	inProgress := make(map[string]bool)
+	for _, p := range files {
+		name, _, _ := strings.Cut(filepath.Base(p), "-partial")
+
+		// repairs and imports are written next to the blob they're for
+		digest := strings.TrimSuffix(strings.TrimSuffix(name, "-repair"), "-import")
+		digest = strings.Replace(digest, "-", ":", 1)
+		if _, err := GetBlobsPath(digest); err != nil {
+			continue
+		}
+
+		// downloads in progress are keyed by the file they're written to
+		if _, ok := blobDownloadManager.Load(filepath.Join(blobs, name)); ok {
+			inProgress[digest] = true
+		}
+
+		fi, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		partial, ok := partials[digest]
+		if !ok {
+			partial = &partialDownload{BlobInfo: api.BlobInfo{Digest: digest, Partial: true}}
+			partials[digest] = partial
+		}
+
+		partial.Size += fi.Size()
+		partial.files = append(partial.files, p)
+		if fi.ModTime().After(modified[digest]) {
+			modified[digest] = fi.ModTime()
+		}
+	}
+
+	var expired []partialDownload
+	for digest, partial := range partials {
+		if inProgress[digest] || time.Since(modified[digest]) < partialExpiry {
+			continue
+		}
+
+		expired = append(expired, *partial)
+	}
+
+	slices.SortFunc(expired, func(a, b partialDownload) int {
+		return cmp.Compare(a.Digest, b.Digest)
+	})
+
+	return expired, nil
+}
+
+// DiskUsage reports the size of each model, split in the bytes of blobs only
+// it uses, which deleting it frees, and of blobs shared with other models.
+func DiskUsage() (*api.DiskUsageResponse, error) {
+	ms, err := Manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	refs, sizes := blobRefs(ms)
+
+	resp := api.DiskUsageResponse{Models: []api.ModelDiskUsage{}}
+	for n, m := range ms {
+		usage := api.ModelDiskUsage{
+			Name:  n.DisplayShortest(),
+			Model: n.DisplayShortest(),
+		}
+
+		seen := make(map[string]bool)
+		for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+			if seen[layer.Digest] {
+				continue
+			}
+
+			seen[layer.Digest] = true
+
+			usage.Size += layer.Size
+			if len(refs[layer.Digest]) > 1 {
+				usage.Shared += layer.Size
+			} else {
+				usage.Unique += layer.Size
+			}
+		}
+
+		resp.Models = append(resp.Models, usage)
+	}
+
+	slices.SortFunc(resp.Models, func(a, b api.ModelDiskUsage) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	for _, size := range sizes {
+		resp.Size += size
+	}
+
+	orphaned, err := orphanedBlobs(refs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blob := range orphaned {
+		resp.Reclaimable += blob.Size
+	}
+
+	partials, err := expiredPartials()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, partial := range partials {
+		resp.Reclaimable += partial.Size
+	}
+
+	return &resp, nil
+}
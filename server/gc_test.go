@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test2",
+		Modelfile: "FROM test\nSYSTEM hello",
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	old, err := NewLayer(bytes.NewReader([]byte("old")), "application/vnd.ollama.image.system")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := GetBlobsPath(old.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(p, time.Time{}, time.Now().Add(-2*gcGracePeriod)); err != nil {
+		t.Fatal(err)
+	}
+
+	// recent blobs may belong to a pull or create in progress
+	recent, err := NewLayer(bytes.NewReader([]byte("recent")), "application/vnd.ollama.image.system")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := func(name string) *Manifest {
+		m, err := ParseNamedManifest(model.ParseName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return m
+	}
+
+	t.Run("du", func(t *testing.T) {
+		m1, m2 := manifest("test"), manifest("test2")
+
+		var system int64
+		for _, layer := range m2.Layers {
+			if layer.MediaType == "application/vnd.ollama.image.system" {
+				system = layer.Size
+			}
+		}
+
+		// the models share the model layer but not their configs
+		shared := m1.Size() - m1.Config.Size
+
+		resp, err := DiskUsage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := &api.DiskUsageResponse{
+			Models: []api.ModelDiskUsage{
+				{Name: "test2:latest", Model: "test2:latest", Size: m2.Size(), Unique: m2.Config.Size + system, Shared: shared},
+				{Name: "test:latest", Model: "test:latest", Size: m1.Size(), Unique: m1.Config.Size, Shared: shared},
+			},
+			Size:        shared + m1.Config.Size + m2.Config.Size + system,
+			Reclaimable: old.Size + recent.Size,
+		}
+
+		if diff := cmp.Diff(expect, resp); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		resp, err := CollectGarbage(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Blobs) != 1 || resp.Blobs[0].Digest != old.Digest || resp.Size != old.Size {
+			t.Fatalf("expected %s to be collected, got %+v", old.Digest, resp)
+		}
+
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected blob to be kept, got %v", err)
+		}
+	})
+
+	t.Run("gc", func(t *testing.T) {
+		resp, err := CollectGarbage(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Blobs) != 1 || resp.Blobs[0].Digest != old.Digest {
+			t.Fatalf("expected %s to be collected, got %+v", old.Digest, resp)
+		}
+
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected blob to be removed, got %v", err)
+		}
+
+		for _, layer := range append([]*Layer{recent}, manifest("test2").Layers...) {
+			if err := verifyBlob(layer.Digest); err != nil {
+				t.Errorf("%s: %v", layer.Digest, err)
+			}
+		}
+	})
+
+	t.Run("partial downloads", func(t *testing.T) {
+		blobs, err := GetBlobsPath("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		partial := func(digest string, modified time.Time, suffixes ...string) []string {
+			if len(suffixes) == 0 {
+				suffixes = []string{"-partial", "-partial-0"}
+			}
+
+			var files []string
+			for _, suffix := range suffixes {
+				p := filepath.Join(blobs, strings.Replace(digest, ":", "-", 1)+suffix)
+				if err := os.WriteFile(p, []byte("part"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.Chtimes(p, time.Time{}, modified); err != nil {
+					t.Fatal(err)
+				}
+
+				files = append(files, p)
+			}
+
+			return files
+		}
+
+		abandoned := "sha256:" + strings.Repeat("a", 64)
+		abandonedFiles := partial(abandoned, time.Now().Add(-2*partialExpiry))
+		// repairs and imports are counted for the blob they're for
+		abandonedRepair := "sha256:" + strings.Repeat("d", 64)
+		abandonedFiles = append(abandonedFiles, partial(abandonedRepair, time.Now().Add(-2*partialExpiry), "-repair-partial", "-import-partial-123")...)
+		// recent partial downloads can be resumed
+		resumable := partial("sha256:"+strings.Repeat("b", 64), time.Now())
+		// downloads in progress are keyed by the file they're written to
+		running := "sha256:" + strings.Repeat("c", 64)
+		resumable = append(resumable, partial(running, time.Now().Add(-2*partialExpiry))...)
+		target := filepath.Join(blobs, strings.Replace(running, ":", "-", 1))
+		blobDownloadManager.Store(target, &blobDownload{Name: target, Digest: running})
+		t.Cleanup(func() { blobDownloadManager.Delete(target) })
+
+		resp, err := CollectGarbage(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := &api.GCResponse{Blobs: []api.BlobInfo{
+			{Digest: abandoned, Size: 8, Partial: true},
+			{Digest: abandonedRepair, Size: 8, Partial: true},
+		}, Size: 16}
+		if diff := cmp.Diff(expect, resp); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+
+		for _, p := range abandonedFiles {
+			if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected %s to be removed, got %v", p, err)
+			}
+		}
+
+		for _, p := range resumable {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("expected %s to be kept, got %v", p, err)
+			}
+		}
+	})
+	t.Run("corrupt manifest", func(t *testing.T) {
+		manifests, err := GetManifestPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := manifest("test2")
+		for _, layer := range m.Layers {
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Chtimes(p, time.Time{}, time.Now().Add(-2*gcGracePeriod)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := os.WriteFile(filepath.Join(manifests, model.ParseName("test2").Filepath()), []byte("{"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// the blobs only the corrupt manifest references are kept
+		if _, err := CollectGarbage(false); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		for _, layer := range m.Layers {
+			if err := verifyBlob(layer.Digest); err != nil {
+				t.Errorf("%s: %v", layer.Digest, err)
+			}
+		}
+	})
+}
@@ -45,6 +45,13 @@ type registryOptions struct {
 	Username string
 	Password string
 	Token    string
+
+	// Sign pushes a signature of the manifest with a push
+	Sign bool
+
+	// MaxRate limits the rate of transfers made with these options in bytes
+	// per second, 0 for no limit
+	MaxRate int64
 }
 
 type Model struct {
@@ -54,7 +61,9 @@ type Model struct {
 	ModelPath      string
 	ParentModel    string
 	AdapterPaths   []string
+	Adapters       []Adapter
 	ProjectorPaths []string
+	DraftPath      string
 	System         string
 	License        []string
 	Digest         string
@@ -64,6 +73,52 @@ type Model struct {
 	Template *template.Template
 }
 
+// Adapter is a LoRA adapter layer of a model. Unnamed adapters always apply,
+// named adapters apply by default but can be selected per request.
+type Adapter struct {
+	Name  string
+	Path  string
+	Scale float32
+}
+
+// adapterConfig records the name and default scale of an adapter layer. It is
+// stored in the adapters layer for every adapter declared with either.
+type adapterConfig struct {
+	Digest string  `json:"digest"`
+	Name   string  `json:"name,omitempty"`
+	Scale  float32 `json:"scale,omitempty"`
+}
+
+var errUnknownAdapter = errors.New("unknown adapter")
+
+// ActiveAdapters returns the adapters to apply for a request selecting the
+// named adapters in selected. A nil selection applies every adapter at its
+// default scale and a selected scale of 0 keeps the adapter's default.
+func (m *Model) ActiveAdapters(selected map[string]float32) ([]llm.Adapter, error) {
+	for name := range selected {
+		if !slices.ContainsFunc(m.Adapters, func(a Adapter) bool { return a.Name == name }) {
+			return nil, fmt.Errorf("%w %q", errUnknownAdapter, name)
+		}
+	}
+
+	var adapters []llm.Adapter
+	for _, a := range m.Adapters {
+		scale := a.Scale
+		if a.Name != "" && selected != nil {
+			s, ok := selected[a.Name]
+			if !ok {
+				continue
+			} else if s != 0 {
+				scale = s
+			}
+		}
+
+		adapters = append(adapters, llm.Adapter{Path: a.Path, Scale: scale})
+	}
+
+	return adapters, nil
+}
+
 // CheckCapabilities checks if the model has the specified capabilities returning an error describing
 // any missing or unknown capabilities
 func (m *Model) CheckCapabilities(caps ...Capability) error {
@@ -102,6 +157,11 @@ func (m *Model) CheckCapabilities(caps ...Capability) error {
 }
 
 func (m *Model) String() string {
+	return m.modelfile().String()
+}
+
+// modelfile returns the Modelfile commands which create m.
+func (m *Model) modelfile() parser.File {
 	var modelfile parser.File
 
 	modelfile.Commands = append(modelfile.Commands, parser.Command{
@@ -109,10 +169,10 @@ func (m *Model) String() string {
 		Args: m.ModelPath,
 	})
 
-	for _, adapter := range m.AdapterPaths {
+	for _, adapter := range m.Adapters {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "adapter",
-			Args: adapter,
+			Args: parser.FormatAdapter(api.AdapterSpec{From: adapter.Path, Name: adapter.Name, Scale: adapter.Scale}),
 		})
 	}
 
@@ -123,6 +183,13 @@ func (m *Model) String() string {
 		})
 	}
 
+	if m.DraftPath != "" {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "draft",
+			Args: m.DraftPath,
+		})
+	}
+
 	if m.Template != nil {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "template",
@@ -164,11 +231,11 @@ func (m *Model) String() string {
 	for _, msg := range m.Messages {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "message",
-			Args: fmt.Sprintf("%s %s", msg.Role, msg.Content),
+			Args: fmt.Sprintf("%s: %s", msg.Role, msg.Content),
 		})
 	}
 
-	return modelfile.String()
+	return modelfile
 }
 
 type Message struct {
@@ -222,6 +289,10 @@ func GetManifest(mp ModelPath) (*Manifest, string, error) {
 }
 
 func GetModel(name string) (*Model, error) {
+	if target, ok := resolveAlias(model.ParseName(name)); ok {
+		name = target.String()
+	}
+
 	mp := ParseModelPath(name)
 	manifest, digest, err := GetManifest(mp)
 	if err != nil {
@@ -250,6 +321,7 @@ func GetModel(name string) (*Model, error) {
 		return nil, err
 	}
 
+	var adapters []adapterConfig
 	for _, layer := range manifest.Layers {
 		filename, err := GetBlobsPath(layer.Digest)
 		if err != nil {
@@ -266,8 +338,19 @@ func GetModel(name string) (*Model, error) {
 			slog.Info("WARNING: model contains embeddings, but embeddings in modelfiles have been deprecated and will be ignored.")
 		case "application/vnd.ollama.image.adapter":
 			model.AdapterPaths = append(model.AdapterPaths, filename)
+		case "application/vnd.ollama.image.adapters":
+			bts, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := json.Unmarshal(bts, &adapters); err != nil {
+				return nil, err
+			}
 		case "application/vnd.ollama.image.projector":
 			model.ProjectorPaths = append(model.ProjectorPaths, filename)
+		case "application/vnd.ollama.image.draft":
+			model.DraftPath = filename
 		case "application/vnd.ollama.image.prompt",
 			"application/vnd.ollama.image.template":
 			bts, err := os.ReadFile(filename)
@@ -316,6 +399,20 @@ func GetModel(name string) (*Model, error) {
 		}
 	}
 
+	for _, path := range model.AdapterPaths {
+		adapter := Adapter{Path: path, Scale: 1}
+		for _, config := range adapters {
+			if p, err := GetBlobsPath(config.Digest); err == nil && p == path {
+				adapter.Name = config.Name
+				if config.Scale != 0 {
+					adapter.Scale = config.Scale
+				}
+			}
+		}
+
+		model.Adapters = append(model.Adapters, adapter)
+	}
+
 	return model, nil
 }
 
@@ -354,6 +451,7 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 	}
 
 	var messages []*api.Message
+	var adapters []adapterConfig
 	parameters := make(map[string]any)
 
 	var layers []*Layer
@@ -362,14 +460,23 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 
 		switch c.Name {
 		case "model", "adapter":
+			from := c.Args
+			var adapter adapterConfig
+			if c.Name == "adapter" {
+				from, adapter, err = parseAdapter(c.Args)
+				if err != nil {
+					return err
+				}
+			}
+
 			var baseLayers []*layerGGML
-			if name := model.ParseName(c.Args); name.IsValid() {
+			if name := model.ParseName(from); name.IsValid() {
 				baseLayers, err = parseFromModel(ctx, name, fn)
 				if err != nil {
 					return err
 				}
-			} else if strings.HasPrefix(c.Args, "@") {
-				digest := strings.TrimPrefix(c.Args, "@")
+			} else if strings.HasPrefix(from, "@") {
+				digest := strings.TrimPrefix(from, "@")
 				if ib, ok := intermediateBlobs[digest]; ok {
 					p, err := GetBlobsPath(ib)
 					if err != nil {
@@ -401,7 +508,7 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 				if err != nil {
 					return err
 				}
-			} else if file, err := os.Open(realpath(modelFileDir, c.Args)); err == nil {
+			} else if file, err := os.Open(realpath(modelFileDir, from)); err == nil {
 				defer file.Close()
 
 				baseLayers, err = parseFromFile(ctx, file, "", fn)
@@ -409,7 +516,7 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 					return err
 				}
 			} else {
-				return fmt.Errorf("invalid model reference: %s", c.Args)
+				return fmt.Errorf("invalid model reference: %s", from)
 			}
 
 			for _, baseLayer := range baseLayers {
@@ -471,8 +578,32 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 					config.ModelFamilies = append(config.ModelFamilies, baseLayer.GGML.KV().Architecture())
 				}
 
+				if baseLayer.MediaType == "application/vnd.ollama.image.adapter" {
+					if adapter.Name != "" || adapter.Scale != 0 {
+						adapter.Digest = baseLayer.Digest
+						adapters = append(adapters, adapter)
+					}
+
+					// an inherited adapter declared again only changes its name or scale
+					if slices.ContainsFunc(layers, func(layer *Layer) bool { return layer.Digest == baseLayer.Digest }) {
+						continue
+					}
+				}
+
 				layers = append(layers, baseLayer.Layer)
 			}
+		case "draft":
+			draft, err := parseDraft(ctx, modelFileDir, c.Args, fn)
+			if err != nil {
+				return err
+			}
+
+			// replace any inherited draft, its blob may still be referenced by the draft model itself
+			layers = slices.DeleteFunc(layers, func(layer *Layer) bool {
+				return layer.MediaType == mediatype
+			})
+
+			layers = append(layers, draft.Layer)
 		case "license", "template", "system":
 			if c.Name != "license" {
 				// replace
@@ -552,6 +683,27 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 				}
 			}
 
+			return true
+		case "application/vnd.ollama.image.adapters":
+			// merge inherited adapter names and scales with new ones
+			r, err := layer.Open()
+			if err != nil {
+				err2 = err
+				return false
+			}
+			defer r.Close()
+
+			var inherited []adapterConfig
+			if err := json.NewDecoder(r).Decode(&inherited); err != nil {
+				err2 = err
+				return false
+			}
+
+			inherited = slices.DeleteFunc(inherited, func(a adapterConfig) bool {
+				return slices.ContainsFunc(adapters, func(b adapterConfig) bool { return a.Digest == b.Digest })
+			})
+
+			adapters = append(inherited, adapters...)
 			return true
 		default:
 			return false
@@ -562,6 +714,20 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 		return err2
 	}
 
+	// named templates declare the stop sequences which end responses
+	var paramsStatus string
+	if _, ok := parameters["stop"]; !ok {
+		s, err := templateText(layers)
+		if err != nil {
+			return err
+		}
+
+		if t, ok := template.Lookup(s); ok && len(t.Stop) > 0 {
+			parameters["stop"] = t.Stop
+			paramsStatus = fmt.Sprintf("using stop sequences of template %s", t.Name)
+		}
+	}
+
 	if len(messages) > 0 {
 		var b bytes.Buffer
 		if err := json.NewEncoder(&b).Encode(messages); err != nil {
@@ -576,6 +742,31 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 		layers = append(layers, layer)
 	}
 
+	if len(adapters) > 0 {
+		names := make(map[string]bool)
+		for _, a := range adapters {
+			if a.Name == "" {
+				continue
+			} else if names[a.Name] {
+				return fmt.Errorf("duplicate adapter name: %s", a.Name)
+			}
+
+			names[a.Name] = true
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(adapters); err != nil {
+			return err
+		}
+
+		layer, err := NewLayer(&b, "application/vnd.ollama.image.adapters")
+		if err != nil {
+			return err
+		}
+
+		layers = append(layers, layer)
+	}
+
 	if len(parameters) > 0 {
 		var b bytes.Buffer
 		if err := json.NewEncoder(&b).Encode(parameters); err != nil {
@@ -587,6 +778,7 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 			return err
 		}
 
+		layer.status = paramsStatus
 		layers = append(layers, layer)
 	}
 
@@ -615,6 +807,12 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 
 	old, _ := ParseNamedManifest(name)
 
+	release, err := makeRoom(name, &Manifest{Config: layer, Layers: layers}, fn)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	fn(api.ProgressResponse{Status: "writing manifest"})
 	if err := WriteManifest(name, layer, layers); err != nil {
 		return err
@@ -720,6 +918,10 @@ func deleteUnusedLayers(skipModelPath *ModelPath, deleteMap map[string]struct{})
 			slog.Info(fmt.Sprintf("couldn't remove file '%s': %v", fp, err))
 			continue
 		}
+
+		if err := llm.RemovePromptCache(k); err != nil {
+			slog.Info(fmt.Sprintf("couldn't remove prompt cache for '%s': %v", k, err))
+		}
 	}
 
 	return nil
@@ -740,6 +942,11 @@ func PruneLayers() error {
 
 	for _, blob := range blobs {
 		name := blob.Name()
+		if strings.Contains(name, "-partial") {
+			// keep partial downloads so they can be resumed
+			continue
+		}
+
 		name = strings.ReplaceAll(name, "-", ":")
 
 		_, err := GetBlobsPath(name)
@@ -844,6 +1051,12 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	}
 	defer resp.Body.Close()
 
+	if regOpts.Sign {
+		if err := pushManifestSignature(ctx, mp, manifestJSON, headers.Get("Content-Type"), regOpts, fn); err != nil {
+			return err
+		}
+	}
+
 	fn(api.ProgressResponse{Status: "success"})
 
 	return nil
@@ -884,6 +1097,16 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return fmt.Errorf("pull model manifest: %s", err)
 	}
 
+	if err := checkManifestSignature(ctx, mp, manifest, regOpts, fn); err != nil {
+		return err
+	}
+
+	release, err := makeRoom(model.ParseName(mp.GetFullTagname()), manifest, fn)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	var layers []*Layer
 	layers = append(layers, manifest.Layers...)
 	layers = append(layers, manifest.Config)
@@ -960,22 +1183,42 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 }
 
 func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptions) (*Manifest, error) {
-	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
+	for _, mirror := range registryMirrors() {
+		// credentials for the registry aren't sent to mirrors
+		m, err := getRegistryManifest(ctx, mirrorURL(mirror, mp, "manifests", mp.Tag), &registryOptions{})
+		if err == nil {
+			return m, nil
+		}
+
+		slog.Info("registry mirror unavailable", "mirror", mirror.Redacted(), "model", mp.GetShortTagname(), "error", err)
+	}
 
+	return getRegistryManifest(ctx, mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag), regOpts)
+}
+
+func getRegistryManifest(ctx context.Context, requestURL *url.URL, regOpts *registryOptions) (*Manifest, error) {
 	headers := make(http.Header)
-	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json, application/vnd.oci.image.manifest.v1+json")
 	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	// the digest is of the whole body, not only of what decoding reads
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	var m *Manifest
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+	if err := json.Unmarshal(bts, &m); err != nil {
 		return nil, err
 	}
 
-	return m, err
+	m.digest = fmt.Sprintf("%x", sha256.Sum256(bts))
+	m.body = bts
+	return m, nil
 }
 
 // GetSHA256Digest returns the SHA256 hash of a given buffer and returns it, and the size of buffer
@@ -1035,13 +1278,11 @@ func makeRequestWithRetry(ctx context.Context, method string, requestURL *url.UR
 		switch {
 		case resp.StatusCode == http.StatusUnauthorized:
 			// Handle authentication error with one retry
-			challenge := parseRegistryChallenge(resp.Header.Get("www-authenticate"))
-			token, err := getAuthorizationToken(ctx, challenge)
+			resp.Body.Close()
+			anonymous, err = authenticate(ctx, requestURL.Host, resp.Header.Get("www-authenticate"), regOpts)
 			if err != nil {
 				return nil, err
 			}
-			anonymous = getTokenSubject(token) == "anonymous"
-			regOpts.Token = token
 			if body != nil {
 				_, err = body.Seek(0, io.SeekStart)
 				if err != nil {
@@ -1107,7 +1348,12 @@ func makeRequest(ctx context.Context, method string, requestURL *url.URL, header
 		req.ContentLength = contentLength
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	client, err := getRegistryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1156,6 +1402,11 @@ func verifyBlob(digest string) error {
 		return err
 	}
 
+	return verifyFile(fp, digest)
+}
+
+// verifyFile checks that the contents of the file at fp hash to digest.
+func verifyFile(fp, digest string) error {
 	f, err := os.Open(fp)
 	if err != nil {
 		return err
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// OCI image layout files, see
+// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+const (
+	ociLayoutFile    = "oci-layout"
+	ociIndexFile     = "index.json"
+	ociLayoutVersion = "1.0.0"
+
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+var errInvalidLayout = errors.New("invalid OCI image layout")
+
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ExportModel writes the manifest, config and layer blobs of a model to w as
+// a tarball in OCI image layout.
+func ExportModel(name model.Name, w io.Writer) error {
+	m, err := ParseNamedManifest(name)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := os.ReadFile(m.filepath)
+	if err != nil {
+		return err
+	}
+
+	index := ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociIndexMediaType,
+		Manifests: []ociDescriptor{
+			{
+				MediaType:   m.MediaType,
+				Digest:      "sha256:" + m.digest,
+				Size:        int64(len(manifest)),
+				Annotations: map[string]string{ociRefNameAnnotation: name.String()},
+			},
+		},
+	}
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+
+	writeFile := func(name string, r io.Reader, size int64) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    size,
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+
+		_, err := io.Copy(tw, r)
+		return err
+	}
+
+	writeJSON := func(name string, v any) error {
+		bts, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		return writeFile(name, bytes.NewReader(bts), int64(len(bts)))
+	}
+
+	if err := writeJSON(ociLayoutFile, ociLayout{ImageLayoutVersion: ociLayoutVersion}); err != nil {
+		return err
+	}
+
+	if err := writeJSON(ociIndexFile, index); err != nil {
+		return err
+	}
+
+	if err := writeFile(ociBlobPath(index.Manifests[0].Digest), bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		return err
+	}
+
+	for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		err = writeFile(ociBlobPath(layer.Digest), f, layer.Size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// ImportModel reads a tarball in OCI image layout from r, verifies the digests
+// of its blobs and registers its manifests. Manifests are named by their
+// reference name annotation unless name is valid, which requires the layout to
+// hold a single manifest. It returns the names of the imported models.
+//
+// Blobs are staged in temporary files while the tarball is read and only
+// stored once every manifest is valid, skipping blobs no manifest references.
+func ImportModel(r io.Reader, name model.Name) ([]model.Name, error) {
+	var layout *ociLayout
+	var index *ociIndex
+
+	// staged maps the digest of each blob in the tarball to its temporary
+	// file, or to the stored blob if it's already stored
+	staged := make(map[string]string)
+	defer func() {
+		for digest, p := range staged {
+			if stored, err := GetBlobsPath(digest); err == nil && p != stored {
+				os.Remove(p)
+			}
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch p := path.Clean(strings.TrimPrefix(hdr.Name, "./")); {
+		case p == ociLayoutFile:
+			if err := json.NewDecoder(tr).Decode(&layout); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errInvalidLayout, p, err)
+			}
+		case p == ociIndexFile:
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errInvalidLayout, p, err)
+			}
+		case strings.HasPrefix(p, "blobs/sha256/"):
+			digest := "sha256:" + strings.TrimPrefix(p, "blobs/sha256/")
+			if _, ok := staged[digest]; ok {
+				continue
+			}
+
+			temp, err := stageBlob(digest, tr)
+			if err != nil {
+				return nil, err
+			}
+
+			staged[digest] = temp
+		}
+	}
+
+	if layout == nil || index == nil {
+		return nil, fmt.Errorf("%w: missing %s or %s", errInvalidLayout, ociLayoutFile, ociIndexFile)
+	} else if layout.ImageLayoutVersion != ociLayoutVersion {
+		return nil, fmt.Errorf("%w: unsupported version %q", errInvalidLayout, layout.ImageLayoutVersion)
+	} else if len(index.Manifests) == 0 {
+		return nil, fmt.Errorf("%w: no manifests", errInvalidLayout)
+	} else if name.IsValid() && len(index.Manifests) > 1 {
+		return nil, fmt.Errorf("%w: a name can only be given to a single manifest, found %d", errInvalidLayout, len(index.Manifests))
+	}
+
+	type namedManifest struct {
+		name model.Name
+		Manifest
+	}
+
+	// every manifest is checked before any blob is stored so an invalid
+	// layout doesn't leave blobs behind
+	var manifests []namedManifest
+	for _, desc := range index.Manifests {
+		n := name
+		if !n.IsValid() {
+			n = model.ParseName(desc.Annotations[ociRefNameAnnotation])
+			if !n.IsValid() {
+				return nil, fmt.Errorf("%w: manifest %s has no valid %s annotation", errInvalidLayout, desc.Digest, ociRefNameAnnotation)
+			}
+		}
+
+		p, ok := staged[desc.Digest]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing blob %s", errInvalidLayout, desc.Digest)
+		}
+
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var m Manifest
+		if err := json.Unmarshal(bts, &m); err != nil {
+			return nil, fmt.Errorf("%w: manifest %s: %w", errInvalidLayout, desc.Digest, err)
+		} else if m.Config == nil {
+			return nil, fmt.Errorf("%w: manifest %s has no config", errInvalidLayout, desc.Digest)
+		}
+
+		for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+			p, ok := staged[layer.Digest]
+			if !ok {
+				return nil, fmt.Errorf("%w: missing blob %s", errInvalidLayout, layer.Digest)
+			}
+
+			// makeRoom relies on the sizes in the manifest
+			fi, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			} else if fi.Size() != layer.Size {
+				return nil, fmt.Errorf("%w: blob %s is %d bytes, manifest %s says %d", errInvalidLayout, layer.Digest, fi.Size(), desc.Digest, layer.Size)
+			}
+		}
+
+		manifests = append(manifests, namedManifest{n, m})
+	}
+
+	// room is made for the blobs of every manifest before any is stored, the
+	// reservations of earlier manifests count against later ones
+	for _, m := range manifests {
+		release, err := makeRoom(m.name, &m.Manifest, func(api.ProgressResponse) {})
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	var names []model.Name
+	for _, m := range manifests {
+		for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+			p, err := storeBlob(layer.Digest, staged[layer.Digest])
+			if err != nil {
+				return nil, err
+			}
+
+			// a blob shared by several manifests is only moved once
+			staged[layer.Digest] = p
+		}
+
+		if err := WriteManifest(m.name, m.Config, m.Layers); err != nil {
+			return nil, err
+		}
+
+		names = append(names, m.name)
+	}
+
+	return names, nil
+}
+
+// stageBlob copies the blob read from r to a temporary file in the blobs
+// directory, returning an error unless its contents match digest. If the
+// blob is already stored, r is skipped and the stored blob is returned.
+// Temporary files are named like partial downloads so they aren't taken for
+// blobs.
+func stageBlob(digest string, r io.Reader) (string, error) {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidLayout, err)
+	}
+
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+"-import-partial-*")
+	if err != nil {
+		return "", err
+	}
+	defer temp.Close()
+
+	sha256sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(temp, sha256sum), r); err != nil {
+		os.Remove(temp.Name())
+		return "", err
+	}
+
+	if got := fmt.Sprintf("sha256:%x", sha256sum.Sum(nil)); got != digest {
+		os.Remove(temp.Name())
+		return "", fmt.Errorf("%w: %w: want %s, got %s", errInvalidLayout, errDigestMismatch, digest, got)
+	}
+
+	return temp.Name(), nil
+}
+
+// storeBlob moves a blob staged by stageBlob into place, returning its path.
+func storeBlob(digest, staged string) (string, error) {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return "", err
+	}
+
+	if staged == p {
+		return p, nil
+	}
+
+	return p, os.Rename(staged, p)
+}
+
+func ociBlobPath(digest string) string {
+	return path.Join("blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestExportImportModel(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s\nSYSTEM hello", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	name := model.ParseName("test")
+	expect, err := ParseNamedManifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := ExportModel(name, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := b.Bytes()
+
+	t.Run("import", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		envconfig.LoadConfig()
+
+		names, err := ImportModel(bytes.NewReader(exported), model.Name{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(names) != 1 || names[0] != name {
+			t.Fatalf("expected %v, got %v", name, names)
+		}
+
+		m, err := ParseNamedManifest(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.digest != expect.digest {
+			t.Errorf("expected manifest digest %s, got %s", expect.digest, m.digest)
+		}
+
+		if _, err := GetModel("test"); err != nil {
+			t.Fatal(err)
+		}
+
+		// the manifest itself is not kept as a blob
+		if err := verifyBlob("sha256:" + m.digest); err == nil {
+			t.Errorf("expected manifest blob to be removed")
+		}
+	})
+
+	t.Run("import renamed", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		envconfig.LoadConfig()
+
+		names, err := ImportModel(bytes.NewReader(exported), model.ParseName("renamed:v1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(names) != 1 || names[0].DisplayShortest() != "renamed:v1" {
+			t.Fatalf("expected renamed:v1, got %v", names)
+		}
+
+		if _, err := GetModel("renamed:v1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		envconfig.LoadConfig()
+
+		// replace the system prompt blob with different contents
+		var corrupt bytes.Buffer
+		tw := tar.NewWriter(&corrupt)
+		tr := tar.NewReader(bytes.NewReader(exported))
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			bts, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(bts) == "hello" {
+				bts = []byte("olleh")
+			}
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := tw.Write(bts); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ImportModel(&corrupt, model.Name{}); !errors.Is(err, errDigestMismatch) {
+			t.Fatalf("expected errDigestMismatch, got %v", err)
+		}
+
+		if _, err := ParseNamedManifest(name); err == nil {
+			t.Errorf("expected no manifest to be written")
+		}
+
+		blobs, err := GetBlobsPath("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkFileExists(t, filepath.Join(blobs, "*"), nil)
+	})
+
+	t.Run("unreferenced blob", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		envconfig.LoadConfig()
+
+		// a blob no manifest references is skipped, even with a valid digest
+		planted := []byte("planted")
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(planted))
+
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		tr := tar.NewReader(bytes.NewReader(exported))
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := io.Copy(tw, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := tw.WriteHeader(&tar.Header{Name: ociBlobPath(digest), Mode: 0o644, Size: int64(len(planted))}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(planted); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ImportModel(&b, model.Name{}); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the unreferenced blob not to be stored, got %v", err)
+		}
+	})
+
+	t.Run("not a layout", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		envconfig.LoadConfig()
+
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		if err := tw.WriteHeader(&tar.Header{Name: "README", Mode: 0o644, Size: 5}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.Copy(tw, strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ImportModel(&b, model.Name{}); !errors.Is(err, errInvalidLayout) {
+			t.Fatalf("expected errInvalidLayout, got %v", err)
+		}
+	})
+}
+
+func TestStageBlob(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	blob := []byte("hello")
+	p, err := stageBlob(fmt.Sprintf("sha256:%x", sha256.Sum256(blob)), bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a staged blob isn't an orphaned blob, gc and verify leave it alone
+	if orphaned, err := orphanedBlobs(nil); err != nil {
+		t.Fatal(err)
+	} else if len(orphaned) > 0 {
+		t.Errorf("expected no orphaned blobs, got %v", orphaned)
+	}
+
+	if _, err := CollectGarbage(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(p); err != nil {
+		t.Errorf("expected staged blob to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/parser"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/types/model"
+)
+
+// templateVars are the variables set when a template is executed, in the
+// lower case returned by [template.Template.Vars].
+var templateVars = []string{"system", "prompt", "response", "messages", "role", "content", "images"}
+
+// linter collects the problems found in a Modelfile.
+type linter struct {
+	diagnostics  []api.Diagnostic
+	modelFileDir string
+}
+
+func (l *linter) report(pos parser.Position, severity, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, api.Diagnostic{
+		File:     pos.File,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) errorf(pos parser.Position, format string, args ...any) {
+	l.report(pos, "error", format, args...)
+}
+
+func (l *linter) warnf(pos parser.Position, format string, args ...any) {
+	l.report(pos, "warning", format, args...)
+}
+
+// LintModelfile reports the problems in a Modelfile which would fail
+// CreateModel or have no effect, without creating anything. Model references
+// are resolved against the stored models and their registries, and relative
+// paths against modelFileDir. Variables are substituted from vars.
+func LintModelfile(ctx context.Context, r io.Reader, modelFileDir string, vars map[string]string) []api.Diagnostic {
+	l := linter{modelFileDir: modelFileDir}
+
+	f, positions, errs := parser.ParseFileAll(r, parser.ParseOptions{
+		Dir: modelFileDir,
+		Lookup: func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		},
+	})
+	for _, err := range errs {
+		var perr *parser.ParseError
+		if errors.As(err, &perr) {
+			l.errorf(perr.Pos, "%v", perr.Err)
+		} else {
+			l.errorf(parser.Position{}, "%v", err)
+		}
+	}
+
+	if f == nil {
+		return l.diagnostics
+	}
+
+	// base is the model in FROM, if it is stored, whose template applies
+	// unless one is set
+	var base *Model
+	var tmpl *template.Template
+	var system string
+	var messages []int
+	seen := make(map[string]parser.Position)
+	for i, c := range f.Commands {
+		pos := positions[i]
+
+		switch c.Name {
+		case "model":
+			base = l.checkReference(ctx, pos, "FROM", c.Args)
+		case "adapter":
+			from, _, err := parseAdapter(c.Args)
+			if err != nil {
+				l.errorf(pos, "%v", err)
+				continue
+			}
+
+			l.checkReference(ctx, pos, "ADAPTER", from)
+		case "draft":
+			l.checkReference(ctx, pos, "DRAFT", c.Args)
+		case "template", "system":
+			if prev, ok := seen[c.Name]; ok {
+				l.warnf(pos, "%s overrides the %[1]s on line %d", strings.ToUpper(c.Name), prev.Line)
+			}
+
+			seen[c.Name] = pos
+
+			if c.Name == "system" {
+				system = c.Args
+				continue
+			}
+
+			t, err := template.Parse(c.Args)
+			if err != nil {
+				l.errorf(pos, "invalid template: %v", err)
+				continue
+			}
+
+			tmpl = t
+			for _, v := range t.Vars() {
+				if !slices.Contains(templateVars, v) {
+					l.warnf(pos, "template variable %q is never set", v)
+				}
+			}
+		case "message":
+			// checked by the parser, and against the template below
+			messages = append(messages, i)
+		case "license":
+			// checked by the parser
+		default:
+			if _, err := api.FormatParams(map[string][]string{c.Name: {c.Args}}); err != nil {
+				l.errorf(pos, "%v", err)
+			}
+		}
+	}
+
+	if tmpl == nil && base != nil {
+		tmpl = base.Template
+	}
+
+	// the template of a model created from a file is only known once the
+	// file is read, so SYSTEM is only checked against a known template
+	if pos, ok := seen["system"]; ok && system != "" && tmpl != nil {
+		if vars := tmpl.Vars(); !slices.Contains(vars, "system") && !slices.Contains(vars, "messages") {
+			l.warnf(pos, "SYSTEM is set but the template doesn't use it")
+		}
+	}
+
+	if tmpl != nil && tmpl.Roles() != nil {
+		roles := tmpl.Roles()
+		for _, i := range messages {
+			role, _, _ := strings.Cut(f.Commands[i].Args, ": ")
+			if !slices.Contains(roles, role) {
+				l.warnf(positions[i], "the template doesn't render %s messages", role)
+			}
+		}
+	}
+
+	return l.diagnostics
+}
+
+// checkReference checks that the model, blob or file referenced by a FROM,
+// ADAPTER or DRAFT command exists. It returns the referenced model if it is
+// stored.
+func (l *linter) checkReference(ctx context.Context, pos parser.Position, command, from string) *Model {
+	if name := model.ParseName(from); name.IsValid() {
+		if _, err := ParseNamedManifest(name); err == nil {
+			m, err := GetModel(name.String())
+			if err != nil {
+				l.errorf(pos, "%s %s: %v", command, from, err)
+				return nil
+			}
+
+			return m
+		} else if !errors.Is(err, os.ErrNotExist) {
+			l.errorf(pos, "%s %s: %v", command, from, err)
+			return nil
+		}
+
+		// create pulls models which aren't stored
+		mp := ParseModelPath(name.String())
+		if _, err := pullModelManifest(ctx, mp, &registryOptions{}); errors.Is(err, os.ErrNotExist) {
+			l.errorf(pos, "%s %s: model not found", command, from)
+		} else if err != nil {
+			l.warnf(pos, "%s %s: model isn't stored and its registry couldn't be checked: %v", command, from, err)
+		}
+
+		return nil
+	}
+
+	if digest, ok := strings.CutPrefix(from, "@"); ok {
+		p, err := GetBlobsPath(digest)
+		if err != nil {
+			l.errorf(pos, "%s %s: %v", command, from, err)
+		} else if _, err := os.Stat(p); err != nil {
+			l.errorf(pos, "%s %s: blob not found", command, from)
+		}
+
+		return nil
+	}
+
+	if _, err := os.Stat(realpath(l.modelFileDir, from)); err != nil {
+		l.errorf(pos, "%s %s: not a model name, and the file can't be read: %v", command, from, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestLintModelfile(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s\nTEMPLATE {{ .Prompt }}", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	modelfile := `FROM test
+PARAMETER temprature 0.5
+PARAMETER num_ctx abc
+PARAMETER stop <|end|>
+BADCOMMAND x
+SYSTEM hello
+ADAPTER ./missing.bin
+DRAFT @sha256:0000000000000000000000000000000000000000000000000000000000000000
+`
+
+	cases := []struct {
+		name      string
+		modelfile string
+		expect    []api.Diagnostic
+	}{
+		{
+			name:      "valid",
+			modelfile: "FROM test\nPARAMETER temperature 0.5\nSYSTEM hello\nTEMPLATE {{ .System }} {{ .Prompt }}",
+		},
+		{
+			name:      "problems",
+			modelfile: modelfile,
+			expect: []api.Diagnostic{
+				{Line: 5, Column: 1, Severity: "error", Message: "command must be one of"},
+				{Line: 2, Column: 1, Severity: "error", Message: "unknown parameter 'temprature'"},
+				{Line: 3, Column: 1, Severity: "error", Message: "invalid int value"},
+				{Line: 7, Column: 1, Severity: "error", Message: "ADAPTER ./missing.bin: not a model name"},
+				{Line: 8, Column: 1, Severity: "error", Message: "blob not found"},
+				{Line: 6, Column: 1, Severity: "warning", Message: "SYSTEM is set but the template doesn't use it"},
+			},
+		},
+		{
+			name:      "templates",
+			modelfile: "FROM test\nTEMPLATE {{ .Prompt }} {{ .Foo }}\nTEMPLATE \"{{ .Prompt\"",
+			expect: []api.Diagnostic{
+				{Line: 2, Column: 1, Severity: "warning", Message: `template variable "foo" is never set`},
+				{Line: 3, Column: 1, Severity: "warning", Message: "TEMPLATE overrides the TEMPLATE on line 2"},
+				{Line: 3, Column: 1, Severity: "error", Message: "invalid template"},
+			},
+		},
+		{
+			name:      "message roles",
+			modelfile: "FROM test\nTEMPLATE \"\"\"{{ range .Messages }}{{ if eq .Role \"user\" }}{{ .Content }}{{ end }}{{ end }}\"\"\"\nMESSAGE user hi\nMESSAGE assistant hello",
+			expect: []api.Diagnostic{
+				{Line: 4, Column: 1, Severity: "warning", Message: "the template doesn't render assistant messages"},
+			},
+		},
+		{
+			name:      "missing from",
+			modelfile: "SYSTEM hello",
+			expect: []api.Diagnostic{
+				{Severity: "error", Message: "no FROM line"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.LintHandler, api.LintRequest{Modelfile: tt.modelfile})
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code 200, actual %d", w.Code)
+			}
+
+			var resp api.LintResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(resp.Diagnostics) != len(tt.expect) {
+				t.Fatalf("expected %d diagnostics, got %+v", len(tt.expect), resp.Diagnostics)
+			}
+
+			for i, want := range tt.expect {
+				got := resp.Diagnostics[i]
+				if got.Line != want.Line || got.Column != want.Column || got.Severity != want.Severity || !strings.Contains(got.Message, want.Message) {
+					t.Errorf("expected %+v, got %+v", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLintModelfileRegistry(t *testing.T) {
+	_, name, _ := pushTestModel(t)
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	missing := name
+	missing.Tag = "missing"
+
+	diagnostics := LintModelfile(context.Background(), strings.NewReader(fmt.Sprintf("FROM %s\nADAPTER %s", name, missing)), "", nil)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", diagnostics)
+	}
+
+	if d := diagnostics[0]; d.Line != 2 || d.Severity != "error" || !strings.HasSuffix(d.Message, "model not found") {
+		t.Errorf("expected the missing model to be reported, got %+v", d)
+	}
+}
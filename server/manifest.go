@@ -22,6 +22,9 @@ type Manifest struct {
 	filepath string
 	fi       os.FileInfo
 	digest   string
+
+	// body is the manifest as it was fetched from a registry
+	body []byte
 }
 
 func (m *Manifest) Size() (size int64) {
@@ -71,6 +74,15 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 
 	var m Manifest
 	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		target, ok := resolveAlias(n)
+		if !ok {
+			return nil, err
+		}
+
+		p = filepath.Join(manifests, target.Filepath())
+		f, err = os.Open(p)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -121,6 +133,12 @@ func WriteManifest(name model.Name, config *Layer, layers []*Layer) error {
 }
 
 func Manifests() (map[model.Name]*Manifest, error) {
+	return readManifests(false)
+}
+
+// readManifests reads every manifest in the models directory. Manifests
+// which can't be read are skipped, or returned as an error if strict.
+func readManifests(strict bool) (map[model.Name]*Manifest, error) {
 	manifests, err := GetManifestPath()
 	if err != nil {
 		return nil, err
@@ -148,12 +166,20 @@ func Manifests() (map[model.Name]*Manifest, error) {
 
 			n := model.ParseNameFromFilepath(rel)
 			if !n.IsValid() {
+				if strict {
+					return nil, fmt.Errorf("bad manifest name %q", rel)
+				}
+
 				slog.Warn("bad manifest name", "path", rel, "error", err)
 				continue
 			}
 
 			m, err := ParseNamedManifest(n)
 			if err != nil {
+				if strict {
+					return nil, fmt.Errorf("bad manifest %s: %w", n.DisplayShortest(), err)
+				}
+
 				slog.Warn("bad manifest", "name", n, "error", err)
 				continue
 			}
@@ -1,7 +1,14 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -150,3 +157,28 @@ func TestManifests(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRegistryManifest(t *testing.T) {
+	// trailing whitespace the decoder doesn't need to read is still part of
+	// the manifest's digest
+	body := append([]byte(`{"schemaVersion":2,"config":{"digest":"sha256:abc"}}`), bytes.Repeat([]byte(" "), 1<<20)...)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := getRegistryManifest(context.Background(), u, &registryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("%x", sha256.Sum256(body)); m.digest != want {
+		t.Errorf("expected digest %s, got %s", want, m.digest)
+	}
+}
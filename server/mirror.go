@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// registryMirrors returns the base URLs of the mirrors in
+// OLLAMA_REGISTRY_MIRRORS, in the order they should be tried.
+func registryMirrors() []*url.URL {
+	var mirrors []*url.URL
+	for _, mirror := range envconfig.RegistryMirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			slog.Warn("invalid registry mirror, ignoring", "mirror", mirror, "error", err)
+			continue
+		}
+
+		mirrors = append(mirrors, u)
+	}
+
+	return mirrors
+}
+
+// mirrorURL returns the URL of a registry endpoint of mp on a mirror. The
+// registry the mirror should fetch from is passed in the ns query parameter,
+// like containerd does for its mirrors.
+func mirrorURL(mirror *url.URL, mp ModelPath, elem ...string) *url.URL {
+	u := mirror.JoinPath(append([]string{"v2", mp.GetNamespaceRepository()}, elem...)...)
+	u.RawQuery = url.Values{"ns": {mp.Registry}}.Encode()
+	return u
+}
+
+// blobURL returns the URL to download a blob of mp from, the first mirror
+// which has it or else the registry, along with the options to use for it.
+func blobURL(ctx context.Context, mp ModelPath, digest string, regOpts *registryOptions) (*url.URL, *registryOptions) {
+	for _, mirror := range registryMirrors() {
+		requestURL := mirrorURL(mirror, mp, "blobs", digest)
+
+		// credentials for the registry aren't sent to mirrors
+		opts := &registryOptions{}
+		resp, err := makeRequestWithRetry(ctx, http.MethodHead, requestURL, nil, nil, opts)
+		if err != nil {
+			slog.Info("registry mirror unavailable", "mirror", mirror.Redacted(), "digest", digest, "error", err)
+			continue
+		}
+		resp.Body.Close()
+
+		return requestURL, opts
+	}
+
+	return registryBlobURL(mp, digest), regOpts
+}
+
+// registryBlobURL returns the URL of a blob of mp on its own registry.
+func registryBlobURL(mp ModelPath, digest string) *url.URL {
+	return mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "blobs", digest)
+}
+
+// blobSize returns the size of a blob of mp where blobURL would download it
+// from.
+func blobSize(ctx context.Context, mp ModelPath, digest string, regOpts *registryOptions) (int64, error) {
+	requestURL, opts := blobURL(ctx, mp, digest, regOpts)
+	resp, err := makeRequestWithRetry(ctx, http.MethodHead, requestURL, nil, nil, opts)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+}
+
+// registryError writes an error in the format of the OCI distribution spec.
+func registryError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"errors": []gin.H{{"code": code, "message": message}}})
+}
+
+// cachedRegistry reports whether the pull-through cache fetches from
+// registry, which is only the default registry or one of the configured
+// mirrors so clients can't make the server fetch from any host.
+func cachedRegistry(registry string) bool {
+	if strings.EqualFold(registry, DefaultRegistry) {
+		return true
+	}
+
+	for _, mirror := range registryMirrors() {
+		if strings.EqualFold(registry, mirror.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cachedModelPath returns the model a pull-through cache request is for,
+// on the registry named by the ns query parameter.
+func cachedModelPath(c *gin.Context) (ModelPath, error) {
+	registry := c.DefaultQuery("ns", DefaultRegistry)
+	if !cachedRegistry(registry) {
+		return ModelPath{}, fmt.Errorf("registry %q isn't cached", registry)
+	}
+
+	return ParseModelPath(strings.Join([]string{registry, c.Param("namespace"), c.Param("model")}, "/")), nil
+}
+
+// RegistryPingHandler answers the version check of registry clients.
+func (s *Server) RegistryPingHandler(c *gin.Context) {
+	c.Header("Docker-Distribution-API-Version", "registry/2.0")
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RegistryManifestHandler serves the manifest of a model to other servers
+// using this one as a pull-through cache. A stored model is served as is,
+// otherwise the manifest is fetched from the registry and served without
+// storing the model. Its blobs are fetched as they're requested.
+func (s *Server) RegistryManifestHandler(c *gin.Context) {
+	mp, err := cachedModelPath(c)
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", err.Error())
+		return
+	}
+
+	mp.Tag = c.Param("tag")
+
+	name := model.ParseName(mp.GetFullTagname())
+	if !name.IsValid() {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", fmt.Sprintf("invalid model name %q", mp.GetFullTagname()))
+		return
+	}
+
+	m, err := ParseNamedManifest(name)
+	if errors.Is(err, os.ErrNotExist) {
+		rm, err := pullModelManifest(c.Request.Context(), mp, &registryOptions{})
+		if err != nil {
+			slog.Warn("pull-through cache couldn't fetch manifest", "model", name.DisplayShortest(), "error", err)
+			registryError(c, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("model %q not found", name.DisplayShortest()))
+			return
+		}
+
+		c.Header("Content-Type", rm.MediaType)
+		c.Header("Content-Length", strconv.Itoa(len(rm.body)))
+		c.Header("Docker-Content-Digest", "sha256:"+rm.digest)
+		c.Status(http.StatusOK)
+		if c.Request.Method != http.MethodHead {
+			c.Writer.Write(rm.body)
+		}
+
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	c.Header("Content-Type", m.MediaType)
+	c.Header("Docker-Content-Digest", "sha256:"+m.digest)
+	http.ServeFile(c.Writer, c.Request, m.filepath)
+}
+
+// RegistryBlobHandler serves a blob to other servers using this one as a
+// pull-through cache, downloading it from the registry and keeping it if it
+// isn't stored.
+func (s *Server) RegistryBlobHandler(c *gin.Context) {
+	digest := c.Param("digest")
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+
+	if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+		mp, err := cachedModelPath(c)
+		if err != nil {
+			registryError(c, http.StatusBadRequest, "NAME_INVALID", err.Error())
+			return
+		}
+
+		size, err := blobSize(c.Request.Context(), mp, digest, &registryOptions{})
+		if errors.Is(err, os.ErrNotExist) {
+			registryError(c, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob %s not found", digest))
+			return
+		} else if err != nil {
+			registryError(c, http.StatusBadGateway, "UNKNOWN", err.Error())
+			return
+		}
+
+		// a HEAD request only asks the registry, the blob is fetched when
+		// it's requested
+		if c.Request.Method == http.MethodHead {
+			c.Header("Content-Type", "application/octet-stream")
+			c.Header("Content-Length", strconv.FormatInt(size, 10))
+			c.Header("Docker-Content-Digest", digest)
+			c.Status(http.StatusOK)
+			return
+		}
+
+		release, err := makeRoom(model.Name{}, &Manifest{Config: &Layer{Digest: digest, Size: size}}, func(api.ProgressResponse) {})
+		if errors.Is(err, errStoreFull) {
+			registryError(c, http.StatusInsufficientStorage, "UNKNOWN", err.Error())
+			return
+		} else if err != nil {
+			registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+		defer release()
+
+		opts := downloadOpts{
+			mp:      mp,
+			digest:  digest,
+			regOpts: &registryOptions{},
+			fn:      func(api.ProgressResponse) {},
+		}
+
+		// the download isn't canceled with the request so the blob is cached
+		// for the next one
+		if _, err := downloadBlob(context.WithoutCancel(c.Request.Context()), opts); errors.Is(err, os.ErrNotExist) {
+			registryError(c, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob %s not found", digest))
+			return
+		} else if err != nil {
+			registryError(c, http.StatusBadGateway, "UNKNOWN", err.Error())
+			return
+		}
+
+		if err := verifyBlob(digest); err != nil {
+			os.Remove(p)
+			registryError(c, http.StatusBadGateway, "DIGEST_INVALID", err.Error())
+			return
+		}
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Docker-Content-Digest", digest)
+	http.ServeFile(c.Writer, c.Request, p)
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestRegistryMirror(t *testing.T) {
+	origin, name, pushed := pushTestModel(t)
+
+	mirror := newTestRegistry(t)
+	mirror.anonymous = true
+	for k, v := range origin.blobs {
+		mirror.blobs[k] = v
+	}
+
+	for k, v := range origin.manifests {
+		mirror.manifests[k] = v
+	}
+
+	fn := func(api.ProgressResponse) {}
+
+	t.Run("mirror", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		t.Setenv("OLLAMA_REGISTRY_MIRRORS", "https://127.0.0.1:1,"+mirror.URL)
+		envconfig.LoadConfig()
+
+		origin.requests = nil
+		if err := PullModel(context.Background(), name.String(), &registryOptions{}, fn); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(origin.requests) > 0 {
+			t.Errorf("expected no requests to the registry, got %v", origin.requests)
+		}
+
+		if len(mirror.requests) == 0 {
+			t.Fatal("expected requests to the mirror")
+		}
+
+		for _, u := range mirror.requests {
+			if ns := u.Query().Get("ns"); ns != name.Host {
+				t.Errorf("expected ns %s, got %s", name.Host, ns)
+			}
+		}
+
+		pulled, err := ParseNamedManifest(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pulled.Config.Digest != pushed.Config.Digest {
+			t.Errorf("expected pulled manifest to match the pushed one")
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		t.Setenv("OLLAMA_REGISTRY_MIRRORS", mirror.URL)
+		envconfig.LoadConfig()
+
+		// the mirror doesn't have the system prompt
+		for _, layer := range pushed.Layers {
+			if layer.MediaType == "application/vnd.ollama.image.system" {
+				delete(mirror.blobs, layer.Digest)
+			}
+		}
+
+		origin.requests = nil
+		if err := PullModel(context.Background(), name.String(), &registryOptions{}, fn); err != nil {
+			t.Fatal(err)
+		}
+
+		var blobs int
+		for _, u := range origin.requests {
+			if strings.Contains(u.Path, "/blobs/") {
+				blobs++
+			}
+		}
+
+		if blobs == 0 {
+			t.Errorf("expected the missing blob to be pulled from the registry")
+		}
+	})
+
+	t.Run("failing mirror", func(t *testing.T) {
+		// the mirror has every blob but fails to serve them
+		failing := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			mirror.serve(w, r)
+		}))
+		defer failing.Close()
+
+		for k, v := range origin.blobs {
+			mirror.blobs[k] = v
+		}
+
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		t.Setenv("OLLAMA_REGISTRY_MIRRORS", failing.URL)
+		envconfig.LoadConfig()
+
+		if err := PullModel(context.Background(), name.String(), &registryOptions{}, fn); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, layer := range append(pushed.Layers, pushed.Config) {
+			if err := verifyBlob(layer.Digest); err != nil {
+				t.Errorf("expected %s to be downloaded from the registry, got %v", layer.Digest, err)
+			}
+		}
+	})
+}
+
+func TestRegistryCache(t *testing.T) {
+	origin, name, pushed := pushTestModel(t)
+
+	// the cache only fetches from mirrors, which don't get credentials
+	origin.anonymous = true
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRY_CACHE", "1")
+	t.Setenv("OLLAMA_REGISTRY_MIRRORS", origin.URL)
+	envconfig.LoadConfig()
+	t.Cleanup(func() { envconfig.RegistryCache = false })
+
+	var s Server
+	srv := httptest.NewServer(s.GenerateRoutes())
+	defer srv.Close()
+
+	blobRequests := func() (n int) {
+		for _, u := range origin.requests {
+			if strings.Contains(u.Path, "/blobs/") {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	// the manifest of a model which isn't stored is fetched without pulling
+	// the model
+	origin.requests = nil
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, srv.URL+"/v2/library/test/manifests/latest?ns="+name.Host, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status code 200, actual %d", method, resp.StatusCode)
+		}
+
+		bts, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if method == http.MethodGet && !bytes.Equal(bts, origin.manifests["latest"]) {
+			t.Errorf("expected the manifest of the registry, got %s", bts)
+		}
+
+		if want := fmt.Sprintf("sha256:%x", sha256.Sum256(origin.manifests["latest"])); resp.Header.Get("Docker-Content-Digest") != want {
+			t.Errorf("%s: expected digest %s, got %s", method, want, resp.Header.Get("Docker-Content-Digest"))
+		}
+	}
+
+	if n := blobRequests(); n > 0 {
+		t.Errorf("expected no blob requests, got %d", n)
+	}
+
+	if _, err := ParseNamedManifest(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the model not to be pulled, got %v", err)
+	}
+
+	for _, layer := range append(pushed.Layers, pushed.Config) {
+		u := srv.URL + "/v2/library/test/blobs/" + layer.Digest + "?ns=" + name.Host
+
+		// a HEAD request only asks the registry
+		resp, err := http.Head(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status code 200, actual %d", layer.Digest, resp.StatusCode)
+		}
+
+		if resp.ContentLength != layer.Size {
+			t.Errorf("%s: expected size %d, got %d", layer.Digest, layer.Size, resp.ContentLength)
+		}
+
+		if err := verifyBlob(layer.Digest); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected the blob not to be downloaded, got %v", layer.Digest, err)
+		}
+
+		// a GET request downloads and keeps it
+		resp, err = http.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		bts, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status code 200, actual %d", layer.Digest, resp.StatusCode)
+		}
+
+		if resp.Header.Get("Docker-Content-Digest") != layer.Digest {
+			t.Errorf("expected digest %s, got %s", layer.Digest, resp.Header.Get("Docker-Content-Digest"))
+		}
+
+		if !bytes.Equal(bts, origin.blobs[layer.Digest]) {
+			t.Errorf("%s: expected the blob of the registry", layer.Digest)
+		}
+
+		if err := verifyBlob(layer.Digest); err != nil {
+			t.Errorf("%s: expected the blob to be kept, got %v", layer.Digest, err)
+		}
+	}
+
+	// stored models are served without contacting the registry
+	if err := PullModel(context.Background(), name.String(), &registryOptions{}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	origin.requests = nil
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, srv.URL+"/v2/library/test/manifests/latest?ns="+name.Host, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status code 200, actual %d", method, resp.StatusCode)
+		}
+	}
+
+	if len(origin.requests) > 0 {
+		t.Errorf("expected no requests to the registry, got %v", origin.requests)
+	}
+
+	for _, ns := range []string{"169.254.169.254", "example.com:8080"} {
+		resp, err := http.Get(srv.URL + "/v2/library/test/manifests/latest?ns=" + ns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status code 400, actual %d", ns, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/v2/library/missing/manifests/latest?ns=" + name.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status code 404, actual %d", resp.StatusCode)
+	}
+
+	// blobs which are fetched have to fit in the store
+	if err := os.RemoveAll(filepath.Join(envconfig.ModelsDir, "blobs")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OLLAMA_MAX_STORE_SIZE", "1")
+	envconfig.LoadConfig()
+	t.Cleanup(func() { envconfig.MaxStoreSize = 0 })
+
+	resp, err = http.Get(srv.URL + "/v2/library/test/blobs/" + pushed.Layers[0].Digest + "?ns=" + name.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("expected status code 507, actual %d", resp.StatusCode)
+	}
+}
@@ -11,10 +11,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/convert"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/parser"
 	"github.com/ollama/ollama/template"
 	"github.com/ollama/ollama/types/model"
 )
@@ -77,6 +80,55 @@ func parseFromModel(ctx context.Context, name model.Name, fn func(api.ProgressRe
 	return layers, nil
 }
 
+// parseDraft resolves the argument of a DRAFT command, either a model name or
+// a path to a GGUF file, to a layer holding the draft model's weights.
+func parseDraft(ctx context.Context, modelFileDir, from string, fn func(api.ProgressResponse)) (*layerGGML, error) {
+	var layers []*layerGGML
+	if name := model.ParseName(from); name.IsValid() {
+		var err error
+		layers, err = parseFromModel(ctx, name, fn)
+		if err != nil {
+			return nil, err
+		}
+	} else if file, err := os.Open(realpath(modelFileDir, from)); err == nil {
+		defer file.Close()
+
+		layers, err = parseFromFile(ctx, file, "", fn)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("invalid draft model reference: %s", from)
+	}
+
+	for _, layer := range layers {
+		if layer.MediaType != "application/vnd.ollama.image.model" {
+			continue
+		}
+
+		if layer.GGML == nil || layer.GGML.Name() != "gguf" {
+			return nil, fmt.Errorf("draft model %s is not a gguf model", from)
+		}
+
+		draft := *layer.Layer
+		draft.MediaType = "application/vnd.ollama.image.draft"
+		return &layerGGML{&draft, layer.GGML}, nil
+	}
+
+	return nil, fmt.Errorf("draft model %s has no model weights", from)
+}
+
+// parseAdapter splits the name= and scale= options off the end of the
+// argument of an ADAPTER command, returning the adapter reference that remains.
+func parseAdapter(args string) (from string, config adapterConfig, err error) {
+	adapter, err := parser.ParseAdapter(args)
+	if err != nil {
+		return "", adapterConfig{}, err
+	}
+
+	return adapter.From, adapterConfig{Name: adapter.Name, Scale: adapter.Scale}, nil
+}
+
 func extractFromZipFile(p string, file *os.File, fn func(api.ProgressResponse)) error {
 	stat, err := file.Stat()
 	if err != nil {
@@ -212,8 +264,10 @@ func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(ap
 	}
 
 	switch contentType {
-	case "gguf", "ggla":
+	case "gguf":
 		// noop
+	case "ggla":
+		return nil, llm.ErrLegacyAdapter
 	case "application/zip":
 		return parseFromZipFile(ctx, file, digest, fn)
 	default:
@@ -235,7 +289,7 @@ func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(ap
 		}
 
 		mediatype := "application/vnd.ollama.image.model"
-		if ggml.Name() == "ggla" {
+		if ggml.KV()["general.type"] == "adapter" {
 			mediatype = "application/vnd.ollama.image.adapter"
 		} else if ggml.KV().Architecture() == "clip" {
 			mediatype = "application/vnd.ollama.image.projector"
@@ -255,7 +309,8 @@ func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(ap
 
 func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 	for _, layer := range layers {
-		if s := layer.GGML.KV().ChatTemplate(); s != "" {
+		kv := layer.GGML.KV()
+		if s := kv.ChatTemplate(); s != "" {
 			if t, err := template.Named(s); err != nil {
 				slog.Debug("template detection", "error", err)
 			} else {
@@ -265,14 +320,115 @@ func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 				}
 
 				tmpl.status = fmt.Sprintf("using autodetected template %s", t.Name)
+				if addBOS, ok := kv["tokenizer.ggml.add_bos_token"].(bool); ok && t.BOS && !addBOS {
+					slog.Warn("template expects a BOS token the tokenizer doesn't add", "template", t.Name)
+					tmpl.status += ", which expects a BOS token the tokenizer doesn't add"
+				}
+
 				layers = append(layers, &layerGGML{tmpl, nil})
+				continue
+			}
+
+			// no named template matches so convert the chat template itself
+			tmpl, err := convertChatTemplate(s, eosToken(layer))
+			if err != nil {
+				slog.Warn("template conversion", "error", err)
+				continue
 			}
+
+			layers = append(layers, &layerGGML{tmpl, nil})
 		}
 	}
 
 	return layers, nil
 }
 
+// convertChatTemplate converts a Jinja chat template into a template layer.
+// Warnings for parts of the template which couldn't be converted are
+// reported in the layer's status.
+// eosToken returns the text of the EOS token of layer. Vocabularies are
+// larger than the arrays DecodeGGML collects by default, so if the token
+// isn't known the layer is decoded again collecting every array.
+func eosToken(layer *layerGGML) string {
+	kv := layer.GGML.KV()
+	if s := kv.EOSToken(); s != "" {
+		return s
+	} else if _, ok := kv["tokenizer.ggml.eos_token_id"]; !ok {
+		return ""
+	}
+
+	p, err := GetBlobsPath(layer.Digest)
+	if err != nil {
+		return ""
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		slog.Warn("reading eos token", "error", err)
+		return ""
+	}
+	defer f.Close()
+
+	ggml, _, err := llm.DecodeGGML(f, -1)
+	if err != nil {
+		slog.Warn("reading eos token", "error", err)
+		return ""
+	}
+
+	return ggml.KV().EOSToken()
+}
+
+func convertChatTemplate(s, eos string) (*Layer, error) {
+	converted, warnings, err := template.ConvertJinja(s, eos)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := template.Parse(converted); err != nil {
+		return nil, err
+	}
+
+	tmpl, err := NewLayer(strings.NewReader(converted), "application/vnd.ollama.image.template")
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.status = "using template converted from the model's chat template"
+	for _, w := range warnings {
+		slog.Warn("template conversion", "warning", w)
+	}
+
+	if len(warnings) > 0 {
+		tmpl.status += fmt.Sprintf(" (warnings: %s)", strings.Join(warnings, "; "))
+	}
+
+	return tmpl, nil
+}
+
+// templateText returns the text of the template layer, or an empty string if
+// there isn't one.
+func templateText(layers []*Layer) (string, error) {
+	i := slices.IndexFunc(layers, func(layer *Layer) bool {
+		return layer.MediaType == "application/vnd.ollama.image.template"
+	})
+	if i < 0 {
+		return "", nil
+	}
+
+	r, err := layers[i].Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	bts, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bts), nil
+}
+
 func detectContentType(r io.Reader) (string, error) {
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, r); err != nil {
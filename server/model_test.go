@@ -110,3 +110,39 @@ func TestExtractFromZipFile(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAdapter(t *testing.T) {
+	cases := []struct {
+		args   string
+		from   string
+		config adapterConfig
+		valid  bool
+	}{
+		{"./lora.gguf", "./lora.gguf", adapterConfig{}, true},
+		{"./lora.gguf name=sql", "./lora.gguf", adapterConfig{Name: "sql"}, true},
+		{"./lora.gguf name=sql  scale=0.5", "./lora.gguf", adapterConfig{Name: "sql", Scale: 0.5}, true},
+		{"./my lora.gguf scale=2", "./my lora.gguf", adapterConfig{Scale: 2}, true},
+		{"./lora.gguf a=b", "./lora.gguf a=b", adapterConfig{}, true},
+		{"./lora.gguf scale=-1", "", adapterConfig{}, false},
+		{"./lora.gguf scale=x", "", adapterConfig{}, false},
+		{"./lora.gguf name=", "", adapterConfig{}, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.args, func(t *testing.T) {
+			from, config, err := parseAdapter(tt.args)
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if from != tt.from || config != tt.config {
+				t.Errorf("expected %q %+v, got %q %+v", tt.from, tt.config, from, config)
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@ package server
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/llm"
@@ -12,63 +15,403 @@ import (
 
 type tokenizeFunc func(context.Context, string) ([]int, error)
 
+// chatOverflow selects how chatPrompt handles messages which exceed the
+// context window of the model.
+type chatOverflow struct {
+	// strategy is one of the api.Overflow constants, empty for
+	// api.OverflowTruncate.
+	strategy string
+
+	// summarize summarizes the messages dropped by api.OverflowSummarize.
+	summarize func(context.Context, []api.Message) (string, error)
+}
+
+var overflowStrategies = []string{
+	api.OverflowTruncate,
+	api.OverflowMiddle,
+	api.OverflowContent,
+	api.OverflowSummarize,
+	api.OverflowError,
+}
+
+// checkOverflow returns an error if s isn't an overflow strategy.
+func checkOverflow(s string) error {
+	if s != "" && !slices.Contains(overflowStrategies, s) {
+		return fmt.Errorf("unknown overflow strategy %q, expected one of %s", s, strings.Join(overflowStrategies, ", "))
+	}
+
+	return nil
+}
+
+// contextOverflowError is returned by chatPrompt for api.OverflowError when
+// the messages exceed the context window.
+type contextOverflowError struct {
+	tokens, numCtx int
+}
+
+func (e *contextOverflowError) Error() string {
+	return fmt.Sprintf("messages require %d tokens which exceeds the context window of %d tokens", e.tokens, e.numCtx)
+}
+
 // chatPrompt accepts a list of messages and returns the prompt and images that should be used for the next chat turn.
-// chatPrompt truncates any messages that exceed the context window of the model, making sure to always include 1) the
-// latest message and 2) system messages
-func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message) (prompt string, images []llm.ImageData, _ error) {
-	var system []api.Message
+// Messages which exceed the context window of the model are handled as selected by overflow, by default truncating
+// the oldest messages while making sure to always include 1) the latest message and 2) system messages. dropped is
+// the number of messages left out of the prompt.
+func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, overflow chatOverflow) (prompt string, images []llm.ImageData, dropped int, _ error) {
+	var err error
+	switch overflow.strategy {
+	case "", api.OverflowTruncate:
+		msgs, dropped, _, err = dropMessages(ctx, m, tokenize, opts, msgs, 0)
+	case api.OverflowMiddle:
+		msgs, dropped, err = truncateMiddle(ctx, m, tokenize, opts, msgs)
+	case api.OverflowContent:
+		msgs, dropped, err = truncateContent(ctx, m, tokenize, opts, msgs)
+	case api.OverflowSummarize:
+		msgs, dropped, err = summarizeMessages(ctx, m, tokenize, opts, msgs, overflow.summarize)
+	case api.OverflowError:
+		var c int
+		if c, err = promptTokens(ctx, m, tokenize, msgs); err == nil && c > opts.NumCtx {
+			err = &contextOverflowError{tokens: c, numCtx: opts.NumCtx}
+		}
+	default:
+		err = checkOverflow(overflow.strategy)
+	}
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	var b bytes.Buffer
+	if err := m.Template.Execute(&b, template.Values{Messages: msgs}); err != nil {
+		return "", nil, 0, err
+	}
+
+	for _, m := range msgs {
+		for _, i := range m.Images {
+			images = append(images, llm.ImageData{
+				ID:   len(images),
+				Data: i,
+			})
+		}
+	}
+
+	return b.String(), images, dropped, nil
+}
+
+// promptTokens returns the number of tokens msgs take up in the context
+// window once rendered with the model's template.
+func promptTokens(ctx context.Context, m *Model, tokenize tokenizeFunc, msgs []api.Message) (int, error) {
+	var b bytes.Buffer
+	if err := m.Template.Execute(&b, template.Values{Messages: msgs}); err != nil {
+		return 0, err
+	}
+
+	s, err := tokenize(ctx, b.String())
+	if err != nil {
+		return 0, err
+	}
+
+	c := len(s)
+	if m.ProjectorPaths != nil {
+		for _, m := range msgs {
+			// images are represented as 768 sized embeddings
+			// TODO: get embedding length from project metadata
+			c += 768 * len(m.Images)
+		}
+	}
+
+	return c, nil
+}
+
+// dropMessages drops the oldest non-system messages after msgs[:start] until
+// the rest fit into the context window, always keeping the latest message.
+// fits reports whether the kept messages fit.
+func dropMessages(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, start int) (kept []api.Message, dropped int, fits bool, _ error) {
+	keep := func(i int) []api.Message {
+		kept := slices.Clone(msgs[:start])
+		for _, msg := range msgs[start:i] {
+			if msg.Role == "system" {
+				kept = append(kept, msg)
+			}
+		}
+
+		return append(kept, msgs[i:]...)
+	}
+
 	// always include the last message
 	n := len(msgs) - 1
 	// in reverse, find all messages that fit into context window
-	for i := n - 1; i >= 0; i-- {
-		system = make([]api.Message, 0)
-		for j := range i {
-			if msgs[j].Role == "system" {
-				system = append(system, msgs[j])
-			}
+	for i := n; i >= start; i-- {
+		c, err := promptTokens(ctx, m, tokenize, keep(i))
+		if err != nil {
+			return nil, 0, false, err
 		}
 
-		var b bytes.Buffer
-		if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[i:]...)}); err != nil {
-			return "", nil, err
+		if c > opts.NumCtx {
+			slog.Debug("truncating input messages which exceed context length", "truncated", len(msgs[i:]))
+			break
 		}
 
-		s, err := tokenize(ctx, b.String())
-		if err != nil {
-			return "", nil, err
+		n, fits = i, true
+	}
+
+	for _, msg := range msgs[start:n] {
+		if msg.Role != "system" {
+			dropped++
 		}
+	}
+
+	return keep(n), dropped, fits, nil
+}
 
-		c := len(s)
-		if m.ProjectorPaths != nil {
-			for _, m := range msgs[i:] {
-				// images are represented as 768 sized embeddings
-				// TODO: get embedding length from project metadata
-				c += 768 * len(m.Images)
+// truncateMiddle keeps the first user message and the messages before it,
+// dropping the messages after it instead of the oldest ones. It falls back to
+// dropping the oldest messages if these and the latest message don't fit.
+func truncateMiddle(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message) ([]api.Message, int, error) {
+	first := slices.IndexFunc(msgs, func(msg api.Message) bool { return msg.Role == "user" })
+	if first >= 0 && first < len(msgs)-1 {
+		kept, dropped, fits, err := dropMessages(ctx, m, tokenize, opts, msgs, first+1)
+		if err != nil || fits {
+			return kept, dropped, err
+		}
+	}
+
+	kept, dropped, _, err := dropMessages(ctx, m, tokenize, opts, msgs, 0)
+	return kept, dropped, err
+}
+
+// truncateContent shortens the content of the longest messages, starting with
+// the longest, until they fit into the context window. It falls back to
+// dropping the oldest messages if they don't fit with all content removed.
+func truncateContent(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message) ([]api.Message, int, error) {
+	fits := func(msgs []api.Message) (bool, error) {
+		c, err := promptTokens(ctx, m, tokenize, msgs)
+		return c <= opts.NumCtx, err
+	}
+
+	msgs = slices.Clone(msgs)
+	for {
+		if ok, err := fits(msgs); err != nil || ok {
+			return msgs, 0, err
+		}
+
+		longest := -1
+		for i, msg := range msgs {
+			if msg.Content != "" && (longest < 0 || len(msg.Content) > len(msgs[longest].Content)) {
+				longest = i
 			}
 		}
 
-		if c > opts.NumCtx {
-			slog.Debug("truncating input messages which exceed context length", "truncated", len(msgs[i:]))
+		if longest < 0 {
 			break
-		} else {
-			n = i
 		}
+
+		// find the longest prefix of the content which fits
+		content := []rune(msgs[longest].Content)
+		lo, hi := 0, len(content)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			msgs[longest].Content = string(content[:mid])
+			ok, err := fits(msgs)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if ok {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+
+		slog.Debug("truncating message content which exceeds context length", "index", longest, "length", len(content), "truncated", len(content)-lo)
+		msgs[longest].Content = string(content[:lo])
+	}
+
+	kept, dropped, _, err := dropMessages(ctx, m, tokenize, opts, msgs, 0)
+	return kept, dropped, err
+}
+
+// summarizeMessages drops the oldest messages and adds a system message with
+// a summary of them after the leading system messages, dropping more messages
+// if the summary doesn't fit.
+func summarizeMessages(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, summarize func(context.Context, []api.Message) (string, error)) ([]api.Message, int, error) {
+	kept, dropped, _, err := dropMessages(ctx, m, tokenize, opts, msgs, 0)
+	if err != nil || dropped == 0 || summarize == nil {
+		return kept, dropped, err
+	}
+
+	// the dropped messages are the oldest non-system messages
+	var old []api.Message
+	for _, msg := range msgs {
+		if len(old) == dropped {
+			break
+		}
+
+		if msg.Role != "system" {
+			old = append(old, msg)
+		}
+	}
+
+	summary, err := summarize(ctx, old)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	i := slices.IndexFunc(kept, func(msg api.Message) bool { return msg.Role != "system" })
+	kept = slices.Insert(kept, i, api.Message{Role: "system", Content: "Summary of the earlier conversation: " + summary})
+
+	kept, more, _, err := dropMessages(ctx, m, tokenize, opts, kept, 0)
+	return kept, dropped + more, err
+}
+
+// checkRoles returns an error for the first message with a role the template
+// may not render, as it would be left out of the prompt. Template.Roles are
+// declared for Ollama's named templates but guessed for others, so the error
+// is a warning rather than a reason to reject a chat.
+func checkRoles(tmpl *template.Template, msgs []api.Message) error {
+	roles := tmpl.Roles()
+	if roles == nil {
+		return nil
+	}
+
+	for _, msg := range msgs {
+		if !slices.Contains(roles, msg.Role) {
+			return fmt.Errorf("the model's template can't render messages with the role %q", msg.Role)
+		}
+	}
+
+	return nil
+}
+
+// summarizer returns a chatOverflow summarize hook which asks the model
+// loaded by r to summarize the messages.
+func summarizer(r llm.LlamaServer, m *Model, opts *api.Options) func(context.Context, []api.Message) (string, error) {
+	// keep summaries short enough to leave room for the messages summarized
+	// along with them
+	summaryOpts := *opts
+	summaryOpts.NumPredict = summaryTokens(opts)
+
+	complete := func(ctx context.Context, prompt string) (string, error) {
+		var summary strings.Builder
+		if err := r.Completion(ctx, llm.CompletionRequest{Prompt: prompt, Options: &summaryOpts}, func(cr llm.CompletionResponse) {
+			summary.WriteString(cr.Content)
+		}); err != nil {
+			return "", fmt.Errorf("summarizing dropped messages: %w", err)
+		}
+
+		return strings.TrimSpace(summary.String()), nil
+	}
+
+	return func(ctx context.Context, msgs []api.Message) (string, error) {
+		return summarizeChunks(ctx, m, r.Tokenize, opts, msgs, complete)
+	}
+}
+
+// summaryTokens is the number of tokens a summary may take up.
+func summaryTokens(opts *api.Options) int {
+	return max(opts.NumCtx/8, 1)
+}
+
+// summaryPrompt renders a prompt asking to summarize msgs, continuing the
+// summary of the messages before them.
+func summaryPrompt(m *Model, summary string, msgs []api.Message) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("Summarize the following conversation in a few sentences, keeping any details needed to continue it.\n\n")
+	if summary != "" {
+		fmt.Fprintf(&sb, "Summary of the conversation so far: %s\n\n", summary)
+	}
+
+	for _, msg := range msgs {
+		fmt.Fprintf(&sb, "%s: %s\n\n", msg.Role, msg.Content)
 	}
 
-	// truncate any messages that do not fit into the context window
 	var b bytes.Buffer
-	if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[n:]...)}); err != nil {
-		return "", nil, err
+	if err := m.Template.Execute(&b, template.Values{Messages: []api.Message{{Role: "user", Content: sb.String()}}}); err != nil {
+		return "", err
 	}
 
-	for _, m := range msgs[n:] {
-		for _, i := range m.Images {
-			images = append(images, llm.ImageData{
-				ID:   len(images),
-				Data: i,
-			})
+	return b.String(), nil
+}
+
+// summarizeChunks summarizes msgs with complete. The messages didn't fit into
+// the context window to begin with, so they are summarized in chunks which
+// fit, each along with the summary of the chunks before it. A message which
+// doesn't fit on its own is split up.
+func summarizeChunks(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, complete func(context.Context, string) (string, error)) (string, error) {
+	fits := func(summary string, msgs []api.Message) (string, bool, error) {
+		prompt, err := summaryPrompt(m, summary, msgs)
+		if err != nil {
+			return "", false, err
+		}
+
+		s, err := tokenize(ctx, prompt)
+		if err != nil {
+			return "", false, err
+		}
+
+		return prompt, len(s)+summaryTokens(opts) <= opts.NumCtx, nil
+	}
+
+	msgs = slices.Clone(msgs)
+
+	var summary string
+	for len(msgs) > 0 {
+		var prompt string
+		n := 0
+		for n < len(msgs) {
+			p, ok, err := fits(summary, msgs[:n+1])
+			if err != nil {
+				return "", err
+			} else if !ok {
+				break
+			}
+
+			prompt, n = p, n+1
+		}
+
+		if n == 0 {
+			// find the longest prefix of the content which fits and leave
+			// the rest for the next chunk
+			content := []rune(msgs[0].Content)
+			lo, hi := 0, len(content)
+			for lo < hi {
+				mid := (lo + hi + 1) / 2
+				msg := msgs[0]
+				msg.Content = string(content[:mid])
+				_, ok, err := fits(summary, []api.Message{msg})
+				if err != nil {
+					return "", err
+				}
+
+				if ok {
+					lo = mid
+				} else {
+					hi = mid - 1
+				}
+			}
+
+			if lo == 0 {
+				return "", fmt.Errorf("summarizing dropped messages: the context window of %d tokens is too small", opts.NumCtx)
+			}
+
+			head := msgs[0]
+			head.Content = string(content[:lo])
+			p, _, err := fits(summary, []api.Message{head})
+			if err != nil {
+				return "", err
+			}
+
+			prompt = p
+			msgs[0].Content = string(content[lo:])
+		} else {
+			msgs = msgs[n:]
+		}
+
+		var err error
+		if summary, err = complete(ctx, prompt); err != nil {
+			return "", err
 		}
 	}
 
-	return b.String(), images, nil
+	return summary, nil
 }
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -192,7 +193,7 @@ func TestChatPrompt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			model := Model{Template: tmpl, ProjectorPaths: []string{"vision"}}
 			opts := api.Options{Runner: api.Runner{NumCtx: tt.limit}}
-			prompt, images, err := chatPrompt(context.TODO(), &model, tokenize, &opts, tt.msgs)
+			prompt, images, _, err := chatPrompt(context.TODO(), &model, tokenize, &opts, tt.msgs, chatOverflow{})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -221,3 +222,202 @@ func TestChatPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestChatPromptOverflow(t *testing.T) {
+	msgs := []api.Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "one two three"},
+		{Role: "assistant", Content: "four five"},
+		{Role: "user", Content: "six seven eight"},
+		{Role: "assistant", Content: "nine"},
+		{Role: "user", Content: "ten eleven"},
+	}
+
+	cases := []struct {
+		name     string
+		strategy string
+		limit    int
+		prompt   string
+		dropped  int
+		err      error
+	}{
+		{
+			name:    "fits",
+			limit:   13,
+			prompt:  "Be brief. one two three four five six seven eight nine ten eleven ",
+			dropped: 0,
+		},
+		{
+			name:     "truncate",
+			strategy: api.OverflowTruncate,
+			limit:    7,
+			prompt:   "Be brief. nine ten eleven ",
+			dropped:  3,
+		},
+		{
+			name:     "middle",
+			strategy: api.OverflowMiddle,
+			limit:    7,
+			prompt:   "Be brief. one two three\n\nten eleven ",
+			dropped:  3,
+		},
+		{
+			name:     "middle fallback",
+			strategy: api.OverflowMiddle,
+			limit:    4,
+			prompt:   "Be brief. ten eleven ",
+			dropped:  4,
+		},
+		{
+			name:     "content",
+			strategy: api.OverflowContent,
+			limit:    11,
+			prompt:   "Be brief. one two three four five six  nine ten eleven ",
+		},
+		{
+			name:     "summarize",
+			strategy: api.OverflowSummarize,
+			limit:    12,
+			prompt:   "Be brief.\n\nSummary of the earlier conversation: short nine ten eleven ",
+			dropped:  3,
+		},
+		{
+			name:     "error",
+			strategy: api.OverflowError,
+			limit:    12,
+			err:      &contextOverflowError{tokens: 13, numCtx: 12},
+		},
+		{
+			name:     "error fits",
+			strategy: api.OverflowError,
+			limit:    13,
+			prompt:   "Be brief. one two three four five six seven eight nine ten eleven ",
+		},
+	}
+
+	tmpl, err := template.Parse("{{ range .Messages }}{{ .Content }} {{ end }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var summarized []api.Message
+			overflow := chatOverflow{
+				strategy: tt.strategy,
+				summarize: func(_ context.Context, msgs []api.Message) (string, error) {
+					summarized = msgs
+					return "short", nil
+				},
+			}
+
+			model := Model{Template: tmpl}
+			opts := api.Options{Runner: api.Runner{NumCtx: tt.limit}}
+			prompt, _, dropped, err := chatPrompt(context.TODO(), &model, tokenize, &opts, msgs, overflow)
+			if diff := cmp.Diff(tt.err, err, cmp.AllowUnexported(contextOverflowError{})); diff != "" {
+				t.Fatalf("error mismatch (-want +got):\n%s", diff)
+			}
+
+			if prompt != tt.prompt {
+				t.Errorf("expected %q, got %q", tt.prompt, prompt)
+			}
+
+			if dropped != tt.dropped {
+				t.Errorf("expected %d dropped, got %d", tt.dropped, dropped)
+			}
+
+			if tt.strategy == api.OverflowSummarize {
+				if diff := cmp.Diff(msgs[1:2], summarized); diff != "" {
+					t.Errorf("summarized mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+
+	if msgs[3].Content != "six seven eight" {
+		t.Errorf("expected messages to be unchanged, got %q", msgs[3].Content)
+	}
+}
+
+func TestSummarizeChunks(t *testing.T) {
+	tmpl, err := template.Parse("{{ range .Messages }}{{ .Content }}{{ end }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := []api.Message{
+		{Role: "user", Content: strings.Repeat("word ", 30)},
+		{Role: "assistant", Content: "one two"},
+		{Role: "user", Content: "three four"},
+	}
+
+	model := Model{Template: tmpl}
+	opts := api.Options{Runner: api.Runner{NumCtx: 40}}
+
+	var prompts []string
+	summary, err := summarizeChunks(context.TODO(), &model, tokenize, &opts, msgs, func(_ context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return fmt.Sprintf("summary%d", len(prompts)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prompts) < 2 {
+		t.Fatalf("expected the messages to be summarized in chunks, got %d", len(prompts))
+	}
+
+	if want := fmt.Sprintf("summary%d", len(prompts)); summary != want {
+		t.Errorf("expected %q, got %q", want, summary)
+	}
+
+	var words int
+	for i, prompt := range prompts {
+		if c := len(strings.Fields(prompt)); c+summaryTokens(&opts) > opts.NumCtx {
+			t.Errorf("prompt %d takes up %d tokens, which doesn't leave room for the summary", i, c)
+		}
+
+		if i > 0 && !strings.Contains(prompt, fmt.Sprintf("so far: summary%d", i)) {
+			t.Errorf("expected prompt %d to continue the previous summary, got %q", i, prompt)
+		}
+
+		words += strings.Count(prompt, "word")
+	}
+
+	if words != 30 {
+		t.Errorf("expected every word to be summarized once, got %d", words)
+	}
+
+	if !strings.Contains(prompts[len(prompts)-1], "three four") {
+		t.Errorf("expected the last message in the last chunk, got %q", prompts[len(prompts)-1])
+	}
+
+	opts.NumCtx = 8
+	if _, err := summarizeChunks(context.TODO(), &model, tokenize, &opts, msgs, nil); err == nil {
+		t.Error("expected an error for a context window too small to summarize in")
+	}
+}
+
+func TestCheckRoles(t *testing.T) {
+	legacy, err := template.Parse("{{ .System }} {{ .Prompt }} {{ .Response }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkRoles(legacy, []api.Message{{Role: "system"}, {Role: "user"}, {Role: "assistant"}}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := checkRoles(legacy, []api.Message{{Role: "user"}, {Role: "tool"}}); err == nil || !strings.Contains(err.Error(), `"tool"`) {
+		t.Errorf("expected an error for the tool message, got %v", err)
+	}
+
+	messages, err := template.Parse("{{ range .Messages }}<|{{ .Role }}|>{{ .Content }}{{ end }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkRoles(messages, []api.Message{{Role: "user"}, {Role: "tool"}}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
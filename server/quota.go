@@ -0,0 +1,292 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+var errStoreFull = errors.New("not enough space in the model store")
+
+// loadedModels returns the model paths of the runners the scheduler has
+// loaded. The models they were loaded from aren't evicted to make room. It
+// is set by InitScheduler.
+var loadedModels = func() []string { return nil }
+
+// isLoaded reports whether a runner is loaded from a blob of m.
+func isLoaded(m *Manifest, loaded []string) bool {
+	for _, layer := range m.Layers {
+		p, err := GetBlobsPath(layer.Digest)
+		if err == nil && slices.Contains(loaded, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPinned reports whether a model is in OLLAMA_PINNED_MODELS.
+func isPinned(name model.Name) bool {
+	return slices.ContainsFunc(envconfig.PinnedModels, func(s string) bool {
+		return strings.EqualFold(model.ParseName(s).String(), name.String())
+	})
+}
+
+var (
+	// storeMu serializes makeRoom, so writes which were each given room don't
+	// fill the store together.
+	storeMu sync.Mutex
+
+	// reserved holds the blobs makeRoom gave room to which are still being
+	// written, by digest.
+	reserved = make(map[string]*reservation)
+)
+
+type reservation struct {
+	size int64
+	refs int
+}
+
+// storeSize returns the size of the blobs in the blobs directory. Partial
+// downloads and staged imports aren't counted, the room for them is
+// reserved by makeRoom until they're written.
+func storeSize() (int64, error) {
+	p, err := GetBlobsPath("")
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if _, err := GetBlobsPath(entry.Name()); err != nil {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		size += fi.Size()
+	}
+
+	return size, nil
+}
+
+// makeRoom evicts the least recently used models until the blobs of manifest
+// which aren't stored yet fit in OLLAMA_MAX_STORE_SIZE, or until the store
+// fits if they are. It is called before a model is pulled, created or
+// imported, and before a blob is uploaded or cached, in which case name isn't
+// valid. The model being written, pinned models and loaded models are never
+// evicted. If the blobs can't fit even after evicting every other model, it
+// fails without evicting any.
+//
+// The room for the missing blobs stays reserved for other calls until the
+// returned release is called, after they're written.
+func makeRoom(name model.Name, manifest *Manifest, fn func(api.ProgressResponse)) (release func(), _ error) {
+	if envconfig.MaxStoreSize <= 0 {
+		return func() {}, nil
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	size, err := storeSize()
+	if err != nil {
+		return nil, err
+	}
+
+	for digest, r := range reserved {
+		p, err := GetBlobsPath(digest)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			size += r.size
+		}
+	}
+
+	needed := make(map[string]bool)
+	var missing int64
+	var reserve []*Layer
+	for _, layer := range append([]*Layer{manifest.Config}, manifest.Layers...) {
+		if needed[layer.Digest] {
+			continue
+		}
+
+		needed[layer.Digest] = true
+
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			reserve = append(reserve, layer)
+			// a blob another write reserved is already counted
+			if _, ok := reserved[layer.Digest]; !ok {
+				missing += layer.Size
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	release = func() {
+		storeMu.Lock()
+		defer storeMu.Unlock()
+
+		for _, layer := range reserve {
+			if r := reserved[layer.Digest]; r.refs > 1 {
+				r.refs--
+			} else {
+				delete(reserved, layer.Digest)
+			}
+		}
+	}
+
+	if err := evict(name, manifest, needed, size, missing, fn); err != nil {
+		return nil, err
+	}
+
+	for _, layer := range reserve {
+		if r, ok := reserved[layer.Digest]; ok {
+			r.refs++
+		} else {
+			reserved[layer.Digest] = &reservation{size: layer.Size, refs: 1}
+		}
+	}
+
+	return release, nil
+}
+
+// evict removes the least recently used models which makeRoom can evict
+// until missing bytes fit next to the size bytes already stored.
+func evict(name model.Name, manifest *Manifest, needed map[string]bool, size, missing int64, fn func(api.ProgressResponse)) error {
+	if size+missing <= envconfig.MaxStoreSize {
+		return nil
+	}
+
+	ms, err := Manifests()
+	if err != nil {
+		return err
+	}
+
+	loaded := loadedModels()
+
+	var candidates []model.Name
+	for n := range ms {
+		if !strings.EqualFold(n.String(), name.String()) && !isPinned(n) && !isLoaded(ms[n], loaded) {
+			candidates = append(candidates, n)
+		}
+	}
+
+	// least recently used first, models which were never used by age
+	slices.SortFunc(candidates, func(a, b model.Name) int {
+		if c := lastUsed(a).Compare(lastUsed(b)); c != 0 {
+			return c
+		}
+
+		return ms[a].fi.ModTime().Compare(ms[b].fi.ModTime())
+	})
+
+	refs, sizes := blobRefs(ms)
+
+	type eviction struct {
+		name  model.Name
+		blobs []string
+	}
+
+	var evictions []eviction
+	var freed int64
+	for _, n := range candidates {
+		if size+missing-freed <= envconfig.MaxStoreSize {
+			break
+		}
+
+		e := eviction{name: n}
+		for _, layer := range append([]*Layer{ms[n].Config}, ms[n].Layers...) {
+			names := refs[layer.Digest]
+			if i := slices.Index(names, n); i >= 0 {
+				refs[layer.Digest] = slices.Delete(names, i, i+1)
+			} else {
+				// already counted
+				continue
+			}
+
+			// blobs other writes reserved room for are kept too, they may be
+			// stored but not referenced by their manifest yet
+			if _, ok := reserved[layer.Digest]; ok || len(refs[layer.Digest]) > 0 || needed[layer.Digest] {
+				continue
+			}
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				return err
+			}
+
+			if _, err := os.Stat(p); err == nil {
+				e.blobs = append(e.blobs, layer.Digest)
+				freed += sizes[layer.Digest]
+			}
+		}
+
+		evictions = append(evictions, e)
+	}
+
+	if size+missing-freed > envconfig.MaxStoreSize {
+		what := name.DisplayShortest()
+		if !name.IsValid() {
+			what = manifest.Config.Digest
+		}
+
+		return fmt.Errorf("%w: %s needs %s more but the store is at %s of %s, and only %s can be freed by removing unpinned models which aren't loaded",
+			errStoreFull, what, format.HumanBytes(missing), format.HumanBytes(size), format.HumanBytes(envconfig.MaxStoreSize), format.HumanBytes(freed))
+	}
+
+	for _, e := range evictions {
+		fn(api.ProgressResponse{Status: fmt.Sprintf("removing least recently used model %s", e.name.DisplayShortest())})
+		slog.Info("removing least recently used model to make room", "model", e.name.DisplayShortest(), "last_used", lastUsed(e.name))
+
+		if err := ms[e.name].Remove(); err != nil {
+			return err
+		}
+
+		forgetModel(e.name)
+
+		for _, digest := range e.blobs {
+			p, err := GetBlobsPath(digest)
+			if err != nil {
+				return err
+			}
+
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			if err := llm.RemovePromptCache(digest); err != nil {
+				slog.Info(fmt.Sprintf("couldn't remove prompt cache for '%s': %v", digest, err))
+			}
+		}
+	}
+
+	return nil
+}
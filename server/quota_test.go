@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestMakeRoom(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	bin := createBinFile(t, nil, nil)
+	for _, name := range []string{"a", "b", "c"} {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      name,
+			Modelfile: fmt.Sprintf("FROM %s\nSYSTEM %s", bin, strings.Repeat(name, 1000)),
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	// c was never used, b was used before a
+	touchModel(model.ParseName("b"))
+	touchModel(model.ParseName("a"))
+
+	exists := func(name string) bool {
+		_, err := ParseNamedManifest(model.ParseName(name))
+		return err == nil
+	}
+
+	// a pull of a model with a single layer which isn't stored
+	pull := &Manifest{
+		Config: &Layer{Digest: "sha256:" + strings.Repeat("0", 64), Size: 100},
+	}
+
+	makeRoomFor := func(t *testing.T, limit int64, pinned ...string) error {
+		t.Helper()
+
+		t.Setenv("OLLAMA_MAX_STORE_SIZE", fmt.Sprint(limit))
+		t.Setenv("OLLAMA_PINNED_MODELS", strings.Join(pinned, ","))
+		envconfig.LoadConfig()
+
+		release, err := makeRoom(model.ParseName("d"), pull, func(api.ProgressResponse) {})
+		if err != nil {
+			return err
+		}
+
+		release()
+		return nil
+	}
+
+	size, err := storeSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		if err := makeRoomFor(t, size+100); err != nil {
+			t.Fatal(err)
+		}
+
+		if !exists("a") || !exists("b") || !exists("c") {
+			t.Errorf("expected no models to be removed")
+		}
+	})
+
+	t.Run("too big", func(t *testing.T) {
+		if err := makeRoomFor(t, 99); !errors.Is(err, errStoreFull) {
+			t.Fatalf("expected errStoreFull, got %v", err)
+		}
+
+		if !exists("a") || !exists("b") || !exists("c") {
+			t.Errorf("expected no models to be removed")
+		}
+	})
+
+	t.Run("least recently used", func(t *testing.T) {
+		m, err := ParseNamedManifest(model.ParseName("c"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := makeRoomFor(t, size+99); err != nil {
+			t.Fatal(err)
+		}
+
+		if !exists("a") || !exists("b") || exists("c") {
+			t.Errorf("expected only c to be removed")
+		}
+
+		for _, layer := range m.Layers {
+			err := verifyBlob(layer.Digest)
+			if layer.MediaType == "application/vnd.ollama.image.model" && err != nil {
+				t.Errorf("expected shared model blob to be kept, got %v", err)
+			} else if layer.MediaType == "application/vnd.ollama.image.system" && !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected system blob to be removed, got %v", err)
+			}
+		}
+	})
+
+	t.Run("pinned", func(t *testing.T) {
+		size, err := storeSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := makeRoomFor(t, size+99, "b"); err != nil {
+			t.Fatal(err)
+		}
+
+		if exists("a") || !exists("b") {
+			t.Errorf("expected a to be removed and pinned b to be kept")
+		}
+	})
+
+	t.Run("loaded", func(t *testing.T) {
+		m, err := ParseNamedManifest(model.ParseName("b"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paths []string
+		for _, layer := range m.Layers {
+			if layer.MediaType == "application/vnd.ollama.image.model" {
+				p, err := GetBlobsPath(layer.Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				paths = append(paths, p)
+			}
+		}
+
+		loadedModels = func() []string { return paths }
+		t.Cleanup(func() { loadedModels = func() []string { return nil } })
+
+		size, err := storeSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := makeRoomFor(t, size+99); !errors.Is(err, errStoreFull) {
+			t.Fatalf("expected errStoreFull, got %v", err)
+		}
+
+		if !exists("b") {
+			t.Errorf("expected loaded b to be kept")
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		size, err := storeSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("OLLAMA_MAX_STORE_SIZE", fmt.Sprint(size+500))
+		t.Setenv("OLLAMA_PINNED_MODELS", "")
+		envconfig.LoadConfig()
+
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      "e",
+			Modelfile: fmt.Sprintf("FROM %s\nSYSTEM %s", bin, strings.Repeat("e", 1000)),
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		if !exists("e") || exists("b") {
+			t.Errorf("expected b to be removed to make room for e")
+		}
+	})
+}
+
+func TestMakeRoomReserved(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_MAX_STORE_SIZE", "150")
+	envconfig.LoadConfig()
+
+	blob := func(c string) *Manifest {
+		return &Manifest{Config: &Layer{Digest: "sha256:" + strings.Repeat(c, 64), Size: 100}}
+	}
+
+	release, err := makeRoom(model.Name{}, blob("0"), func(api.ProgressResponse) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the room for a blob being written is taken until it's released
+	if _, err := makeRoom(model.Name{}, blob("1"), func(api.ProgressResponse) {}); !errors.Is(err, errStoreFull) {
+		t.Fatalf("expected errStoreFull, got %v", err)
+	}
+
+	// writes of the same blob share its room
+	again, err := makeRoom(model.Name{}, blob("0"), func(api.ProgressResponse) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release()
+	if _, err := makeRoom(model.Name{}, blob("1"), func(api.ProgressResponse) {}); !errors.Is(err, errStoreFull) {
+		t.Fatalf("expected errStoreFull while the blob is still being written, got %v", err)
+	}
+
+	again()
+	release, err = makeRoom(model.Name{}, blob("1"), func(api.ProgressResponse) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// rateLimiter limits the throughput of transfers sharing it. Transfers take
+// bytes on credit and wait until the limiter is paid back, so the rate holds
+// over time for reads of any size.
+type rateLimiter struct {
+	// rate returns the limit in bytes per second, 0 for no limit
+	rate func() int64
+
+	// limit holds the rate of limiters made by newRateLimiter
+	limit atomic.Int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	l := &rateLimiter{}
+	l.limit.Store(rate)
+	l.rate = l.limit.Load
+	return l
+}
+
+// lower lowers the rate of a limiter made by newRateLimiter to rate unless
+// it's already lower. A rate of 0 doesn't change the limit.
+func (l *rateLimiter) lower(rate int64) {
+	for {
+		current := l.limit.Load()
+		if rate <= 0 || (current > 0 && current <= rate) {
+			return
+		}
+
+		if l.limit.CompareAndSwap(current, rate) {
+			return
+		}
+	}
+}
+
+var (
+	downloadLimiter = &rateLimiter{rate: func() int64 { return envconfig.MaxDownloadRate }}
+	uploadLimiter   = &rateLimiter{rate: func() int64 { return envconfig.MaxUploadRate }}
+)
+
+// reserve takes n bytes and returns when they are paid back.
+func (l *rateLimiter) reserve(n int) time.Time {
+	rate := l.rate()
+	if rate <= 0 {
+		return time.Time{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	return l.next
+}
+
+// throttledReader limits reads from r to the rate of each of limiters.
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+
+	// onWait, if set, is called with the time a read resumes before waiting
+	onWait func(time.Time)
+}
+
+func (r *throttledReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+
+	var until time.Time
+	for _, l := range r.limiters {
+		if l == nil {
+			continue
+		}
+
+		if t := l.reserve(n); t.After(until) {
+			until = t
+		}
+	}
+
+	if d := time.Until(until); d > 0 {
+		if r.onWait != nil {
+			r.onWait(until)
+		}
+
+		t := time.NewTimer(d)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+	}
+
+	return n, err
+}
+
+// transferParts returns the number of parts of a blob transferred at
+// once.
+func transferParts(parts int) int {
+	if envconfig.TransferParts > 0 {
+		return envconfig.TransferParts
+	}
+
+	return parts
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestThrottledReader(t *testing.T) {
+	t.Run("limited", func(t *testing.T) {
+		r := &throttledReader{
+			ctx:      context.Background(),
+			r:        bytes.NewReader(make([]byte, 300)),
+			limiters: []*rateLimiter{newRateLimiter(1000), nil},
+		}
+
+		start := time.Now()
+		n, err := io.Copy(io.Discard, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != 300 {
+			t.Errorf("expected 300 bytes, got %d", n)
+		}
+
+		if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+			t.Errorf("expected reading 300 bytes at 1000 bytes/s to take about 300ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		r := &throttledReader{
+			ctx:      context.Background(),
+			r:        bytes.NewReader(make([]byte, 1<<20)),
+			limiters: []*rateLimiter{newRateLimiter(0)},
+		}
+
+		start := time.Now()
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected an unlimited read to be fast, took %s", elapsed)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &throttledReader{
+			ctx:      ctx,
+			r:        bytes.NewReader(make([]byte, 100)),
+			limiters: []*rateLimiter{newRateLimiter(1)},
+		}
+
+		time.AfterFunc(50*time.Millisecond, cancel)
+		if _, err := io.Copy(io.Discard, r); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled, got %v", err)
+		}
+	})
+}
+
+func TestRateLimiterLower(t *testing.T) {
+	l := newRateLimiter(0)
+	for _, tt := range []struct {
+		lower, expect int64
+	}{
+		{0, 0},
+		{1000, 1000},
+		{2000, 1000},
+		{0, 1000},
+		{500, 500},
+	} {
+		l.lower(tt.lower)
+		if rate := l.rate(); rate != tt.expect {
+			t.Errorf("lower(%d): expected rate %d, got %d", tt.lower, tt.expect, rate)
+		}
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	r, name, pushed := pushTestModel(t)
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	digest := pushed.Config.Digest
+	blob := r.blobs[digest]
+
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a download interrupted after 10 bytes, with bytes which would corrupt
+	// the blob if they were downloaded again
+	const completed = 10
+	if err := os.WriteFile(p+"-partial", bytes.Repeat([]byte("x"), completed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bts, err := json.Marshal(blobDownloadPart{N: 0, Size: int64(len(blob)), Completed: completed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p+"-partial-0", bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneLayers(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := downloadOpts{
+		mp:      ParseModelPath(name.String()),
+		digest:  digest,
+		regOpts: &registryOptions{},
+		fn:      func(api.ProgressResponse) {},
+	}
+
+	if _, err := downloadBlob(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := append(bytes.Repeat([]byte("x"), completed), blob[completed:]...); !bytes.Equal(downloaded, want) {
+		t.Errorf("expected download to resume after %d bytes, got %q", completed, downloaded)
+	}
+
+	if _, err := os.Stat(p + "-partial-0"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected part file to be removed, got %v", err)
+	}
+}
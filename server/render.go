@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/template"
+)
+
+// RenderTemplateHandler renders a chat with a model's template, returning
+// the prompt ChatHandler would give the model without generating a response.
+func (s *Server) RenderTemplateHandler(c *gin.Context) {
+	var req api.RenderTemplateRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Messages) == 0 && req.System == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "messages are required"})
+		return
+	}
+
+	if err := checkOverflow(req.Overflow); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tmpl *template.Template
+	if req.Template != "" {
+		var err error
+		if tmpl, err = template.Parse(req.Template); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), req.Model, []Capability{CapabilityCompletion}, req.Options, req.KeepAlive)
+	if errors.Is(err, errCapabilityCompletion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
+		return
+	} else if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	if tmpl != nil {
+		// the model is shared with the scheduler so it's copied
+		mm := *m
+		mm.Template = tmpl
+		m = &mm
+	}
+
+	msgs := req.Messages
+	if req.System != "" {
+		msgs = append([]api.Message{{Role: "system", Content: req.System}}, msgs...)
+	}
+
+	// the roles a template renders may only be guessed, so the chat isn't
+	// rejected if they don't match
+	if err := checkRoles(m.Template, msgs); err != nil {
+		slog.Warn("messages may be left out of the prompt", "model", req.Model, "error", err)
+	}
+
+	overflow := chatOverflow{strategy: req.Overflow, summarize: summarizer(r, m, opts)}
+	resp, err := renderTemplate(c.Request.Context(), m, r.Tokenize, opts, msgs, overflow)
+	var oerr *contextOverflowError
+	if errors.As(err, &oerr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "prompt_tokens": oerr.tokens, "num_ctx": oerr.numCtx})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// renderTemplate renders msgs into a prompt as chatPrompt does, reporting
+// how the template was executed and what was truncated.
+func renderTemplate(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, overflow chatOverflow) (*api.RenderTemplateResponse, error) {
+	prompt, images, dropped, err := chatPrompt(ctx, m, tokenize, opts, msgs, overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenize(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := "legacy"
+	if slices.Contains(m.Template.Vars(), "messages") {
+		mode = "messages"
+	}
+
+	return &api.RenderTemplateResponse{
+		Prompt:       prompt,
+		Mode:         mode,
+		Messages:     len(msgs) - dropped,
+		Dropped:      dropped,
+		Images:       len(images),
+		PromptTokens: len(tokens),
+		NumCtx:       opts.NumCtx,
+	}, nil
+}
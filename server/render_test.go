@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/template"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	msgs := []api.Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "You're a test, Harry!"},
+		{Role: "assistant", Content: "I-I'm a what?"},
+		{Role: "user", Content: "A test.", Images: []api.ImageData{[]byte("something")}},
+	}
+
+	cases := []struct {
+		name     string
+		template string
+		limit    int
+		expect   api.RenderTemplateResponse
+	}{
+		{
+			name:     "legacy",
+			template: "{{ if .System }}{{ .System }} {{ end }}{{ if .Prompt }}{{ .Prompt }} {{ end }}{{ if .Response }}{{ .Response }} {{ end }}",
+			limit:    2048,
+			expect: api.RenderTemplateResponse{
+				Prompt:       "Be brief. You're a test, Harry! I-I'm a what? [img-0] A test. ",
+				Mode:         "legacy",
+				Messages:     4,
+				Images:       1,
+				PromptTokens: 12,
+				NumCtx:       2048,
+			},
+		},
+		{
+			name:     "messages",
+			template: "{{ range .Messages }}<{{ .Role }}>{{ .Content }} {{ end }}",
+			limit:    2048,
+			expect: api.RenderTemplateResponse{
+				Prompt:       "<system>Be brief. <user>You're a test, Harry! <assistant>I-I'm a what? <user>[img-0] A test. ",
+				Mode:         "messages",
+				Messages:     4,
+				Images:       1,
+				PromptTokens: 12,
+				NumCtx:       2048,
+			},
+		},
+		{
+			name:     "truncated",
+			template: "{{ range .Messages }}<{{ .Role }}>{{ .Content }} {{ end }}",
+			limit:    775,
+			expect: api.RenderTemplateResponse{
+				Prompt:       "<system>Be brief. <user>[img-0] A test. ",
+				Mode:         "messages",
+				Messages:     2,
+				Dropped:      2,
+				Images:       1,
+				PromptTokens: 5,
+				NumCtx:       775,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := Model{Template: tmpl, ProjectorPaths: []string{"vision"}}
+			opts := api.Options{Runner: api.Runner{NumCtx: tt.limit}}
+			resp, err := renderTemplate(context.TODO(), &m, tokenize, &opts, msgs, chatOverflow{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.expect, *resp); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
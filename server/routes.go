@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/netip"
@@ -76,21 +77,28 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []Capabil
 		return nil, nil, nil, fmt.Errorf("model %w", errRequired)
 	}
 
-	model, err := GetModel(name)
+	m, err := GetModel(name)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	if err := model.CheckCapabilities(caps...); err != nil {
+	if err := m.CheckCapabilities(caps...); err != nil {
 		return nil, nil, nil, fmt.Errorf("%s %w", name, err)
 	}
 
-	opts, err := modelOptions(model, requestOpts)
+	opts, err := modelOptions(m, requestOpts)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	runnerCh, errCh := s.sched.GetRunner(ctx, model, opts, keepAlive)
+	// OLLAMA_KV_CACHE_TYPE is validated when the server starts
+	if opts.KVCacheType != "" {
+		if err := llm.ValidateKVCacheType(llm.KVCacheType(opts)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	runnerCh, errCh := s.sched.GetRunner(ctx, m, opts, keepAlive)
 	var runner *runnerRef
 	select {
 	case runner = <-runnerCh:
@@ -98,7 +106,8 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []Capabil
 		return nil, nil, nil, err
 	}
 
-	return runner.llama, model, &opts, nil
+	touchModel(model.ParseName(m.Name))
+	return runner.llama, m, &opts, nil
 }
 
 func (s *Server) GenerateHandler(c *gin.Context) {
@@ -130,6 +139,12 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	adapters, err := m.ActiveAdapters(req.Adapters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	checkpointLoaded := time.Now()
 
 	if req.Prompt == "" {
@@ -198,10 +213,12 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		var sb strings.Builder
 		defer close(ch)
 		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:  prompt,
-			Images:  images,
-			Format:  req.Format,
-			Options: opts,
+			Prompt:   prompt,
+			Images:   images,
+			Format:   req.Format,
+			Options:  opts,
+			Session:  req.Session,
+			Adapters: adapters,
 		}, func(cr llm.CompletionResponse) {
 			res := api.GenerateResponse{
 				Model:      req.Model,
@@ -211,9 +228,12 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 				DoneReason: cr.DoneReason,
 				Metrics: api.Metrics{
 					PromptEvalCount:    cr.PromptEvalCount,
+					PromptCachedCount:  cr.PromptCachedCount,
 					PromptEvalDuration: cr.PromptEvalDuration,
 					EvalCount:          cr.EvalCount,
 					EvalDuration:       cr.EvalDuration,
+					DraftCount:         cr.DraftCount,
+					DraftAcceptedCount: cr.DraftAcceptedCount,
 				},
 			}
 
@@ -335,6 +355,7 @@ func (s *Server) PullModelHandler(c *gin.Context) {
 
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			MaxRate:  req.MaxRate,
 		}
 
 		ctx, cancel := context.WithCancel(c.Request.Context())
@@ -353,6 +374,57 @@ func (s *Server) PullModelHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+func (s *Server) VerifyModelHandler(c *gin.Context) {
+	var req api.VerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var name model.Name
+	if req.Model != "" {
+		name = model.ParseName(req.Model)
+		if !name.IsValid() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid model name"})
+			return
+		}
+
+		if _, err := ParseNamedManifest(name); errors.Is(err, os.ErrNotExist) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+		fn := func(r api.VerifyResponse) {
+			ch <- r
+		}
+
+		regOpts := &registryOptions{
+			Insecure: req.Insecure,
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		if err := VerifyModels(ctx, name, req.Repair, regOpts, fn); err != nil {
+			ch <- gin.H{"error": err.Error()}
+		}
+	}()
+
+	if req.Stream != nil && !*req.Stream {
+		waitForStream(c, ch)
+		return
+	}
+
+	streamResponse(c, ch)
+}
+
 func (s *Server) PushModelHandler(c *gin.Context) {
 	var req api.PushRequest
 	err := c.ShouldBindJSON(&req)
@@ -384,6 +456,8 @@ func (s *Server) PushModelHandler(c *gin.Context) {
 
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Sign:     req.Sign,
+			MaxRate:  req.MaxRate,
 		}
 
 		ctx, cancel := context.WithCancel(c.Request.Context())
@@ -438,27 +512,43 @@ func (s *Server) CreateModelHandler(c *gin.Context) {
 		return
 	}
 
-	if r.Path == "" && r.Modelfile == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "path or modelfile are required"})
+	if r.Path == "" && r.Modelfile == "" && r.Spec == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "path, modelfile or spec are required"})
 		return
 	}
 
-	var sr io.Reader = strings.NewReader(r.Modelfile)
-	if r.Path != "" && r.Modelfile == "" {
-		f, err := os.Open(r.Path)
+	if r.Spec != nil && r.Modelfile != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "modelfile and spec are mutually exclusive"})
+		return
+	}
+
+	var f *parser.File
+	if r.Spec != nil {
+		var err error
+		f, err = parser.ParseSpec(*r.Spec)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error reading modelfile: %s", err)})
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		defer f.Close()
+	} else {
+		var sr io.Reader = strings.NewReader(r.Modelfile)
+		if r.Path != "" && r.Modelfile == "" {
+			file, err := os.Open(r.Path)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error reading modelfile: %s", err)})
+				return
+			}
+			defer file.Close()
 
-		sr = f
-	}
+			sr = file
+		}
 
-	f, err := parser.ParseFile(sr)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		var err error
+		f, err = parser.ParseFileWithOptions(sr, parser.ParseOptions{Dir: filepath.Dir(r.Path)})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	ch := make(chan any)
@@ -485,6 +575,38 @@ func (s *Server) CreateModelHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+func (s *Server) LintHandler(c *gin.Context) {
+	var r api.LintRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if r.Path == "" && r.Modelfile == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "path or modelfile are required"})
+		return
+	}
+
+	var sr io.Reader = strings.NewReader(r.Modelfile)
+	if r.Path != "" && r.Modelfile == "" {
+		f, err := os.Open(r.Path)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error reading modelfile: %s", err)})
+			return
+		}
+		defer f.Close()
+
+		sr = f
+	}
+
+	resp := api.LintResponse{Diagnostics: []api.Diagnostic{}}
+	resp.Diagnostics = append(resp.Diagnostics, LintModelfile(c.Request.Context(), sr, filepath.Dir(r.Path), r.Vars)...)
+	c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) DeleteModelHandler(c *gin.Context) {
 	var r api.DeleteRequest
 	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
@@ -501,6 +623,15 @@ func (s *Server) DeleteModelHandler(c *gin.Context) {
 		return
 	}
 
+	if !hasManifest(n) {
+		if ok, err := DeleteAlias(n); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		} else if ok {
+			return
+		}
+	}
+
 	m, err := ParseNamedManifest(n)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -516,6 +647,18 @@ func (s *Server) DeleteModelHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	forgetModel(n)
+
+	var resp api.DeleteResponse
+	if aliases, err := aliasesOf(n); err == nil {
+		for _, alias := range aliases {
+			slog.Warn("alias points at a deleted model", "alias", alias.DisplayShortest(), "model", n.DisplayShortest())
+			resp.Aliases = append(resp.Aliases, alias.DisplayShortest())
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 func (s *Server) ShowModelHandler(c *gin.Context) {
@@ -632,6 +775,12 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 	fmt.Fprint(&sb, m.String())
 	resp.Modelfile = sb.String()
 
+	// models created by older versions may have parameters which no longer
+	// exist, which shouldn't stop the rest of the model being shown
+	if resp.Spec, err = m.modelfile().Spec(); err != nil {
+		slog.Warn("couldn't convert model to a spec", "model", req.Model, "error", err)
+	}
+
 	kvData, err := getKVData(m.ModelPath, req.Verbose)
 	if err != nil {
 		return nil, err
@@ -674,6 +823,59 @@ func getKVData(digest string, verbose bool) (llm.KV, error) {
 	return kv, nil
 }
 
+func (s *Server) GCHandler(c *gin.Context) {
+	var req api.GCRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := CollectGarbage(req.DryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) DiffHandler(c *gin.Context) {
+	var req api.DiffRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.From == "" || req.To == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "from and to are required"})
+		return
+	}
+
+	resp, err := DiffModels(req.From, req.To)
+	if errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) DiskUsageHandler(c *gin.Context) {
+	resp, err := DiskUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) ListModelsHandler(c *gin.Context) {
 	ms, err := Manifests()
 	if err != nil {
@@ -681,23 +883,20 @@ func (s *Server) ListModelsHandler(c *gin.Context) {
 		return
 	}
 
-	models := []api.ListModelResponse{}
-	for n, m := range ms {
+	listModel := func(n model.Name, m *Manifest) (api.ListModelResponse, error) {
 		f, err := m.Config.Open()
 		if err != nil {
-			slog.Warn("bad manifest filepath", "name", n, "error", err)
-			continue
+			return api.ListModelResponse{}, err
 		}
 		defer f.Close()
 
 		var cf ConfigV2
 		if err := json.NewDecoder(f).Decode(&cf); err != nil {
-			slog.Warn("bad manifest config", "name", n, "error", err)
-			continue
+			return api.ListModelResponse{}, err
 		}
 
 		// tag should never be masked
-		models = append(models, api.ListModelResponse{
+		resp := api.ListModelResponse{
 			Model:      n.DisplayShortest(),
 			Name:       n.DisplayShortest(),
 			Size:       m.Size(),
@@ -710,7 +909,49 @@ func (s *Server) ListModelsHandler(c *gin.Context) {
 				ParameterSize:     cf.ModelType,
 				QuantizationLevel: cf.FileType,
 			},
-		})
+		}
+
+		if t := lastUsed(n); !t.IsZero() {
+			resp.LastUsedAt = &t
+		}
+
+		return resp, nil
+	}
+
+	models := []api.ListModelResponse{}
+	for n, m := range ms {
+		lm, err := listModel(n, m)
+		if err != nil {
+			slog.Warn("bad manifest", "name", n, "error", err)
+			continue
+		}
+
+		models = append(models, lm)
+	}
+
+	aliases, err := Aliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, a := range aliases {
+		m, ok := ms[a.Target]
+		if !ok || hasManifest(a.Name) {
+			// dangling or shadowed by a model with the same name
+			continue
+		}
+
+		lm, err := listModel(a.Target, m)
+		if err != nil {
+			slog.Warn("bad manifest", "name", a.Target, "error", err)
+			continue
+		}
+
+		lm.Model = a.Name.DisplayShortest()
+		lm.Name = a.Name.DisplayShortest()
+		lm.Target = a.Target.DisplayShortest()
+		models = append(models, lm)
 	}
 
 	slices.SortStableFunc(models, func(i, j api.ListModelResponse) int {
@@ -755,6 +996,250 @@ func (s *Server) CopyModelHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) AliasHandler(c *gin.Context) {
+	var r api.AliasRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(r.Name)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name %q is invalid", r.Name)})
+		return
+	}
+
+	target := model.ParseName(r.Target)
+	if !target.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("target %q is invalid", r.Target)})
+		return
+	}
+
+	if err := CreateAlias(name, target); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Target)})
+	} else if errors.Is(err, errAliasIsModel) || errors.Is(err, errAliasSelf) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (s *Server) ListAliasesHandler(c *gin.Context) {
+	aliases, err := Aliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.AliasesResponse{Aliases: []api.AliasResponse{}}
+	for _, a := range aliases {
+		resp.Aliases = append(resp.Aliases, api.AliasResponse{
+			Name:    a.Name.DisplayShortest(),
+			Target:  a.Target.DisplayShortest(),
+			Missing: !hasManifest(a.Target),
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) CreateSessionHandler(c *gin.Context) {
+	var r api.CreateSessionRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(r.Model)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q is invalid", r.Model)})
+		return
+	}
+
+	if _, err := GetModel(r.Model); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Model)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := CreateSession(name.DisplayShortest(), r.Options, r.Messages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (s *Server) ListSessionsHandler(c *gin.Context) {
+	sessions, err := Sessions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.SessionsResponse{Sessions: []api.SessionSummary{}}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, api.SessionSummary{
+			ID:         session.ID,
+			Model:      session.Model,
+			Messages:   len(session.Messages),
+			Parent:     session.Parent,
+			CreatedAt:  session.CreatedAt,
+			ModifiedAt: session.ModifiedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) GetSessionHandler(c *gin.Context) {
+	session, err := GetSession(c.Param("id"))
+	if errors.Is(err, errSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("session %q not found", c.Param("id"))})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (s *Server) AppendSessionHandler(c *gin.Context) {
+	var r api.AppendSessionRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(r.Messages) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "messages are required"})
+		return
+	}
+
+	session, err := AppendSession(c.Param("id"), r.Messages)
+	if errors.Is(err, errSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("session %q not found", c.Param("id"))})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (s *Server) ForkSessionHandler(c *gin.Context) {
+	// the request is optional, forking the whole history by default
+	var r api.ForkSessionRequest
+	if err := c.ShouldBindJSON(&r); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := ForkSession(c.Param("id"), r.Messages)
+	if errors.Is(err, errSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("session %q not found", c.Param("id"))})
+		return
+	} else if errors.Is(err, errSessionFork) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (s *Server) DeleteSessionHandler(c *gin.Context) {
+	if err := DeleteSession(c.Param("id")); errors.Is(err, errSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("session %q not found", c.Param("id"))})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (s *Server) ExportModelHandler(c *gin.Context) {
+	var r api.ExportRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(r.Model)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q is invalid", r.Model)})
+		return
+	}
+
+	if _, err := ParseNamedManifest(name); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Model)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Status(http.StatusOK)
+
+	// the status has been sent, errors can only end the tarball early
+	if err := ExportModel(name, c.Writer); err != nil {
+		slog.Error("export failed", "model", name.DisplayShortest(), "error", err)
+	}
+}
+
+func (s *Server) ImportModelHandler(c *gin.Context) {
+	var name model.Name
+	if n := c.Query("name"); n != "" {
+		name = model.ParseName(n)
+		if !name.IsValid() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name %q is invalid", n)})
+			return
+		}
+
+		if err := checkNameExists(name); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	names, err := ImportModel(c.Request.Body, name)
+	if errors.Is(err, errInvalidLayout) || errors.Is(err, errDigestMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, errStoreFull) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resp api.ImportResponse
+	for _, n := range names {
+		resp.Models = append(resp.Models, n.DisplayShortest())
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) HeadBlobHandler(c *gin.Context) {
 	path, err := GetBlobsPath(c.Param("digest"))
 	if err != nil {
@@ -808,6 +1293,19 @@ func (s *Server) CreateBlobHandler(c *gin.Context) {
 		return
 	}
 
+	if c.Request.ContentLength > 0 {
+		blob := &Manifest{Config: &Layer{Digest: c.Param("digest"), Size: c.Request.ContentLength}}
+		release, err := makeRoom(model.Name{}, blob, func(api.ProgressResponse) {})
+		if errors.Is(err, errStoreFull) {
+			c.AbortWithStatusJSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer release()
+	}
+
 	layer, err := NewLayer(c.Request.Body, "")
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -926,15 +1424,40 @@ func (s *Server) GenerateRoutes() http.Handler {
 	r.POST("/api/pull", s.PullModelHandler)
 	r.POST("/api/generate", s.GenerateHandler)
 	r.POST("/api/chat", s.ChatHandler)
+	r.POST("/api/template/render", s.RenderTemplateHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
 	r.POST("/api/create", s.CreateModelHandler)
+	r.POST("/api/lint", s.LintHandler)
 	r.POST("/api/push", s.PushModelHandler)
+	r.POST("/api/verify", s.VerifyModelHandler)
+	r.POST("/api/gc", s.GCHandler)
+	r.POST("/api/diff", s.DiffHandler)
 	r.POST("/api/copy", s.CopyModelHandler)
+	r.POST("/api/alias", s.AliasHandler)
+	r.GET("/api/aliases", s.ListAliasesHandler)
+	r.POST("/api/sessions", s.CreateSessionHandler)
+	r.GET("/api/sessions", s.ListSessionsHandler)
+	r.GET("/api/sessions/:id", s.GetSessionHandler)
+	r.POST("/api/sessions/:id/messages", s.AppendSessionHandler)
+	r.POST("/api/sessions/:id/fork", s.ForkSessionHandler)
+	r.DELETE("/api/sessions/:id", s.DeleteSessionHandler)
+	r.POST("/api/export", s.ExportModelHandler)
+	r.POST("/api/import", s.ImportModelHandler)
 	r.DELETE("/api/delete", s.DeleteModelHandler)
 	r.POST("/api/show", s.ShowModelHandler)
 	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
 	r.HEAD("/api/blobs/:digest", s.HeadBlobHandler)
 	r.GET("/api/ps", s.ProcessHandler)
+	r.GET("/api/du", s.DiskUsageHandler)
+
+	if envconfig.RegistryCache {
+		// Pull-through cache for other Ollama servers
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			r.Handle(method, "/v2/", s.RegistryPingHandler)
+			r.Handle(method, "/v2/:namespace/:model/manifests/:tag", s.RegistryManifestHandler)
+			r.Handle(method, "/v2/:namespace/:model/blobs/:digest", s.RegistryBlobHandler)
+		}
+	}
 
 	// Compatibility endpoints
 	r.POST("/v1/chat/completions", openai.ChatMiddleware(), s.ChatHandler)
@@ -978,6 +1501,12 @@ func Serve(ln net.Listener) error {
 
 	slog.SetDefault(slog.New(handler))
 
+	if envconfig.KVCacheType != "" {
+		if err := llm.ValidateKVCacheType(envconfig.KVCacheType); err != nil {
+			return fmt.Errorf("OLLAMA_KV_CACHE_TYPE: %w", err)
+		}
+	}
+
 	blobsDir, err := GetBlobsPath("")
 	if err != nil {
 		return err
@@ -1064,6 +1593,11 @@ func waitForStream(c *gin.Context, ch chan interface{}) {
 				c.JSON(http.StatusOK, r)
 				return
 			}
+		case api.VerifyResponse:
+			if r.Status == "success" {
+				c.JSON(http.StatusOK, r)
+				return
+			}
 		case gin.H:
 			if errorMsg, ok := r["error"].(string); ok {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
@@ -1127,6 +1661,10 @@ func (s *Server) ProcessHandler(c *gin.Context) {
 			Details:   modelDetails,
 			ExpiresAt: v.expiresAt,
 		}
+		if v.llama != nil {
+			mr.PromptCache = v.llama.PromptCacheStats()
+			mr.Draft = v.llama.DraftStats()
+		}
 		// The scheduler waits to set expiresAt, so if a model is loading it's
 		// possible that it will be set to the unix epoch. For those cases, just
 		// calculate the time w/ the sessionDuration instead.
@@ -1158,6 +1696,33 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	if err := checkOverflow(req.Overflow); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// a stored session supplies the history and defaults for the chat, other
+	// session identifiers only route the request to a runner slot
+	msgs := req.Messages
+	session, err := GetSession(req.Session)
+	if err != nil && !errors.Is(err, errSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if session != nil {
+		if req.Model == "" {
+			req.Model = session.Model
+		}
+
+		options := maps.Clone(session.Options)
+		if options == nil {
+			options = make(map[string]any)
+		}
+
+		maps.Copy(options, req.Options)
+		req.Options = options
+		msgs = append(slices.Clone(session.Messages), req.Messages...)
+	}
+
 	caps := []Capability{CapabilityCompletion}
 	r, m, opts, err := s.scheduleRunner(c.Request.Context(), req.Model, caps, req.Options, req.KeepAlive)
 	if errors.Is(err, errCapabilityCompletion) {
@@ -1168,6 +1733,12 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	adapters, err := m.ActiveAdapters(req.Adapters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	checkpointLoaded := time.Now()
 
 	if len(req.Messages) == 0 {
@@ -1181,23 +1752,38 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
-	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, req.Messages)
-	if err != nil {
+	// the roles a template renders may only be guessed, so the chat isn't
+	// rejected if they don't match
+	if err := checkRoles(m.Template, msgs); err != nil {
+		slog.Warn("messages may be left out of the prompt", "model", req.Model, "error", err)
+	}
+
+	overflow := chatOverflow{strategy: req.Overflow, summarize: summarizer(r, m, opts)}
+	prompt, images, dropped, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, overflow)
+	var oerr *contextOverflowError
+	if errors.As(err, &oerr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "prompt_tokens": oerr.tokens, "num_ctx": oerr.numCtx})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	slog.Debug("chat request", "images", len(images), "prompt", prompt)
+	slog.Debug("chat request", "images", len(images), "dropped", dropped, "prompt", prompt)
 
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
+		var content strings.Builder
 		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:  prompt,
-			Images:  images,
-			Format:  req.Format,
-			Options: opts,
+			Prompt:   prompt,
+			Images:   images,
+			Format:   req.Format,
+			Options:  opts,
+			Session:  req.Session,
+			Adapters: adapters,
 		}, func(r llm.CompletionResponse) {
+			content.WriteString(r.Content)
 			res := api.ChatResponse{
 				Model:      req.Model,
 				CreatedAt:  time.Now().UTC(),
@@ -1206,15 +1792,27 @@ func (s *Server) ChatHandler(c *gin.Context) {
 				DoneReason: r.DoneReason,
 				Metrics: api.Metrics{
 					PromptEvalCount:    r.PromptEvalCount,
+					PromptCachedCount:  r.PromptCachedCount,
 					PromptEvalDuration: r.PromptEvalDuration,
 					EvalCount:          r.EvalCount,
 					EvalDuration:       r.EvalDuration,
+					DraftCount:         r.DraftCount,
+					DraftAcceptedCount: r.DraftAcceptedCount,
 				},
 			}
 
 			if r.Done {
 				res.TotalDuration = time.Since(checkpointStart)
 				res.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				res.DroppedMessages = dropped
+
+				if session != nil {
+					turn := append(slices.Clone(req.Messages), api.Message{Role: "assistant", Content: content.String()})
+					if _, err := AppendSession(session.ID, turn); err != nil {
+						ch <- gin.H{"error": fmt.Sprintf("recording the response in session %q: %v", session.ID, err)}
+						return
+					}
+				}
 			}
 
 			ch <- res
@@ -1255,7 +1853,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 func handleScheduleError(c *gin.Context, name string, err error) {
 	switch {
-	case errors.Is(err, errRequired):
+	case errors.Is(err, errRequired), errors.Is(err, llm.ErrKVCacheType), errors.Is(err, llm.ErrRopeOptions):
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	case errors.Is(err, context.Canceled):
 		c.JSON(499, gin.H{"error": "request canceled"})
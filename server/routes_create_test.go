@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,12 +12,15 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/template"
 )
 
 var stream bool = false
@@ -545,10 +549,20 @@ func TestCreateDetectTemplate(t *testing.T) {
 		}
 
 		checkFileExists(t, filepath.Join(p, "blobs", "*"), []string{
+			filepath.Join(p, "blobs", "sha256-0d79f567714c62c048378f2107fb332dabee0135d080c302d884317da9433cc5"),
 			filepath.Join(p, "blobs", "sha256-553c4a3f747b3d22a4946875f1cc8ed011c2930d83f864a0c7265f9ec0a20413"),
 			filepath.Join(p, "blobs", "sha256-c608dc615584cd20d9d830363dabf8a4783ae5d34245c3d8c115edb3bc7b28e4"),
-			filepath.Join(p, "blobs", "sha256-f836ee110db21567f826332e4cedd746c06d10664fd5a9ea3659e3683a944510"),
+			filepath.Join(p, "blobs", "sha256-ea34c57ba5b78b740aafe2aeb74dc6507fc3ad14170b64c26a04fb9e36c88d75"),
 		})
+
+		m, err := GetModel("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]any{"<|end|>", "<|system|>", "<|user|>", "<|assistant|>"}, m.Options["stop"]); diff != "" {
+			t.Errorf("stop mismatch (-want +got):\n%s", diff)
+		}
 	})
 
 	t.Run("unmatched", func(t *testing.T) {
@@ -567,4 +581,296 @@ func TestCreateDetectTemplate(t *testing.T) {
 			filepath.Join(p, "blobs", "sha256-ca239d7bd8ea90e4a5d2e6bf88f8d74a47b14336e73eb4e18bed4dd325018116"),
 		})
 	})
+
+	t.Run("converted", func(t *testing.T) {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name: "converted",
+			Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{
+				"tokenizer.chat_template": "{% for message in messages %}{% if message['role'] == 'user' %}{{ 'Q: ' + message['content'] + '\n' }}{% else %}{{ 'A: ' + message['content'] + '\n' }}{% endif %}{% endfor %}{% if add_generation_prompt %}{{ 'A:' }}{% endif %}",
+			}, nil)),
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		m, err := GetModel("converted")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		if err := m.Template.Execute(&b, template.Values{Messages: []api.Message{{Role: "user", Content: "Hello"}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.String() != "Q: Hello\nA:" {
+			t.Errorf("expected %q, got %q", "Q: Hello\nA:", b.String())
+		}
+	})
+
+	t.Run("converted eos", func(t *testing.T) {
+		// real vocabularies are larger than the arrays decoded by default
+		tokens := make([]string, 2000)
+		for i := range tokens {
+			tokens[i] = fmt.Sprintf("<%d>", i)
+		}
+
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name: "eos",
+			Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{
+				"tokenizer.chat_template":     "{% for message in messages %}{{ 'Q: ' + message['content'] + eos_token }}{% endfor %}",
+				"tokenizer.ggml.tokens":       tokens,
+				"tokenizer.ggml.eos_token_id": uint32(1500),
+			}, nil)),
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		m, err := GetModel("eos")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		if err := m.Template.Execute(&b, template.Values{Messages: []api.Message{{Role: "user", Content: "Hello"}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.String() != "Q: Hello<1500>" {
+			t.Errorf("expected %q, got %q", "Q: Hello<1500>", b.String())
+		}
+	})
+}
+
+func TestCreateDraft(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "draft",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{"general.architecture": "draft"}, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	draft, err := GetModel("draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s\nDRAFT draft", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.DraftPath != draft.ModelPath {
+		t.Fatalf("expected draft path %s, actual %s", draft.ModelPath, m.DraftPath)
+	}
+
+	if m.ModelPath == m.DraftPath {
+		t.Fatal("expected model and draft to differ")
+	}
+
+	// a model created from test inherits its draft
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test2",
+		Modelfile: "FROM test\nSYSTEM hello",
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err = GetModel("test2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.DraftPath != draft.ModelPath {
+		t.Fatalf("expected draft path %s, actual %s", draft.ModelPath, m.DraftPath)
+	}
+}
+
+func TestCreateAdapters(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	a := createBinFile(t, llm.KV{"general.type": "adapter", "general.name": "a"}, nil)
+	b := createBinFile(t, llm.KV{"general.type": "adapter", "general.name": "b"}, nil)
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s\nADAPTER %s name=a scale=0.5\nADAPTER %s", createBinFile(t, nil, nil), a, b),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Adapters) != 2 {
+		t.Fatalf("expected 2 adapters, actual %d", len(m.Adapters))
+	}
+
+	pathA, pathB := m.Adapters[0].Path, m.Adapters[1].Path
+	if diff := cmp.Diff([]Adapter{{Name: "a", Path: pathA, Scale: 0.5}, {Path: pathB, Scale: 1}}, m.Adapters); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	cases := []struct {
+		selected map[string]float32
+		expect   []llm.Adapter
+	}{
+		{nil, []llm.Adapter{{Path: pathA, Scale: 0.5}, {Path: pathB, Scale: 1}}},
+		{map[string]float32{}, []llm.Adapter{{Path: pathB, Scale: 1}}},
+		{map[string]float32{"a": 0}, []llm.Adapter{{Path: pathA, Scale: 0.5}, {Path: pathB, Scale: 1}}},
+		{map[string]float32{"a": 0.75}, []llm.Adapter{{Path: pathA, Scale: 0.75}, {Path: pathB, Scale: 1}}},
+	}
+
+	for _, tt := range cases {
+		adapters, err := m.ActiveAdapters(tt.selected)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tt.expect, adapters); diff != "" {
+			t.Errorf("%v: mismatch (-want +got):\n%s", tt.selected, diff)
+		}
+	}
+
+	if _, err := m.ActiveAdapters(map[string]float32{"c": 1}); !errors.Is(err, errUnknownAdapter) {
+		t.Errorf("expected errUnknownAdapter, got %v", err)
+	}
+
+	// a model created from test inherits its adapters and can rename them
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test2",
+		Modelfile: fmt.Sprintf("FROM test\nADAPTER %s name=b", b),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err = GetModel("test2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]Adapter{{Name: "a", Path: pathA, Scale: 0.5}, {Name: "b", Path: pathB, Scale: 1}}, m.Adapters); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test3",
+		Modelfile: fmt.Sprintf("FROM test\nADAPTER %s name=a", b),
+		Stream:    &stream,
+	})
+
+	if w.Code == http.StatusOK {
+		t.Fatal("expected duplicate adapter name to fail")
+	}
+
+	// the runner can't load legacy ggla adapters
+	ggla := filepath.Join(t.TempDir(), "adapter.bin")
+	if err := os.WriteFile(ggla, binary.LittleEndian.AppendUint32(nil, llm.FILE_MAGIC_GGLA), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test4",
+		Modelfile: fmt.Sprintf("FROM test\nADAPTER %s", ggla),
+		Stream:    &stream,
+	})
+
+	if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), llm.ErrLegacyAdapter.Error()) {
+		t.Fatalf("expected ggla adapter to fail, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateFromSpec(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+
+	spec := api.ModelSpec{
+		From:       createBinFile(t, llm.KV{"general.architecture": "test"}, nil),
+		Template:   "{{ .System }} {{ .Prompt }}",
+		System:     "You are a helpful assistant.",
+		Parameters: map[string]any{"temperature": 0.5, "stop": []any{"<|end|>", "<|user|>"}},
+		Messages:   []api.Message{{Role: "user", Content: "hello"}, {Role: "assistant", Content: "hi"}},
+		License:    []string{"MIT"},
+	}
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:   "test",
+		Spec:   &spec,
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Name: "test"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Spec == nil {
+		t.Fatal("expected a spec")
+	}
+
+	// the model is created from a blob, rather than the file
+	spec.From = resp.Spec.From
+	spec.Parameters = map[string]any{"temperature": 0.5, "stop": []any{"<|end|>", "<|user|>"}}
+	if diff := cmp.Diff(spec, *resp.Spec); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test2",
+		Modelfile: "FROM test",
+		Spec:      &spec,
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code 400, actual %d", w.Code)
+	}
 }
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -40,7 +42,7 @@ type Scheduler struct {
 	loadedMu sync.Mutex
 
 	loadFn       func(req *LlmRequest, ggml *llm.GGML, gpus gpu.GpuInfoList, numParallel int)
-	newServerFn  func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error)
+	newServerFn  func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, draft string, opts api.Options, numParallel int) (llm.LlamaServer, error)
 	getGpuFn     func() gpu.GpuInfoList
 	getCpuFn     func() gpu.GpuInfoList
 	reschedDelay time.Duration
@@ -71,9 +73,23 @@ func InitScheduler(ctx context.Context) *Scheduler {
 		reschedDelay:  250 * time.Millisecond,
 	}
 	sched.loadFn = sched.load
+	loadedModels = sched.loadedModelPaths
 	return sched
 }
 
+// loadedModelPaths returns the model paths of the loaded runners.
+func (s *Scheduler) loadedModelPaths() []string {
+	s.loadedMu.Lock()
+	defer s.loadedMu.Unlock()
+
+	paths := make([]string, 0, len(s.loaded))
+	for p := range s.loaded {
+		paths = append(paths, p)
+	}
+
+	return paths
+}
+
 // context must be canceled to decrement ref count and release the runner
 func (s *Scheduler) GetRunner(c context.Context, model *Model, opts api.Options, sessionDuration *api.Duration) (chan *runnerRef, chan error) {
 	if opts.NumCtx < 4 {
@@ -142,6 +158,7 @@ func (s *Scheduler) processPending(ctx context.Context) {
 				s.loadedMu.Unlock()
 				if runner != nil {
 					if runner.needsReload(ctx, pending) {
+						pending.model = runner.withAdapters(pending.model)
 						runnerToExpire = runner
 					} else {
 						// Runner is usable, return it
@@ -188,6 +205,14 @@ func (s *Scheduler) processPending(ctx context.Context) {
 						break
 					}
 
+					// validate against the context of a single sequence, before it's scaled for parallel requests
+					ropeOpts := pending.opts
+					ropeOpts.NumCtx = pending.origNumCtx
+					if err := llm.ValidateRopeOptions(ggml, ropeOpts); err != nil {
+						pending.errCh <- err
+						break
+					}
+
 					// Evaluate if the model will fit in the available system memory, or if we should unload a model first
 					if len(gpus) == 1 && gpus[0].Library == "cpu" {
 						// simplifying assumption of defaultParallel when in CPU mode
@@ -405,7 +430,7 @@ func (s *Scheduler) load(req *LlmRequest, ggml *llm.GGML, gpus gpu.GpuInfoList,
 	if req.sessionDuration != nil {
 		sessionDuration = req.sessionDuration.Duration
 	}
-	llama, err := s.newServerFn(gpus, req.model.ModelPath, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts, numParallel)
+	llama, err := s.newServerFn(gpus, req.model.ModelPath, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.model.DraftPath, req.opts, numParallel)
 	if err != nil {
 		// some older models are not compatible with newer versions of llama.cpp
 		// show a generalized compatibility error until there is a better way to
@@ -586,8 +611,14 @@ func (runner *runnerRef) needsReload(ctx context.Context, req *LlmRequest) bool
 
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	if !reflect.DeepEqual(runner.model.AdapterPaths, req.model.AdapterPaths) || // have the adapters changed?
+	// adapters are applied per request, so any runner holding all of them will do
+	missingAdapter := slices.ContainsFunc(req.model.AdapterPaths, func(adapter string) bool {
+		return !slices.Contains(runner.model.AdapterPaths, adapter)
+	})
+
+	if missingAdapter || // is an adapter not loaded?
 		!reflect.DeepEqual(runner.model.ProjectorPaths, req.model.ProjectorPaths) || // have the projectors changed?
+		runner.model.DraftPath != req.model.DraftPath || // has the draft model changed?
 		!reflect.DeepEqual(optsExisting, optsNew) || // have the runner options changed?
 		runner.llama.Ping(ctx) != nil {
 		return true
@@ -596,6 +627,36 @@ func (runner *runnerRef) needsReload(ctx context.Context, req *LlmRequest) bool
 	return false
 }
 
+// withAdapters returns a copy of m that also loads the adapters of the runner
+// it replaces. Adapters are applied per request, so models which share a base
+// model but differ in their adapters can then share the reloaded runner rather
+// than reloading each other on every request.
+func (runner *runnerRef) withAdapters(m *Model) *Model {
+	runner.refMu.Lock()
+	defer runner.refMu.Unlock()
+
+	if runner.model == nil || runner.model.ModelPath != m.ModelPath {
+		return m
+	}
+
+	merged := *m
+	merged.AdapterPaths = slices.Clone(m.AdapterPaths)
+	for _, adapter := range runner.model.AdapterPaths {
+		if slices.Contains(merged.AdapterPaths, adapter) {
+			continue
+		}
+
+		// the model using it may have been removed since
+		if _, err := os.Stat(adapter); err != nil {
+			continue
+		}
+
+		merged.AdapterPaths = append(merged.AdapterPaths, adapter)
+	}
+
+	return &merged
+}
+
 // Free memory reporting on GPUs can lag for a while even after the runner
 // exits, so we have to keep checking until we see the available memory recover,
 // otherwise subsequent model loads will get far less layers loaded or worse
@@ -697,7 +758,7 @@ func pickBestFitGPUs(req *LlmRequest, ggml *llm.GGML, gpus gpu.GpuInfoList, numP
 			req.opts.NumCtx = req.origNumCtx * p
 			if !envconfig.SchedSpread {
 				for _, g := range sgl {
-					if ok, estimatedVRAM = llm.PredictServerFit([]gpu.GpuInfo{g}, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
+					if ok, estimatedVRAM = llm.PredictServerFit([]gpu.GpuInfo{g}, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.model.DraftPath, req.opts); ok {
 						slog.Info("new model will fit in available VRAM in single GPU, loading", "model", req.model.ModelPath, "gpu", g.ID, "parallel", p, "available", g.FreeMemory, "required", format.HumanBytes2(estimatedVRAM))
 						*numParallel = p
 						return []gpu.GpuInfo{g}
@@ -713,7 +774,7 @@ func pickBestFitGPUs(req *LlmRequest, ggml *llm.GGML, gpus gpu.GpuInfoList, numP
 		// Now try all the GPUs
 		for _, p := range numParallelToTry {
 			req.opts.NumCtx = req.origNumCtx * p
-			if ok, estimatedVRAM = llm.PredictServerFit(sgl, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
+			if ok, estimatedVRAM = llm.PredictServerFit(sgl, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.model.DraftPath, req.opts); ok {
 				slog.Info("new model will fit in available VRAM, loading", "model", req.model.ModelPath, "library", sgl[0].Library, "parallel", p, "required", format.HumanBytes2(estimatedVRAM))
 				*numParallel = p
 				return sgl
@@ -770,7 +831,7 @@ func (s *Scheduler) unloadAllRunners() {
 // If not, pick a runner to unload, else return nil and the request can be loaded
 func (s *Scheduler) maybeFindCPURunnerToUnload(req *LlmRequest, ggml *llm.GGML, gpus gpu.GpuInfoList) *runnerRef {
 	slog.Debug("evaluating if CPU model load will fit in available system memory")
-	estimate := llm.EstimateGPULayers(gpus, ggml, req.model.ProjectorPaths, req.opts)
+	estimate := llm.EstimateGPULayers(gpus, ggml, req.model.ProjectorPaths, req.model.DraftPath, req.opts)
 	if estimate.TotalSize <= gpus[0].FreeMemory {
 		slog.Debug("cpu inference mode, model fits in available system memory", "model", format.HumanBytes2(estimate.TotalSize), "available", format.HumanBytes2(gpus[0].FreeMemory))
 		return nil
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -47,7 +48,7 @@ func TestLoad(t *testing.T) {
 		sessionDuration: &api.Duration{Duration: 2 * time.Second},
 	}
 	// Fail to load model first
-	s.newServerFn = func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, draft string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return nil, fmt.Errorf("something failed to load model blah")
 	}
 	gpus := gpu.GpuInfoList{}
@@ -61,7 +62,7 @@ func TestLoad(t *testing.T) {
 	require.Contains(t, err.Error(), "this model may be incompatible")
 
 	server := &mockLlm{estimatedVRAM: 10, estimatedVRAMByGPU: map[string]uint64{}}
-	s.newServerFn = func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, draft string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return server, nil
 	}
 	s.load(req, ggml, gpus, 0)
@@ -102,7 +103,7 @@ type bundle struct {
 	ggml    *llm.GGML
 }
 
-func (scenario *bundle) newServer(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+func (scenario *bundle) newServer(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, draft string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 	return scenario.srv, nil
 }
 
@@ -574,6 +575,10 @@ func TestNeedsReload(t *testing.T) {
 	resp = runner.needsReload(ctx, req)
 	require.True(t, resp)
 	req.opts.NumBatch = runner.Options.NumBatch
+	req.opts.RopeFrequencyScale = 0.5
+	resp = runner.needsReload(ctx, req)
+	require.True(t, resp)
+	req.opts.RopeFrequencyScale = runner.Options.RopeFrequencyScale
 	llm.pingResp = fmt.Errorf("foo")
 	resp = runner.needsReload(ctx, req)
 	require.True(t, resp)
@@ -586,6 +591,54 @@ func TestNeedsReload(t *testing.T) {
 	req.opts.NumGPU = -1
 	resp = runner.needsReload(ctx, req)
 	require.False(t, resp)
+	req.model.AdapterPaths = nil
+	resp = runner.needsReload(ctx, req)
+	require.False(t, resp)
+	runner.model.AdapterPaths = []string{"adapter1", "adapter2"}
+	req.model.AdapterPaths = []string{"adapter2"}
+	resp = runner.needsReload(ctx, req)
+	require.False(t, resp)
+	req.model.AdapterPaths = []string{"adapter2", "adapter3"}
+	resp = runner.needsReload(ctx, req)
+	require.True(t, resp)
+}
+
+func TestWithAdapters(t *testing.T) {
+	dir := t.TempDir()
+	adapters := make([]string, 3)
+	for i := range adapters {
+		adapters[i] = filepath.Join(dir, fmt.Sprintf("adapter%d", i))
+		require.NoError(t, os.WriteFile(adapters[i], nil, 0o644))
+	}
+
+	do := api.DefaultOptions()
+	runner := &runnerRef{
+		model:       &Model{ModelPath: "base", AdapterPaths: []string{adapters[0], adapters[1]}},
+		Options:     &do,
+		llama:       &mockLlm{estimatedVRAMByGPU: map[string]uint64{}},
+		numParallel: 1,
+	}
+
+	m := &Model{ModelPath: "base", AdapterPaths: []string{adapters[2]}}
+	merged := runner.withAdapters(m)
+	require.Equal(t, []string{adapters[2], adapters[0], adapters[1]}, merged.AdapterPaths)
+	require.Equal(t, []string{adapters[2]}, m.AdapterPaths)
+
+	// the other variant can use the reloaded runner
+	runner.model = merged
+	req := &LlmRequest{
+		model: &Model{ModelPath: "base", AdapterPaths: []string{adapters[0]}},
+		opts:  api.DefaultOptions(),
+	}
+	require.False(t, runner.needsReload(context.Background(), req))
+
+	// adapters which no longer exist aren't loaded again
+	require.NoError(t, os.Remove(adapters[1]))
+	runner.model = &Model{ModelPath: "base", AdapterPaths: []string{adapters[0], adapters[1]}}
+	require.Equal(t, []string{adapters[2], adapters[0]}, runner.withAdapters(m).AdapterPaths)
+
+	// a different base model keeps its own adapters
+	require.Equal(t, m, (&runnerRef{model: &Model{ModelPath: "other", AdapterPaths: adapters}}).withAdapters(m))
 }
 
 func TestUnloadAllRunners(t *testing.T) {
@@ -673,6 +726,8 @@ func (s *mockLlm) Close() error {
 	s.closeCalled = true
 	return s.closeResp
 }
-func (s *mockLlm) EstimatedVRAM() uint64                  { return s.estimatedVRAM }
-func (s *mockLlm) EstimatedTotal() uint64                 { return s.estimatedTotal }
-func (s *mockLlm) EstimatedVRAMByGPU(gpuid string) uint64 { return s.estimatedVRAMByGPU[gpuid] }
+func (s *mockLlm) EstimatedVRAM() uint64                   { return s.estimatedVRAM }
+func (s *mockLlm) EstimatedTotal() uint64                  { return s.estimatedTotal }
+func (s *mockLlm) EstimatedVRAMByGPU(gpuid string) uint64  { return s.estimatedVRAMByGPU[gpuid] }
+func (s *mockLlm) PromptCacheStats() *api.PromptCacheStats { return nil }
+func (s *mockLlm) DraftStats() *api.DraftStats             { return nil }
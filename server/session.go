@@ -0,0 +1,220 @@
+package server
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errSessionFork     = errors.New("can't fork more messages than the session has")
+)
+
+// sessionsMu serializes changes to the sessions directory.
+var sessionsMu sync.Mutex
+
+func sessionsDir() string {
+	return filepath.Join(envconfig.ModelsDir, "sessions")
+}
+
+// sessionPath returns the file session id is stored in. IDs are generated by
+// newSessionID, so any other ID is reported as not found rather than being
+// used as a path.
+func sessionPath(id string) (string, error) {
+	if len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%w: %s", errSessionNotFound, id)
+	}
+
+	return filepath.Join(sessionsDir(), id+".json"), nil
+}
+
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+// GetSession reads a stored session. It returns errSessionNotFound if no
+// session with that ID exists.
+func GetSession(id string) (*api.Session, error) {
+	p, err := sessionPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", errSessionNotFound, id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var s api.Session
+	if err := json.Unmarshal(bts, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return &s, nil
+}
+
+func writeSession(s *api.Session) error {
+	p, err := sessionPath(s.ID)
+	if err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(sessionsDir(), 0o755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a failed write doesn't lose the
+	// history
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, bts, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
+
+// CreateSession stores a new session chatting with model.
+func CreateSession(model string, options map[string]any, msgs []api.Message) (*api.Session, error) {
+	return storeSession(api.Session{Model: model, Options: options, Messages: msgs})
+}
+
+// storeSession stores s as a new session with a new ID.
+func storeSession(s api.Session) (*api.Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.ID = id
+	s.CreatedAt = time.Now().UTC()
+	s.ModifiedAt = s.CreatedAt
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if err := writeSession(&s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Sessions returns all stored sessions, most recently modified first.
+func Sessions() ([]api.Session, error) {
+	entries, err := os.ReadDir(sessionsDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ss []api.Session
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+
+		s, err := GetSession(id)
+		if errors.Is(err, errSessionNotFound) {
+			// removed since reading the directory, or not a session
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		ss = append(ss, *s)
+	}
+
+	slices.SortFunc(ss, func(a, b api.Session) int {
+		return cmp.Or(b.ModifiedAt.Compare(a.ModifiedAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return ss, nil
+}
+
+// AppendSession appends msgs to the history of a stored session.
+func AppendSession(id string, msgs []api.Message) (*api.Session, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	s, err := GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Messages = append(s.Messages, msgs...)
+	s.ModifiedAt = time.Now().UTC()
+	if err := writeSession(s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ForkSession stores a new session with the model, options and the first n
+// messages of the history of session id, or the whole history if n is zero.
+func ForkSession(id string, n int) (*api.Session, error) {
+	s, err := GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 0 || n > len(s.Messages) {
+		return nil, fmt.Errorf("%w: %d > %d", errSessionFork, n, len(s.Messages))
+	} else if n == 0 {
+		n = len(s.Messages)
+	}
+
+	return storeSession(api.Session{
+		Model:    s.Model,
+		Options:  maps.Clone(s.Options),
+		Messages: slices.Clone(s.Messages[:n]),
+		Parent:   s.ID,
+	})
+}
+
+// DeleteSession removes a stored session.
+func DeleteSession(id string) error {
+	p, err := sessionPath(id)
+	if err != nil {
+		return err
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if err := os.Remove(p); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", errSessionNotFound, id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestSessions(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: "FROM " + createBinFile(t, nil, nil),
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.CreateSessionHandler, api.CreateSessionRequest{
+		Model:    "test",
+		Options:  map[string]any{"temperature": 0.5},
+		Messages: []api.Message{{Role: "system", Content: "Be brief."}},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var session api.Session
+	if err := json.NewDecoder(w.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+
+	if session.Model != "test:latest" {
+		t.Errorf("expected model test:latest, got %q", session.Model)
+	}
+
+	turn := []api.Message{
+		{Role: "user", Content: "Why is the sky blue?"},
+		{Role: "assistant", Content: "Rayleigh scattering."},
+	}
+
+	appended, err := AppendSession(session.ID, turn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(appended, got); diff != "" {
+		t.Errorf("mismatch (-appended +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(append(session.Messages, turn...), got.Messages); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+
+	fork, err := ForkSession(session.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fork.ID == session.ID || fork.Parent != session.ID {
+		t.Errorf("expected a new session forked from %s, got %s forked from %q", session.ID, fork.ID, fork.Parent)
+	}
+
+	if diff := cmp.Diff(got.Messages[:2], fork.Messages); diff != "" {
+		t.Errorf("forked messages mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(session.Options, fork.Options); diff != "" {
+		t.Errorf("forked options mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := ForkSession(session.ID, 4); !errors.Is(err, errSessionFork) {
+		t.Errorf("expected errSessionFork, got %v", err)
+	}
+
+	w = createRequest(t, s.ListSessionsHandler, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.SessionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, s := range resp.Sessions {
+		ids = append(ids, s.ID)
+	}
+
+	// the fork is the most recently modified session
+	if diff := cmp.Diff([]string{fork.ID, session.ID}, ids); diff != "" {
+		t.Errorf("sessions mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := DeleteSession(session.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetSession(session.ID); !errors.Is(err, errSessionNotFound) {
+		t.Errorf("expected errSessionNotFound, got %v", err)
+	}
+
+	if err := DeleteSession(session.ID); !errors.Is(err, errSessionNotFound) {
+		t.Errorf("expected errSessionNotFound, got %v", err)
+	}
+
+	for _, id := range []string{"", "../manifests", fork.ID + "0"} {
+		if _, err := GetSession(id); !errors.Is(err, errSessionNotFound) {
+			t.Errorf("expected errSessionNotFound for %q, got %v", id, err)
+		}
+	}
+
+	w = createRequest(t, s.CreateSessionHandler, api.CreateSessionRequest{Model: "missing"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, actual %d", w.Code)
+	}
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/envconfig"
+)
+
+const (
+	signatureArtifactType = "application/vnd.ollama.signature.v1+json"
+	ociManifestMediaType  = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType     = "application/vnd.oci.empty.v1+json"
+)
+
+var errSignatureInvalid = errors.New("manifest signature verification failed")
+
+// manifestSignature is a signature of a manifest, stored as the layer of a
+// signature artifact.
+type manifestSignature struct {
+	// Manifest is the digest of the signed manifest.
+	Manifest string `json:"manifest"`
+
+	// Repository is the namespace and model the manifest was pushed to. It is
+	// signed so a signed manifest can't be passed off as another model.
+	Repository string `json:"repository"`
+
+	// PublicKey is the signer's key in authorized_keys format.
+	PublicKey string `json:"publicKey"`
+
+	// Signature is the base64 encoded SSH signature of the signed data.
+	Signature string `json:"signature"`
+}
+
+func (s manifestSignature) signedData() []byte {
+	return []byte(s.Repository + "@" + s.Manifest)
+}
+
+// signatureManifest is an OCI artifact holding manifest signatures. It
+// refers to the signed manifest as its subject.
+type signatureManifest struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	MediaType     string   `json:"mediaType"`
+	ArtifactType  string   `json:"artifactType"`
+	Config        *Layer   `json:"config"`
+	Layers        []*Layer `json:"layers"`
+	Subject       *Layer   `json:"subject,omitempty"`
+}
+
+// signatureTag returns the tag signatures of a manifest are pushed to,
+// following the fallback tag schema of OCI referrers.
+func signatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// pushManifestSignature signs a pushed manifest with the Ollama key and
+// pushes the signature next to it. A signature pushed before is replaced.
+func pushManifestSignature(ctx context.Context, mp ModelPath, manifest []byte, mediaType string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	fn(api.ProgressResponse{Status: "signing manifest"})
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	sig := manifestSignature{
+		Manifest:   digest,
+		Repository: mp.GetNamespaceRepository(),
+	}
+
+	publicKey, err := auth.GetPublicKey()
+	if err != nil {
+		return fmt.Errorf("couldn't load signing key: %w", err)
+	}
+
+	signed, err := auth.Sign(ctx, sig.signedData())
+	if err != nil {
+		return err
+	}
+
+	_, signature, ok := strings.Cut(signed, ":")
+	if !ok {
+		return errors.New("malformed signature")
+	}
+
+	sig.PublicKey = publicKey
+	sig.Signature = signature
+
+	bts, err := json.Marshal(sig)
+	if err != nil {
+		return err
+	}
+
+	layer, err := NewLayer(bytes.NewReader(bts), signatureArtifactType)
+	if err != nil {
+		return err
+	}
+
+	config, err := NewLayer(strings.NewReader("{}"), ociEmptyMediaType)
+	if err != nil {
+		return err
+	}
+
+	// the blobs are only needed in the registry
+	defer layer.Remove()
+	defer config.Remove()
+
+	for _, l := range []*Layer{config, layer} {
+		if err := uploadBlob(ctx, mp, l, regOpts, fn); err != nil {
+			return err
+		}
+	}
+
+	bts, err = json.Marshal(signatureManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  signatureArtifactType,
+		Config:        config,
+		Layers:        []*Layer{layer},
+		Subject:       &Layer{MediaType: mediaType, Digest: digest, Size: int64(len(manifest))},
+	})
+	if err != nil {
+		return err
+	}
+
+	fn(api.ProgressResponse{Status: "pushing signature"})
+
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", signatureTag(digest))
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", ociManifestMediaType)
+	resp, err := makeRequestWithRetry(ctx, http.MethodPut, requestURL, headers, bytes.NewReader(bts), regOpts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// trustedKeys reads the public keys in OLLAMA_TRUSTED_KEYS, a file in
+// authorized_keys format.
+func trustedKeys() ([]ssh.PublicKey, error) {
+	bts, err := os.ReadFile(envconfig.TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(bts)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(bts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", envconfig.TrustedKeys, err)
+		}
+
+		keys = append(keys, key)
+		bts = rest
+	}
+
+	return keys, nil
+}
+
+// verifyManifestSignature checks that a pulled manifest is signed by one of
+// the trusted keys for the repository it is pulled from.
+func verifyManifestSignature(ctx context.Context, mp ModelPath, m *Manifest, regOpts *registryOptions) error {
+	keys, err := trustedKeys()
+	if err != nil {
+		return err
+	}
+
+	digest := "sha256:" + m.digest
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", signatureTag(digest))
+
+	headers := make(http.Header)
+	headers.Set("Accept", ociManifestMediaType)
+	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s is not signed", errSignatureInvalid, mp.GetShortTagname())
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var sm signatureManifest
+	if err := json.NewDecoder(resp.Body).Decode(&sm); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, layer := range sm.Layers {
+		if layer.MediaType != signatureArtifactType {
+			continue
+		}
+
+		sig, err := getManifestSignature(ctx, mp, layer, regOpts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := sig.verify(digest, mp.GetNamespaceRepository(), keys); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: %s is not signed", errSignatureInvalid, mp.GetShortTagname())
+	}
+
+	return fmt.Errorf("%w: %w", errSignatureInvalid, errors.Join(errs...))
+}
+
+// getManifestSignature downloads a signature layer.
+func getManifestSignature(ctx context.Context, mp ModelPath, layer *Layer, regOpts *registryOptions) (*manifestSignature, error) {
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "blobs", layer.Digest)
+	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, nil, nil, regOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// signatures are small, don't read more than needed
+	bts, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(bts)); digest != layer.Digest {
+		return nil, fmt.Errorf("%w: want %s, got %s", errDigestMismatch, layer.Digest, digest)
+	}
+
+	var sig manifestSignature
+	if err := json.Unmarshal(bts, &sig); err != nil {
+		return nil, err
+	}
+
+	return &sig, nil
+}
+
+// verify checks that the signature is of digest pushed to repository, made
+// with one of keys.
+func (s manifestSignature) verify(digest, repository string, keys []ssh.PublicKey) error {
+	if s.Manifest != digest {
+		return fmt.Errorf("signature is for manifest %s", s.Manifest)
+	} else if s.Repository != repository {
+		return fmt.Errorf("signature is for %s", s.Repository)
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.PublicKey))
+	if err != nil {
+		return err
+	}
+
+	trusted := false
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+
+	if !trusted {
+		return fmt.Errorf("signed by untrusted key %s", ssh.FingerprintSHA256(key))
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return err
+	}
+
+	if err := key.Verify(s.signedData(), &ssh.Signature{Format: key.Type(), Blob: blob}); err != nil {
+		return fmt.Errorf("invalid signature by %s: %w", ssh.FingerprintSHA256(key), err)
+	}
+
+	return nil
+}
+
+// checkManifestSignature verifies the signature of a pulled manifest when
+// OLLAMA_TRUSTED_KEYS is set. Failures are logged, unless
+// OLLAMA_VERIFY_SIGNATURES is "enforce" where they fail the pull.
+func checkManifestSignature(ctx context.Context, mp ModelPath, m *Manifest, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	if envconfig.TrustedKeys == "" || envconfig.VerifySignatures == "off" {
+		return nil
+	}
+
+	fn(api.ProgressResponse{Status: "verifying manifest signature"})
+
+	err := verifyManifestSignature(ctx, mp, m, regOpts)
+	if err == nil {
+		return nil
+	} else if envconfig.VerifySignatures == "enforce" {
+		return err
+	}
+
+	slog.Warn("pulling model without a valid signature", "model", mp.GetShortTagname(), "error", err)
+	fn(api.ProgressResponse{Status: fmt.Sprintf("warning: %v", err)})
+	return nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// newSigningKey writes a new Ollama key to a temporary home directory and
+// returns its public key in authorized_keys format.
+func newSigningKey(t *testing.T) []byte {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if err := os.MkdirAll(filepath.Join(home, ".ollama"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".ollama", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ssh.MarshalAuthorizedKey(key)
+}
+
+func TestManifestSignature(t *testing.T) {
+	trusted := newSigningKey(t)
+	r, name, _ := pushTestModel(t)
+
+	fn := func(api.ProgressResponse) {}
+	if err := PushModel(context.Background(), name.String(), &registryOptions{Sign: true}, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.manifests) != 2 {
+		t.Fatalf("expected the manifest and its signature in the registry, got %d manifests", len(r.manifests))
+	}
+
+	// the signature blobs aren't kept locally
+	ms, err := Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, _ := blobRefs(ms)
+	if orphaned, err := orphanedBlobs(refs); err != nil {
+		t.Fatal(err)
+	} else if len(orphaned) > 0 {
+		t.Errorf("expected no orphaned blobs, got %v", orphaned)
+	}
+
+	pull := func(t *testing.T, keys []byte, mode string) error {
+		t.Helper()
+
+		p := filepath.Join(t.TempDir(), "trusted_keys")
+		if err := os.WriteFile(p, keys, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		t.Setenv("OLLAMA_TRUSTED_KEYS", p)
+		t.Setenv("OLLAMA_VERIFY_SIGNATURES", mode)
+		envconfig.LoadConfig()
+
+		return PullModel(context.Background(), name.String(), &registryOptions{}, fn)
+	}
+
+	t.Run("trusted", func(t *testing.T) {
+		if err := pull(t, trusted, "enforce"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseNamedManifest(name); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	untrusted := newSigningKey(t)
+
+	t.Run("untrusted", func(t *testing.T) {
+		if err := pull(t, untrusted, "enforce"); !errors.Is(err, errSignatureInvalid) {
+			t.Fatalf("expected errSignatureInvalid, got %v", err)
+		}
+
+		if _, err := ParseNamedManifest(name); err == nil {
+			t.Errorf("expected no manifest to be written")
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		if err := pull(t, untrusted, "warn"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		// the registry serves a different manifest under the same tag
+		manifest := r.manifests["latest"]
+		r.manifests["latest"] = append(manifest, '\n')
+		defer func() { r.manifests["latest"] = manifest }()
+
+		if err := pull(t, trusted, "enforce"); !errors.Is(err, errSignatureInvalid) {
+			t.Fatalf("expected errSignatureInvalid, got %v", err)
+		}
+	})
+}
@@ -33,6 +33,10 @@ type blobUpload struct {
 
 	nextURL chan *url.URL
 
+	// limiter limits the rate of this upload, in addition to the rate of
+	// all uploads
+	limiter *rateLimiter
+
 	context.CancelFunc
 
 	file *os.File
@@ -108,13 +112,14 @@ func (b *blobUpload) Prepare(ctx context.Context, requestURL *url.URL, opts *reg
 
 	slog.Info(fmt.Sprintf("uploading %s in %d %s part(s)", b.Digest[7:19], len(b.Parts), format.HumanBytes(b.Parts[0].Size)))
 
-	requestURL, err = url.Parse(location)
+	// registries may return the upload location relative to the request
+	nextURL, err := requestURL.Parse(location)
 	if err != nil {
 		return err
 	}
 
 	b.nextURL = make(chan *url.URL, 1)
-	b.nextURL <- requestURL
+	b.nextURL <- nextURL
 	return nil
 }
 
@@ -138,7 +143,7 @@ func (b *blobUpload) Run(ctx context.Context, opts *registryOptions) {
 	defer b.file.Close()
 
 	g, inner := errgroup.WithContext(ctx)
-	g.SetLimit(numUploadParts)
+	g.SetLimit(transferParts(numUploadParts))
 	for i := range b.Parts {
 		part := &b.Parts[i]
 		select {
@@ -219,7 +224,11 @@ func (b *blobUpload) uploadPart(ctx context.Context, method string, requestURL *
 		headers.Set("Content-Range", fmt.Sprintf("%d-%d", part.Offset, part.Offset+part.Size-1))
 	}
 
-	sr := io.NewSectionReader(b.file, part.Offset, part.Size)
+	sr := &throttledReader{
+		ctx:      ctx,
+		r:        io.NewSectionReader(b.file, part.Offset, part.Size),
+		limiters: []*rateLimiter{uploadLimiter, b.limiter},
+	}
 
 	md5sum := md5.New()
 	w := &progressWriter{blobUpload: b}
@@ -236,7 +245,7 @@ func (b *blobUpload) uploadPart(ctx context.Context, method string, requestURL *
 		location = resp.Header.Get("Location")
 	}
 
-	nextURL, err := url.Parse(location)
+	nextURL, err := requestURL.Parse(location)
 	if err != nil {
 		w.Rollback()
 		return err
@@ -274,13 +283,10 @@ func (b *blobUpload) uploadPart(ctx context.Context, method string, requestURL *
 
 	case resp.StatusCode == http.StatusUnauthorized:
 		w.Rollback()
-		challenge := parseRegistryChallenge(resp.Header.Get("www-authenticate"))
-		token, err := getAuthorizationToken(ctx, challenge)
-		if err != nil {
+		if _, err := authenticate(ctx, requestURL.Host, resp.Header.Get("www-authenticate"), opts); err != nil {
 			return err
 		}
 
-		opts.Token = token
 		fallthrough
 	case resp.StatusCode >= http.StatusBadRequest:
 		w.Rollback()
@@ -381,7 +387,7 @@ func uploadBlob(ctx context.Context, mp ModelPath, layer *Layer, opts *registryO
 		return nil
 	}
 
-	data, ok := blobUploadManager.LoadOrStore(layer.Digest, &blobUpload{Layer: layer})
+	data, ok := blobUploadManager.LoadOrStore(layer.Digest, &blobUpload{Layer: layer, limiter: newRateLimiter(opts.MaxRate)})
 	upload := data.(*blobUpload)
 	if !ok {
 		requestURL := mp.BaseURL()
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// usageSaveInterval limits how often last used times are written to disk
+// for a model which is used repeatedly.
+const usageSaveInterval = time.Minute
+
+// modelUsage holds when each model was last used for inference, keyed by
+// its fully qualified name. It is kept in usage.json in the models directory.
+var modelUsage struct {
+	sync.Mutex
+
+	// path is the file lastUsed was loaded from
+	path     string
+	lastUsed map[string]time.Time
+}
+
+func usagePath() string {
+	return filepath.Join(envconfig.ModelsDir, "usage.json")
+}
+
+// loadUsageLocked reads the last used times unless they are already loaded
+// from the current models directory.
+func loadUsageLocked() {
+	p := usagePath()
+	if modelUsage.lastUsed != nil && modelUsage.path == p {
+		return
+	}
+
+	modelUsage.path = p
+	modelUsage.lastUsed = make(map[string]time.Time)
+
+	bts, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		slog.Warn("couldn't read model usage", "path", p, "error", err)
+		return
+	}
+
+	if err := json.Unmarshal(bts, &modelUsage.lastUsed); err != nil {
+		slog.Warn("couldn't read model usage", "path", p, "error", err)
+	}
+}
+
+func saveUsageLocked() {
+	bts, err := json.Marshal(modelUsage.lastUsed)
+	if err != nil {
+		slog.Warn("couldn't write model usage", "error", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(modelUsage.path), 0o755); err != nil {
+		slog.Warn("couldn't write model usage", "path", modelUsage.path, "error", err)
+		return
+	}
+
+	if err := os.WriteFile(modelUsage.path, bts, 0o644); err != nil {
+		slog.Warn("couldn't write model usage", "path", modelUsage.path, "error", err)
+	}
+}
+
+// touchModel records that a model was just used.
+func touchModel(name model.Name) {
+	modelUsage.Lock()
+	defer modelUsage.Unlock()
+
+	loadUsageLocked()
+
+	now := time.Now()
+	last := modelUsage.lastUsed[name.String()]
+	modelUsage.lastUsed[name.String()] = now
+	if now.Sub(last) > usageSaveInterval {
+		saveUsageLocked()
+	}
+}
+
+// lastUsed returns when a model was last used, or the zero time if it
+// hasn't been used.
+func lastUsed(name model.Name) time.Time {
+	modelUsage.Lock()
+	defer modelUsage.Unlock()
+
+	loadUsageLocked()
+	return modelUsage.lastUsed[name.String()]
+}
+
+// forgetModel removes the last used time of a deleted model.
+func forgetModel(name model.Name) {
+	modelUsage.Lock()
+	defer modelUsage.Unlock()
+
+	loadUsageLocked()
+	if _, ok := modelUsage.lastUsed[name.String()]; ok {
+		delete(modelUsage.lastUsed, name.String())
+		saveUsageLocked()
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// VerifyModels re-hashes the blobs of the named model, or of all models if
+// name is not valid, and reports the ones which are missing or corrupt. When
+// all models are verified, blobs which no model references are reported as
+// orphaned. With repair, missing and corrupt blobs are downloaded again from
+// the registry of a model which references them.
+func VerifyModels(ctx context.Context, name model.Name, repair bool, regOpts *registryOptions, fn func(api.VerifyResponse)) error {
+	manifests := make(map[model.Name]*Manifest)
+	if name.IsValid() {
+		m, err := ParseNamedManifest(name)
+		if err != nil {
+			return err
+		}
+
+		manifests[name] = m
+	} else {
+		var err error
+		manifests, err = Manifests()
+		if err != nil {
+			return err
+		}
+	}
+
+	refs, sizes := blobRefs(manifests)
+
+	digests := make([]string, 0, len(refs))
+	for digest := range refs {
+		digests = append(digests, digest)
+	}
+
+	slices.Sort(digests)
+
+	blobInfo := func(digest string) api.BlobInfo {
+		info := api.BlobInfo{Digest: digest, Size: sizes[digest]}
+		for _, n := range refs[digest] {
+			info.Models = append(info.Models, n.DisplayShortest())
+		}
+
+		return info
+	}
+
+	var resp api.VerifyResponse
+	for _, digest := range digests {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := hashBlob(digest, sizes[digest], fn)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			resp.Missing = append(resp.Missing, blobInfo(digest))
+		case errors.Is(err, errDigestMismatch):
+			resp.Corrupt = append(resp.Corrupt, blobInfo(digest))
+		case err != nil:
+			return err
+		}
+	}
+
+	if !name.IsValid() {
+		orphaned, err := orphanedBlobs(refs)
+		if err != nil {
+			return err
+		}
+
+		resp.Orphaned = orphaned
+	}
+
+	var errs []error
+	if repair {
+		for _, info := range append(resp.Missing, resp.Corrupt...) {
+			if err := repairBlob(ctx, info.Digest, refs[info.Digest], regOpts, fn); errors.Is(err, context.Canceled) {
+				return err
+			} else if err != nil {
+				// keep repairing the other blobs
+				errs = append(errs, err)
+				continue
+			}
+
+			resp.Repaired = append(resp.Repaired, info)
+		}
+	}
+
+	if len(errs) > 0 {
+		// report what was repaired before failing
+		fn(resp)
+		return errors.Join(errs...)
+	}
+
+	resp.Status = "success"
+	fn(resp)
+	return nil
+}
+
+// hashBlob verifies the digest of a blob, reporting progress as it is read.
+func hashBlob(digest string, size int64, fn func(api.VerifyResponse)) error {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	step := max(size/100, 1<<20)
+	w := &verifyProgress{
+		ProgressResponse: api.ProgressResponse{
+			Status: fmt.Sprintf("verifying %s", digest[7:19]),
+			Digest: digest,
+			Total:  size,
+		},
+		step: step,
+		next: step,
+		fn:   fn,
+	}
+
+	fn(api.VerifyResponse{ProgressResponse: w.ProgressResponse})
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h, w), f); err != nil {
+		return err
+	}
+
+	fn(api.VerifyResponse{ProgressResponse: w.ProgressResponse})
+
+	if fileDigest := fmt.Sprintf("sha256:%x", h.Sum(nil)); fileDigest != digest {
+		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, fileDigest)
+	}
+
+	return nil
+}
+
+// verifyProgress reports the progress of hashing a blob every step bytes.
+type verifyProgress struct {
+	api.ProgressResponse
+
+	step int64
+	next int64
+	fn   func(api.VerifyResponse)
+}
+
+func (w *verifyProgress) Write(b []byte) (int, error) {
+	w.Completed += int64(len(b))
+	if w.Completed >= w.next {
+		w.next = w.Completed + w.step
+		w.fn(api.VerifyResponse{ProgressResponse: w.ProgressResponse})
+	}
+
+	return len(b), nil
+}
+
+// orphanedBlobs returns the blobs in the store which aren't in refs.
+func orphanedBlobs(refs map[string][]model.Name) ([]api.BlobInfo, error) {
+	p, err := GetBlobsPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphaned []api.BlobInfo
+	for _, entry := range entries {
+		digest := strings.Replace(entry.Name(), "-", ":", 1)
+		if _, err := GetBlobsPath(digest); err != nil {
+			// not a blob, e.g. a partial download
+			continue
+		}
+
+		if _, ok := refs[digest]; ok {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		orphaned = append(orphaned, api.BlobInfo{Digest: digest, Size: fi.Size()})
+	}
+
+	return orphaned, nil
+}
+
+// repairBlob downloads a blob again from the registry of the first of names
+// it can be downloaded from. The download is verified before it replaces the
+// blob, so a blob that can't be repaired is left as it was.
+func repairBlob(ctx context.Context, digest string, names []model.Name, regOpts *registryOptions, fn func(api.VerifyResponse)) error {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	tmp := p + "-repair"
+	defer os.Remove(tmp)
+	defer func() {
+		// a failed repair can't be resumed, remove what it downloaded unless
+		// it's still running after ctx was canceled
+		if _, ok := blobDownloadManager.Load(tmp); ok {
+			return
+		}
+
+		partials, _ := filepath.Glob(tmp + "-partial*")
+		for _, partial := range partials {
+			os.Remove(partial)
+		}
+	}()
+
+	progress := func(r api.ProgressResponse) {
+		fn(api.VerifyResponse{ProgressResponse: r})
+	}
+
+	var errs []error
+	for _, n := range names {
+		mp := ParseModelPath(n.String())
+		if _, err := downloadBlob(ctx, downloadOpts{mp: mp, digest: digest, regOpts: regOpts, fn: progress, name: tmp}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.DisplayShortest(), err))
+			continue
+		}
+
+		if err := verifyFile(tmp, digest); err != nil {
+			os.Remove(tmp)
+			errs = append(errs, fmt.Errorf("%s: %w", n.DisplayShortest(), err))
+			continue
+		}
+
+		return os.Rename(tmp, p)
+	}
+
+	return fmt.Errorf("couldn't repair %s: %w", digest, errors.Join(errs...))
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestVerifyModels(t *testing.T) {
+	r, name, m := pushTestModel(t)
+
+	verify := func(t *testing.T, name model.Name, repair bool) api.VerifyResponse {
+		t.Helper()
+
+		var result api.VerifyResponse
+		fn := func(resp api.VerifyResponse) {
+			if resp.Status == "success" {
+				result = resp
+			}
+		}
+
+		if err := VerifyModels(context.Background(), name, repair, &registryOptions{}, fn); err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	digests := func(blobs []api.BlobInfo) (s []string) {
+		for _, blob := range blobs {
+			s = append(s, blob.Digest)
+		}
+
+		return s
+	}
+
+	if result := verify(t, model.Name{}, false); len(result.Missing)+len(result.Corrupt)+len(result.Orphaned) > 0 {
+		t.Fatalf("expected no problems, got %+v", result)
+	}
+
+	var system *Layer
+	for _, layer := range m.Layers {
+		if layer.MediaType == "application/vnd.ollama.image.system" {
+			system = layer
+		}
+	}
+
+	p, err := GetBlobsPath(system.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, []byte("olleh"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := GetBlobsPath(m.Config.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(config); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan, err := NewLayer(bytes.NewReader([]byte("orphan")), "application/vnd.ollama.image.system")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("all", func(t *testing.T) {
+		result := verify(t, model.Name{}, false)
+		if got := digests(result.Missing); !slices.Equal(got, []string{m.Config.Digest}) {
+			t.Errorf("expected missing %s, got %v", m.Config.Digest, got)
+		}
+
+		if got := digests(result.Corrupt); !slices.Equal(got, []string{system.Digest}) {
+			t.Errorf("expected corrupt %s, got %v", system.Digest, got)
+		}
+
+		if len(result.Corrupt) == 1 && !slices.Equal(result.Corrupt[0].Models, []string{name.DisplayShortest()}) {
+			t.Errorf("expected corrupt blob to be used by %s, got %v", name.DisplayShortest(), result.Corrupt[0].Models)
+		}
+
+		if got := digests(result.Orphaned); !slices.Equal(got, []string{orphan.Digest}) {
+			t.Errorf("expected orphaned %s, got %v", orphan.Digest, got)
+		}
+	})
+
+	t.Run("model", func(t *testing.T) {
+		result := verify(t, name, false)
+		if len(result.Missing) != 1 || len(result.Corrupt) != 1 {
+			t.Errorf("expected a missing and a corrupt blob, got %+v", result)
+		}
+
+		if len(result.Orphaned) > 0 {
+			t.Errorf("expected no orphaned blobs for a single model, got %v", digests(result.Orphaned))
+		}
+	})
+
+	t.Run("repair failure", func(t *testing.T) {
+		good := r.blobs[system.Digest]
+		r.blobs[system.Digest] = []byte("HELLO")
+		t.Cleanup(func() { r.blobs[system.Digest] = good })
+
+		var result api.VerifyResponse
+		err := VerifyModels(context.Background(), name, true, &registryOptions{}, func(resp api.VerifyResponse) {
+			result = resp
+		})
+		if !errors.Is(err, errDigestMismatch) {
+			t.Fatalf("expected errDigestMismatch, got %v", err)
+		}
+
+		// the other blob is still repaired
+		if got := digests(result.Repaired); !slices.Equal(got, []string{m.Config.Digest}) {
+			t.Errorf("expected repaired %v, got %v", []string{m.Config.Digest}, got)
+		}
+
+		// the blob which couldn't be repaired is left as it was
+		if bts, err := os.ReadFile(p); err != nil || string(bts) != "olleh" {
+			t.Errorf("expected corrupt blob to be kept, got %q, %v", bts, err)
+		}
+
+		if _, err := os.Stat(p + "-repair"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected repair download to be removed, got %v", err)
+		}
+
+		if err := os.Remove(config); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		result := verify(t, name, true)
+		if got := digests(result.Repaired); !slices.Equal(got, []string{m.Config.Digest, system.Digest}) {
+			t.Errorf("expected repaired %v, got %v", []string{m.Config.Digest, system.Digest}, got)
+		}
+
+		if result := verify(t, name, false); len(result.Missing)+len(result.Corrupt) > 0 {
+			t.Errorf("expected no problems after repair, got %+v", result)
+		}
+	})
+}
@@ -0,0 +1,1313 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConvertJinja converts a Jinja chat template, as found in the
+// tokenizer.chat_template metadata of a model, to a template in this
+// package's format. It supports the subset of Jinja chat templates commonly
+// used: loops over the messages, conditionals on their roles, string
+// concatenation, the bos_token and eos_token variables and
+// add_generation_prompt, which is always true. eos is the text of the model's
+// EOS token, if it's known.
+//
+// Constructs which have no equivalent are left out, with a warning for each.
+// An error is returned for templates whose structure can't be converted.
+func ConvertJinja(s, eos string) (string, []string, error) {
+	tokens, err := lexJinja(s)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := jinjaParser{tokens: tokens}
+	nodes, err := p.parseNodes()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return "", nil, fmt.Errorf("unexpected {%% %s %%}", p.tokens[p.pos].value)
+	}
+
+	c := jinjaConverter{eos: eos, sets: p.sets, namespaces: p.namespaces}
+	body := c.convertNodes(nodes)
+
+	// variables are declared up front so they can be set in conditionals,
+	// whose scope in Jinja, unlike in Go templates, is the whole template
+	var sb strings.Builder
+	for _, name := range c.declared {
+		value := `""`
+		if name == "messages" {
+			value = "$.Messages"
+		}
+
+		fmt.Fprintf(&sb, "{{ $%s := %s }}", name, value)
+	}
+
+	sb.WriteString(body)
+	return sb.String(), c.warnings, nil
+}
+
+type jinjaTokenKind int
+
+const (
+	jinjaText jinjaTokenKind = iota
+	jinjaOutput
+	jinjaStatement
+	jinjaComment
+)
+
+type jinjaToken struct {
+	kind  jinjaTokenKind
+	value string
+
+	// trimLeft and trimRight are set by a - inside the delimiters, and
+	// keepLeft by a +, which disables lstrip_blocks
+	trimLeft, trimRight, keepLeft bool
+}
+
+// lexJinja splits a template into text and tags. Whitespace is handled as by
+// the environment tokenizers compile chat templates in, with trim_blocks and
+// lstrip_blocks set.
+func lexJinja(s string) ([]jinjaToken, error) {
+	var tokens []jinjaToken
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '{')
+		for i >= 0 && (i+1 >= len(s) || !strings.ContainsRune("{%#", rune(s[i+1]))) {
+			next := strings.IndexByte(s[i+1:], '{')
+			if next < 0 {
+				i = -1
+				break
+			}
+
+			i += next + 1
+		}
+
+		if i < 0 {
+			tokens = append(tokens, jinjaToken{kind: jinjaText, value: s})
+			break
+		}
+
+		if i > 0 {
+			tokens = append(tokens, jinjaToken{kind: jinjaText, value: s[:i]})
+		}
+
+		var t jinjaToken
+		var end string
+		switch s[i+1] {
+		case '{':
+			t.kind, end = jinjaOutput, "}}"
+		case '%':
+			t.kind, end = jinjaStatement, "%}"
+		case '#':
+			t.kind, end = jinjaComment, "#}"
+		}
+
+		s = s[i+2:]
+		if strings.HasPrefix(s, "-") {
+			t.trimLeft, s = true, s[1:]
+		} else if strings.HasPrefix(s, "+") {
+			t.keepLeft, s = true, s[1:]
+		}
+
+		j := indexTagEnd(s, end, t.kind != jinjaComment)
+		if j < 0 {
+			return nil, fmt.Errorf("unterminated tag, expected %q", end)
+		}
+
+		t.value = s[:j]
+		if strings.HasSuffix(t.value, "-") {
+			t.trimRight, t.value = true, t.value[:len(t.value)-1]
+		} else if strings.HasSuffix(t.value, "+") {
+			t.value = t.value[:len(t.value)-1]
+		}
+
+		t.value = strings.TrimSpace(t.value)
+		tokens = append(tokens, t)
+		s = s[j+len(end):]
+	}
+
+	// lstrip_blocks applies to whitespace at the start of a line of the
+	// template, before any whitespace control
+	lineStart := make([]bool, len(tokens))
+	for i, t := range tokens {
+		lineStart[i] = t.kind == jinjaText && (i == 0 || strings.Contains(t.value, "\n"))
+	}
+
+	for i, t := range tokens {
+		if t.kind == jinjaText {
+			continue
+		}
+
+		block := t.kind != jinjaOutput
+		if i > 0 && tokens[i-1].kind == jinjaText {
+			prev := &tokens[i-1].value
+			if t.trimLeft {
+				*prev = strings.TrimRight(*prev, " \t\r\n")
+			} else if block && !t.keepLeft {
+				// lstrip_blocks removes the indentation before a block tag
+				line := (*prev)[strings.LastIndexByte(*prev, '\n')+1:]
+				if strings.Trim(line, " \t") == "" && lineStart[i-1] {
+					*prev = (*prev)[:len(*prev)-len(line)]
+				}
+			}
+		}
+
+		if i+1 < len(tokens) && tokens[i+1].kind == jinjaText {
+			next := &tokens[i+1].value
+			if t.trimRight {
+				*next = strings.TrimLeft(*next, " \t\r\n")
+			} else if block {
+				// trim_blocks removes the first newline after a block tag
+				if strings.HasPrefix(*next, "\r\n") {
+					*next = (*next)[2:]
+				} else {
+					*next = strings.TrimPrefix(*next, "\n")
+				}
+			}
+		}
+	}
+
+	return slices.DeleteFunc(tokens, func(t jinjaToken) bool {
+		return t.kind == jinjaComment || (t.kind == jinjaText && t.value == "")
+	}), nil
+}
+
+// indexTagEnd returns the index of the end delimiter of a tag, skipping
+// string literals unless the tag is a comment.
+func indexTagEnd(s, end string, quotes bool) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == '\\':
+			i++
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case quotes && (s[i] == '\'' || s[i] == '"'):
+			quote = s[i]
+		case strings.HasPrefix(s[i:], "-"+end), strings.HasPrefix(s[i:], "+"+end):
+			return i + 1
+		case strings.HasPrefix(s[i:], end):
+			return i
+		}
+	}
+
+	return -1
+}
+
+type jinjaNode any
+
+type jinjaTextNode struct {
+	text string
+}
+
+type jinjaOutputNode struct {
+	expr jinjaExpr
+}
+
+type jinjaBranch struct {
+	cond jinjaExpr
+	body []jinjaNode
+}
+
+type jinjaIfNode struct {
+	branches []jinjaBranch
+
+	// otherwise is the body of the else branch, if any
+	otherwise []jinjaNode
+}
+
+type jinjaForNode struct {
+	name   string
+	iter   jinjaExpr
+	filter jinjaExpr
+	body   []jinjaNode
+}
+
+type jinjaSetNode struct {
+	name  string
+	value jinjaExpr
+}
+
+type jinjaParser struct {
+	tokens []jinjaToken
+	pos    int
+
+	// sets are the names of the variables the template sets
+	sets []string
+
+	// namespaces are the names of the variables set to namespaces
+	namespaces []string
+}
+
+// parseNodes parses nodes until the end of the template or a statement which
+// ends a block, which is left to the caller.
+func (p *jinjaParser) parseNodes() ([]jinjaNode, error) {
+	var nodes []jinjaNode
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		switch t.kind {
+		case jinjaText:
+			nodes = append(nodes, jinjaTextNode{t.value})
+		case jinjaOutput:
+			expr, err := parseJinjaExpr(t.value)
+			if err != nil {
+				return nil, err
+			}
+
+			nodes = append(nodes, jinjaOutputNode{expr})
+		case jinjaStatement:
+			keyword, rest, _ := strings.Cut(t.value, " ")
+			rest = strings.TrimSpace(rest)
+			switch keyword {
+			case "if":
+				node, err := p.parseIf(rest)
+				if err != nil {
+					return nil, err
+				}
+
+				nodes = append(nodes, node)
+				continue
+			case "for":
+				node, err := p.parseFor(rest)
+				if err != nil {
+					return nil, err
+				}
+
+				nodes = append(nodes, node)
+				continue
+			case "set":
+				name, value, ok := strings.Cut(rest, "=")
+				name = strings.TrimSpace(name)
+
+				// attributes of namespaces are variables of their own
+				if ns, attr, ok := strings.Cut(name, "."); ok && slices.Contains(p.namespaces, ns) {
+					name = ns + "_" + attr
+				}
+
+				if !ok || !isJinjaName(name) {
+					return nil, fmt.Errorf("unsupported statement {%% %s %%}", t.value)
+				}
+
+				expr, err := parseJinjaExpr(value)
+				if err != nil {
+					return nil, err
+				}
+
+				if call, ok := expr.(jinjaCall); ok && call.fn == (jinjaName{"namespace"}) {
+					p.namespaces = append(p.namespaces, name)
+					for _, kwarg := range call.kwargs {
+						nodes = append(nodes, p.set(name+"_"+kwarg.name, kwarg.value))
+					}
+				} else {
+					nodes = append(nodes, p.set(name, expr))
+				}
+			case "elif", "else", "endif", "endfor":
+				return nodes, nil
+			default:
+				return nil, fmt.Errorf("unsupported statement {%% %s %%}", t.value)
+			}
+		}
+
+		p.pos++
+	}
+
+	return nodes, nil
+}
+
+func (p *jinjaParser) set(name string, value jinjaExpr) jinjaSetNode {
+	if !slices.Contains(p.sets, name) {
+		p.sets = append(p.sets, name)
+	}
+
+	return jinjaSetNode{name, value}
+}
+
+// end consumes the statement ending a block, which must be one of keywords.
+func (p *jinjaParser) end(keywords ...string) (string, string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", "", fmt.Errorf("missing {%% %s %%}", keywords[len(keywords)-1])
+	}
+
+	keyword, rest, _ := strings.Cut(p.tokens[p.pos].value, " ")
+	if !slices.Contains(keywords, keyword) {
+		return "", "", fmt.Errorf("unexpected {%% %s %%}", p.tokens[p.pos].value)
+	}
+
+	p.pos++
+	return keyword, strings.TrimSpace(rest), nil
+}
+
+func (p *jinjaParser) parseIf(cond string) (jinjaNode, error) {
+	var node jinjaIfNode
+	p.pos++
+	for {
+		expr, err := parseJinjaExpr(cond)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := p.parseNodes()
+		if err != nil {
+			return nil, err
+		}
+
+		node.branches = append(node.branches, jinjaBranch{expr, body})
+
+		keyword, rest, err := p.end("elif", "else", "endif")
+		if err != nil {
+			return nil, err
+		}
+
+		switch keyword {
+		case "elif":
+			cond = rest
+			continue
+		case "else":
+			if node.otherwise, err = p.parseNodes(); err != nil {
+				return nil, err
+			}
+
+			if _, _, err := p.end("endif"); err != nil {
+				return nil, err
+			}
+		}
+
+		return node, nil
+	}
+}
+
+func (p *jinjaParser) parseFor(s string) (jinjaNode, error) {
+	name, iter, ok := strings.Cut(s, " in ")
+	name = strings.TrimSpace(name)
+	if !ok || !isJinjaName(name) {
+		return nil, fmt.Errorf("unsupported statement {%% for %s %%}", s)
+	}
+
+	// for x in xs if cond filters the items
+	var filter jinjaExpr
+	if before, cond, ok := strings.Cut(iter, " if "); ok {
+		var err error
+		if filter, err = parseJinjaExpr(cond); err != nil {
+			return nil, err
+		}
+
+		iter = before
+	}
+
+	expr, err := parseJinjaExpr(iter)
+	if err != nil {
+		return nil, err
+	}
+
+	p.pos++
+	body, err := p.parseNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := p.end("endfor"); err != nil {
+		return nil, err
+	}
+
+	return jinjaForNode{name: name, iter: expr, filter: filter, body: body}, nil
+}
+
+func isJinjaName(s string) bool {
+	if s == "" || isDigit(s[0]) {
+		return false
+	}
+
+	for i := range len(s) {
+		if !isNameByte(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || isDigit(b) || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+type jinjaExpr any
+
+type (
+	jinjaName    struct{ name string }
+	jinjaLiteral struct{ value any }
+	jinjaAttr    struct {
+		x    jinjaExpr
+		name string
+	}
+	jinjaList  struct{ items []jinjaExpr }
+	jinjaIndex struct{ x, index jinjaExpr }
+	jinjaSlice struct{ x, lo, hi jinjaExpr }
+	jinjaCall  struct {
+		fn     jinjaExpr
+		args   []jinjaExpr
+		kwargs []jinjaKwarg
+	}
+	jinjaKwarg struct {
+		name  string
+		value jinjaExpr
+	}
+	jinjaFilter struct {
+		x    jinjaExpr
+		name string
+	}
+	jinjaTest struct {
+		x      jinjaExpr
+		name   string
+		negate bool
+	}
+	jinjaBinary struct {
+		op   string
+		x, y jinjaExpr
+	}
+	jinjaUnary struct {
+		op string
+		x  jinjaExpr
+	}
+)
+
+// jinjaOperators are the operators of Jinja expressions, longest first.
+var jinjaOperators = []string{"==", "!=", "<=", ">=", "//", "**", "<", ">", "+", "-", "*", "/", "%", "~", "|", "(", ")", "[", "]", ".", ",", ":", "="}
+
+type jinjaExprParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseJinjaExpr(s string) (jinjaExpr, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		case isNameByte(c):
+			j := i
+			for j < len(s) && isNameByte(s[j]) {
+				j++
+			}
+
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			op := ""
+			for _, o := range jinjaOperators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q in expression", c)
+			}
+
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+
+	p := jinjaExprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+
+	return expr, nil
+}
+
+func (p *jinjaExprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *jinjaExprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *jinjaExprParser) expect(t string) error {
+	if next := p.next(); next != t {
+		return fmt.Errorf("expected %q in expression, got %q", t, next)
+	}
+
+	return nil
+}
+
+func (p *jinjaExprParser) parseOr() (jinjaExpr, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.peek() == "or" {
+		p.next()
+		var y jinjaExpr
+		y, err = p.parseAnd()
+		x = jinjaBinary{"or", x, y}
+	}
+
+	return x, err
+}
+
+func (p *jinjaExprParser) parseAnd() (jinjaExpr, error) {
+	x, err := p.parseNot()
+	for err == nil && p.peek() == "and" {
+		p.next()
+		var y jinjaExpr
+		y, err = p.parseNot()
+		x = jinjaBinary{"and", x, y}
+	}
+
+	return x, err
+}
+
+func (p *jinjaExprParser) parseNot() (jinjaExpr, error) {
+	if p.peek() == "not" {
+		p.next()
+		x, err := p.parseNot()
+		return jinjaUnary{"not", x}, err
+	}
+
+	return p.parseCompare()
+}
+
+func (p *jinjaExprParser) parseCompare() (jinjaExpr, error) {
+	x, err := p.parseAdd()
+	for err == nil {
+		switch op := p.peek(); op {
+		case "==", "!=", "<", ">", "<=", ">=", "in":
+			p.next()
+			var y jinjaExpr
+			y, err = p.parseAdd()
+			x = jinjaBinary{op, x, y}
+		case "not":
+			// not in
+			if p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1] != "in" {
+				return x, nil
+			}
+
+			p.pos += 2
+			var y jinjaExpr
+			y, err = p.parseAdd()
+			x = jinjaBinary{"not in", x, y}
+		case "is":
+			p.next()
+			test := jinjaTest{x: x}
+			if p.peek() == "not" {
+				p.next()
+				test.negate = true
+			}
+
+			test.name = p.next()
+			if !isJinjaName(test.name) {
+				return nil, fmt.Errorf("invalid test %q", test.name)
+			}
+
+			x = test
+		default:
+			return x, nil
+		}
+	}
+
+	return x, err
+}
+
+func (p *jinjaExprParser) parseAdd() (jinjaExpr, error) {
+	x, err := p.parseMul()
+	for err == nil && (p.peek() == "+" || p.peek() == "-" || p.peek() == "~") {
+		op := p.next()
+		var y jinjaExpr
+		y, err = p.parseMul()
+		x = jinjaBinary{op, x, y}
+	}
+
+	return x, err
+}
+
+func (p *jinjaExprParser) parseMul() (jinjaExpr, error) {
+	x, err := p.parseUnary()
+	for err == nil && slices.Contains([]string{"*", "/", "//", "%", "**"}, p.peek()) {
+		op := p.next()
+		var y jinjaExpr
+		y, err = p.parseUnary()
+		x = jinjaBinary{op, x, y}
+	}
+
+	return x, err
+}
+
+func (p *jinjaExprParser) parseUnary() (jinjaExpr, error) {
+	if p.peek() == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if lit, ok := x.(jinjaLiteral); ok {
+			if n, ok := lit.value.(int); ok {
+				return jinjaLiteral{-n}, err
+			}
+		}
+
+		return jinjaUnary{"-", x}, err
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *jinjaExprParser) parsePostfix() (jinjaExpr, error) {
+	x, err := p.parsePrimary()
+	for err == nil {
+		switch p.peek() {
+		case ".":
+			p.next()
+			name := p.next()
+			if !isJinjaName(name) {
+				return nil, fmt.Errorf("invalid attribute %q", name)
+			}
+
+			x = jinjaAttr{x, name}
+		case "[":
+			p.next()
+			var lo, hi jinjaExpr
+			if p.peek() != ":" {
+				if lo, err = p.parseOr(); err != nil {
+					return nil, err
+				}
+			}
+
+			if p.peek() == ":" {
+				p.next()
+				if p.peek() != "]" {
+					if hi, err = p.parseOr(); err != nil {
+						return nil, err
+					}
+				}
+
+				x = jinjaSlice{x, lo, hi}
+			} else if lit, ok := lo.(jinjaLiteral); ok && isString(lit.value) {
+				x = jinjaAttr{x, lit.value.(string)}
+			} else {
+				x = jinjaIndex{x, lo}
+			}
+
+			err = p.expect("]")
+		case "(":
+			p.next()
+			call := jinjaCall{fn: x}
+			for p.peek() != ")" && err == nil {
+				name := p.peek()
+				if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "=" && isJinjaName(name) {
+					p.pos += 2
+					kwarg := jinjaKwarg{name: name}
+					kwarg.value, err = p.parseOr()
+					call.kwargs = append(call.kwargs, kwarg)
+				} else {
+					var arg jinjaExpr
+					arg, err = p.parseOr()
+					call.args = append(call.args, arg)
+				}
+
+				if err == nil && p.peek() == "," {
+					p.next()
+				}
+			}
+
+			x = call
+			if err == nil {
+				err = p.expect(")")
+			}
+		case "|":
+			p.next()
+			name := p.next()
+			if !isJinjaName(name) {
+				return nil, fmt.Errorf("invalid filter %q", name)
+			}
+
+			x = jinjaFilter{x, name}
+			if p.peek() == "(" {
+				// filter arguments are parsed and discarded
+				p.next()
+				for p.peek() != ")" && err == nil {
+					if _, err = p.parseOr(); err == nil && p.peek() == "," {
+						p.next()
+					}
+				}
+
+				if err == nil {
+					err = p.expect(")")
+				}
+			}
+		default:
+			return x, nil
+		}
+	}
+
+	return x, err
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func (p *jinjaExprParser) parsePrimary() (jinjaExpr, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of expression")
+	case t == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		return x, p.expect(")")
+	case t == "[":
+		var list jinjaList
+		for p.peek() != "]" {
+			item, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			list.items = append(list.items, item)
+			if p.peek() == "," {
+				p.next()
+			}
+		}
+
+		return list, p.expect("]")
+	case t[0] == '\'' || t[0] == '"':
+		s, err := unquoteJinja(t)
+		return jinjaLiteral{s}, err
+	case isDigit(t[0]):
+		n, err := strconv.Atoi(t)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported number %q", t)
+		}
+
+		return jinjaLiteral{n}, nil
+	case t == "true" || t == "True":
+		return jinjaLiteral{true}, nil
+	case t == "false" || t == "False":
+		return jinjaLiteral{false}, nil
+	case t == "none" || t == "None":
+		return jinjaLiteral{nil}, nil
+	case isJinjaName(t):
+		return jinjaName{t}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q in expression", t)
+	}
+}
+
+// unquoteJinja unquotes a Jinja string literal, which has Python's escape
+// sequences.
+func unquoteJinja(s string) (string, error) {
+	body := s[1 : len(s)-1]
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 >= len(body) {
+			sb.WriteByte(body[i])
+			continue
+		}
+
+		i++
+		switch body[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case '\\', '\'', '"':
+			sb.WriteByte(body[i])
+		default:
+			return "", fmt.Errorf("unsupported escape sequence \\%c", body[i])
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// goExpr is an expression in a Go template. Pipelines need parentheses
+// when they are the argument of another pipeline.
+type goExpr struct {
+	s        string
+	pipeline bool
+}
+
+func (e goExpr) operand() string {
+	if e.pipeline {
+		return "(" + e.s + ")"
+	}
+
+	return e.s
+}
+
+var (
+	goTrue  = goExpr{s: "true"}
+	goFalse = goExpr{s: "false"}
+	goEmpty = goExpr{s: `""`}
+)
+
+type jinjaLoop struct {
+	name  string
+	index string
+	iter  goExpr
+}
+
+type jinjaConverter struct {
+	eos        string
+	sets       []string
+	namespaces []string
+	declared   []string
+	loops      []jinjaLoop
+	warnings   []string
+}
+
+func (c *jinjaConverter) warnf(format string, args ...any) {
+	if w := fmt.Sprintf(format, args...); !slices.Contains(c.warnings, w) {
+		c.warnings = append(c.warnings, w)
+	}
+}
+
+func (c *jinjaConverter) convertNodes(nodes []jinjaNode) string {
+	// raise_exception validates the messages, which are assumed to be valid,
+	// so blocks which raise are never rendered
+	if slices.ContainsFunc(nodes, func(n jinjaNode) bool {
+		output, ok := n.(jinjaOutputNode)
+		return ok && isRaise(output.expr)
+	}) {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case jinjaTextNode:
+			// {{ in the text would start an action
+			sb.WriteString(strings.ReplaceAll(n.text, "{{", `{{ "{{" }}`))
+		case jinjaOutputNode:
+			fmt.Fprintf(&sb, "{{ %s }}", c.convertExpr(n.expr).s)
+		case jinjaSetNode:
+			if isBuiltin(n.name) {
+				continue
+			}
+
+			if !slices.Contains(c.declared, n.name) {
+				c.declared = append(c.declared, n.name)
+			}
+
+			fmt.Fprintf(&sb, "{{ $%s = %s }}", n.name, c.convertExpr(n.value).s)
+		case jinjaIfNode:
+			sb.WriteString(c.convertIf(n))
+		case jinjaForNode:
+			sb.WriteString(c.convertFor(n))
+		}
+	}
+
+	return sb.String()
+}
+
+func (c *jinjaConverter) convertIf(n jinjaIfNode) string {
+	bodies := make([]string, len(n.branches))
+	empty := true
+	for i, branch := range n.branches {
+		bodies[i] = c.convertNodes(branch.body)
+		empty = empty && bodies[i] == ""
+	}
+
+	otherwise := c.convertNodes(n.otherwise)
+	if empty && otherwise == "" {
+		// a conditional with nothing in it, such as one which only raises an
+		// exception for invalid messages
+		return ""
+	}
+
+	var sb strings.Builder
+branches:
+	for i, branch := range n.branches {
+		switch cond := c.convertExpr(branch.cond); {
+		case cond == goFalse:
+			// the branch is never taken
+			continue
+		case cond == goTrue && sb.Len() == 0:
+			// the branch is always taken
+			return bodies[i]
+		case cond == goTrue:
+			otherwise = bodies[i]
+			break branches
+		case sb.Len() == 0:
+			fmt.Fprintf(&sb, "{{ if %s }}", cond.s)
+		default:
+			fmt.Fprintf(&sb, "{{ else if %s }}", cond.s)
+		}
+
+		sb.WriteString(bodies[i])
+	}
+
+	if sb.Len() == 0 {
+		return otherwise
+	}
+
+	if otherwise != "" {
+		sb.WriteString("{{ else }}")
+		sb.WriteString(otherwise)
+	}
+
+	sb.WriteString("{{ end }}")
+	return sb.String()
+}
+
+func (c *jinjaConverter) convertFor(n jinjaForNode) string {
+	iter := c.convertExpr(n.iter)
+	loop := jinjaLoop{name: n.name, index: fmt.Sprintf("$%c", 'i'+len(c.loops)), iter: iter}
+
+	c.loops = append(c.loops, loop)
+	defer func() { c.loops = c.loops[:len(c.loops)-1] }()
+
+	body := c.convertNodes(n.body)
+	if n.filter != nil {
+		c.warnf("loop filters change loop.index, loop.first and loop.last")
+		if cond := c.convertExpr(n.filter); cond != goTrue {
+			body = fmt.Sprintf("{{ if %s }}%s{{ end }}", cond.s, body)
+		}
+	}
+
+	return fmt.Sprintf("{{ range %s, $%s := %s }}%s{{ end }}", loop.index, n.name, iter.s, body)
+}
+
+func isRaise(expr jinjaExpr) bool {
+	call, ok := expr.(jinjaCall)
+	if !ok {
+		return false
+	}
+
+	name, ok := call.fn.(jinjaName)
+	return ok && name.name == "raise_exception"
+}
+
+func isBuiltin(name string) bool {
+	return slices.Contains([]string{"add_generation_prompt", "bos_token", "eos_token"}, name)
+}
+
+func (c *jinjaConverter) loop(name string) *jinjaLoop {
+	for i := len(c.loops) - 1; i >= 0; i-- {
+		if c.loops[i].name == name {
+			return &c.loops[i]
+		}
+	}
+
+	return nil
+}
+
+func (c *jinjaConverter) convertExpr(expr jinjaExpr) goExpr {
+	switch e := expr.(type) {
+	case jinjaLiteral:
+		switch v := e.value.(type) {
+		case string:
+			return goExpr{s: strconv.Quote(v)}
+		case int:
+			return goExpr{s: strconv.Itoa(v)}
+		case bool:
+			if v {
+				return goTrue
+			}
+
+			return goFalse
+		default:
+			return goEmpty
+		}
+	case jinjaName:
+		return c.convertName(e.name)
+	case jinjaAttr:
+		return c.convertAttr(e)
+	case jinjaIndex:
+		lit, ok := e.index.(jinjaLiteral)
+		if n, isInt := lit.value.(int); ok && isInt && n >= 0 {
+			return goExpr{s: fmt.Sprintf("index %s %d", c.convertExpr(e.x).operand(), n), pipeline: true}
+		}
+
+		c.warnf("only non-negative constant indexes are supported")
+		return goEmpty
+	case jinjaSlice:
+		lo, _ := e.lo.(jinjaLiteral)
+		n, ok := lo.value.(int)
+		if e.lo == nil {
+			n, ok = 0, true
+		}
+
+		if !ok || n < 0 || e.hi != nil {
+			c.warnf("only slices from a non-negative constant index to the end are supported")
+			return c.convertExpr(e.x)
+		}
+
+		return goExpr{s: fmt.Sprintf("slice %s %d", c.convertExpr(e.x).operand(), n), pipeline: true}
+	case jinjaCall:
+		if isRaise(e) {
+			return goEmpty
+		}
+
+		if attr, ok := e.fn.(jinjaAttr); ok {
+			c.warnf("method %s isn't supported and is ignored", attr.name)
+			return c.convertExpr(attr.x)
+		}
+
+		c.warnf("function calls aren't supported")
+		return goEmpty
+	case jinjaFilter:
+		x := c.convertExpr(e.x)
+		switch e.name {
+		case "length", "count":
+			return goExpr{s: "len " + x.operand(), pipeline: true}
+		case "string", "safe":
+			return x
+		default:
+			c.warnf("filter %s isn't supported and is ignored", e.name)
+			return x
+		}
+	case jinjaTest:
+		result := c.convertTest(e)
+		if e.negate {
+			return not(result)
+		}
+
+		return result
+	case jinjaUnary:
+		if e.op == "not" {
+			return not(c.convertExpr(e.x))
+		}
+
+		c.warnf("arithmetic isn't supported")
+		return goEmpty
+	case jinjaBinary:
+		return c.convertBinary(e)
+	}
+
+	return goEmpty
+}
+
+func not(x goExpr) goExpr {
+	switch x {
+	case goTrue:
+		return goFalse
+	case goFalse, goEmpty:
+		return goTrue
+	}
+
+	return goExpr{s: "not " + x.operand(), pipeline: true}
+}
+
+func (c *jinjaConverter) convertName(name string) goExpr {
+	switch {
+	case name == "messages" && !slices.Contains(c.sets, name):
+		return goExpr{s: "$.Messages"}
+	case name == "add_generation_prompt":
+		return goTrue
+	case name == "bos_token":
+		// the BOS token is added when the prompt is tokenized
+		return goEmpty
+	case name == "eos_token":
+		if c.eos == "" {
+			c.warnf("eos_token is unknown and is left out")
+			return goEmpty
+		}
+
+		return goExpr{s: strconv.Quote(c.eos)}
+	case c.loop(name) != nil, slices.Contains(c.sets, name):
+		if !slices.Contains(c.declared, name) && c.loop(name) == nil {
+			c.declared = append(c.declared, name)
+		}
+
+		return goExpr{s: "$" + name}
+	default:
+		c.warnf("variable %s isn't supported and is undefined", name)
+		return goEmpty
+	}
+}
+
+func (c *jinjaConverter) convertAttr(e jinjaAttr) goExpr {
+	if name, ok := e.x.(jinjaName); ok && name.name == "loop" && len(c.loops) > 0 {
+		loop := c.loops[len(c.loops)-1]
+		switch e.name {
+		case "first":
+			return goExpr{s: fmt.Sprintf("eq %s 0", loop.index), pipeline: true}
+		case "last":
+			return goExpr{s: fmt.Sprintf("eq (len (slice %s %s)) 1", loop.iter.operand(), loop.index), pipeline: true}
+		case "index0":
+			return goExpr{s: loop.index}
+		case "length":
+			return goExpr{s: "len " + loop.iter.operand(), pipeline: true}
+		default:
+			c.warnf("loop.%s isn't supported", e.name)
+			return goEmpty
+		}
+	}
+
+	if name, ok := e.x.(jinjaName); ok && slices.Contains(c.namespaces, name.name) {
+		return c.convertName(name.name + "_" + e.name)
+	}
+
+	var field string
+	switch e.name {
+	case "role":
+		field = "Role"
+	case "content":
+		field = "Content"
+	default:
+		c.warnf("message field %s isn't supported and is undefined", e.name)
+		return goEmpty
+	}
+
+	x := c.convertExpr(e.x)
+	if x == goEmpty {
+		return goEmpty
+	}
+
+	return goExpr{s: x.operand() + "." + field}
+}
+
+func (c *jinjaConverter) convertTest(e jinjaTest) goExpr {
+	switch e.name {
+	case "defined":
+		if name, ok := e.x.(jinjaName); ok && name.name != "messages" && !isBuiltin(name.name) && c.loop(name.name) == nil {
+			if !slices.Contains(c.sets, name.name) {
+				return goFalse
+			}
+
+			// variables which are set are declared empty up front
+			return c.convertName(name.name)
+		}
+
+		return goTrue
+	case "none":
+		return not(c.convertExpr(e.x))
+	case "string":
+		// message content is always a string
+		return goTrue
+	default:
+		c.warnf("test %s isn't supported and is false", e.name)
+		return goFalse
+	}
+}
+
+func (c *jinjaConverter) convertBinary(e jinjaBinary) goExpr {
+	switch e.op {
+	case "+", "~":
+		// concatenation, which flattens into a single print
+		var args []string
+		for _, operand := range []jinjaExpr{e.x, e.y} {
+			x := c.convertExpr(operand)
+			if strings.HasPrefix(x.s, "print ") && x.pipeline {
+				args = append(args, strings.TrimPrefix(x.s, "print "))
+			} else if x != goEmpty {
+				args = append(args, x.operand())
+			}
+		}
+
+		if len(args) == 0 {
+			return goEmpty
+		}
+
+		return goExpr{s: "print " + strings.Join(args, " "), pipeline: true}
+	case "and", "or":
+		x, y := c.convertExpr(e.x), c.convertExpr(e.y)
+		switch {
+		case e.op == "and" && (x == goFalse || y == goFalse):
+			return goFalse
+		case e.op == "and" && x == goTrue:
+			return y
+		case e.op == "and" && y == goTrue:
+			return x
+		case e.op == "or" && (x == goTrue || y == goTrue):
+			return goTrue
+		case e.op == "or" && x == goFalse:
+			return y
+		case e.op == "or" && y == goFalse:
+			return x
+		}
+
+		return goExpr{s: fmt.Sprintf("%s %s %s", e.op, x.operand(), y.operand()), pipeline: true}
+	case "==", "!=", "<", ">", "<=", ">=":
+		fn := map[string]string{"==": "eq", "!=": "ne", "<": "lt", ">": "gt", "<=": "le", ">=": "ge"}[e.op]
+		x, y := c.convertExpr(e.x), c.convertExpr(e.y)
+
+		// comparing values of different types is an error in Go templates,
+		// so comparisons with booleans and none test truthiness instead
+		if lit, ok := e.y.(jinjaLiteral); ok && (e.op == "==" || e.op == "!=") && !isString(lit.value) {
+			if _, isInt := lit.value.(int); !isInt {
+				if (lit.value == true) != (e.op == "==") {
+					return not(x)
+				}
+
+				return x
+			}
+		}
+
+		return goExpr{s: fmt.Sprintf("%s %s %s", fn, x.operand(), y.operand()), pipeline: true}
+	case "in", "not in":
+		// membership in a list of constants, such as roles
+		list, ok := e.y.(jinjaList)
+		if !ok {
+			c.warnf("the %s operator is only supported with lists and is false", e.op)
+			return goFalse
+		}
+
+		x := c.convertExpr(e.x)
+		var args []string
+		for _, item := range list.items {
+			args = append(args, fmt.Sprintf("(eq %s %s)", x.operand(), c.convertExpr(item).operand()))
+		}
+
+		var result goExpr
+		switch len(args) {
+		case 0:
+			result = goFalse
+		case 1:
+			result = goExpr{s: strings.Trim(args[0], "()"), pipeline: true}
+		default:
+			result = goExpr{s: "or " + strings.Join(args, " "), pipeline: true}
+		}
+
+		if e.op == "not in" {
+			return not(result)
+		}
+
+		return result
+	default:
+		c.warnf("arithmetic isn't supported")
+		return goEmpty
+	}
+}
@@ -0,0 +1,194 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestConvertJinja(t *testing.T) {
+	messages := []api.Message{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Content: "Hello, how are you?"},
+		{Role: "assistant", Content: "I'm doing great."},
+		{Role: "user", Content: "Tell me a joke."},
+	}
+
+	cases := []struct {
+		name     string
+		jinja    string
+		expect   string
+		warnings []string
+	}{
+		{
+			name:   "loop",
+			jinja:  "{% for message in messages %}<|{{ message['role'] }}|>{{ message.content }}\n{% endfor %}{% if add_generation_prompt %}<|assistant|>{% endif %}",
+			expect: "<|system|>You are a helpful assistant.\n<|user|>Hello, how are you?\n<|assistant|>I'm doing great.\n<|user|>Tell me a joke.\n<|assistant|>",
+		},
+		{
+			name: "roles",
+			jinja: `{{ bos_token }}{% for message in messages %}
+    {% if message['role'] == 'user' %}
+[INST] {{ message['content'] }} [/INST]
+    {%- elif message['role'] == 'assistant' %}
+{{ message['content'] + eos_token }}
+    {%- endif %}
+{% endfor %}`,
+			expect: "[INST] Hello, how are you? [/INST]I'm doing great.</s>[INST] Tell me a joke. [/INST]",
+		},
+		{
+			name:   "loop variables",
+			jinja:  "{% for message in messages %}{% if loop.first %}[{% endif %}{{ loop.index0 }}{% if not loop.last %},{% else %}/{{ loop.length }}]{% endif %}{% endfor %}",
+			expect: "[0,1,2,3/4]",
+		},
+		{
+			name:   "system message",
+			jinja:  "{% if messages[0]['role'] == 'system' %}{% set system = messages[0]['content'] %}{% set messages = messages[1:] %}{% else %}{% set system = 'default' %}{% endif %}{% for message in messages[1:] %}{{ message.content }} {% endfor %}({{ system }})",
+			expect: "I'm doing great. Tell me a joke. (You are a helpful assistant.)",
+		},
+		{
+			name:   "namespace",
+			jinja:  "{% set ns = namespace(found=false) %}{% for message in messages %}{% if message.role == 'system' %}{% set ns.found = true %}{% endif %}{% endfor %}{% if not ns.found %}default{% endif %}{{ messages | length }}",
+			expect: "4",
+		},
+		{
+			name:   "validation",
+			jinja:  "{% for message in messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 1) %}{{ raise_exception('Conversation roles must alternate') }}{% endif %}{{ message.content }}{% endfor %}",
+			expect: "You are a helpful assistant.Hello, how are you?I'm doing great.Tell me a joke.",
+		},
+		{
+			name:   "membership",
+			jinja:  "{% for message in messages %}{% if message.role in ['user', 'system'] %}{{ message.content }}{% elif message.role not in ['tool'] %}.{% endif %}{% endfor %}",
+			expect: "You are a helpful assistant.Hello, how are you?.Tell me a joke.",
+		},
+		{
+			name:     "unknown eos",
+			jinja:    "{% for message in messages %}{{ message.content + eos_token }}{% endfor %}",
+			expect:   "You are a helpful assistant.Hello, how are you?I'm doing great.Tell me a joke.",
+			warnings: []string{"eos_token is unknown and is left out"},
+		},
+		{
+			name:     "unsupported",
+			jinja:    "{% for message in messages %}{{ message['content'] | trim }}{{ message.name }}{% if 'name' in message %}!{% endif %}{% endfor %}",
+			expect:   "You are a helpful assistant.Hello, how are you?I'm doing great.Tell me a joke.",
+			warnings: []string{"filter trim isn't supported and is ignored", "message field name isn't supported and is undefined", "the in operator is only supported with lists and is false"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			eos := "</s>"
+			if tt.name == "unknown eos" {
+				eos = ""
+			}
+
+			s, warnings, err := ConvertJinja(tt.jinja, eos)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.warnings, warnings); diff != "" {
+				t.Errorf("warnings mismatch (-want +got):\n%s", diff)
+			}
+
+			tmpl, err := Parse(s)
+			if err != nil {
+				t.Fatalf("%s: %v", s, err)
+			}
+
+			var b bytes.Buffer
+			if err := tmpl.Execute(&b, Values{Messages: messages}); err != nil {
+				t.Fatalf("%s: %v", s, err)
+			}
+
+			if diff := cmp.Diff(tt.expect, b.String()); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertJinjaError(t *testing.T) {
+	cases := map[string]string{
+		"unterminated": "{% for message in messages %}{{ message.content",
+		"missing end":  "{% for message in messages %}{{ message.content }}",
+		"unexpected":   "{{ message.content }}{% endif %}",
+		"macro":        "{% macro render(message) %}{{ message.content }}{% endmacro %}",
+		"expression":   "{{ message.content @ 2 }}",
+	}
+
+	for name, s := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := ConvertJinja(s, ""); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestConvertJinjaTemplates(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "templates.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	messages := []api.Message{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Content: "Hello, how are you?"},
+		{Role: "assistant", Content: "I'm doing great. How can I help you today?"},
+		{Role: "user", Content: "I'd like to show off how chat templating works!"},
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ss map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &ss); err != nil {
+			t.Fatal(err)
+		}
+
+		for k, v := range ss {
+			t.Run(k, func(t *testing.T) {
+				s, _, err := ConvertJinja(llm.KV{"tokenizer.chat_template": v}.ChatTemplate(), "</s>")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tmpl, err := Parse(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var b bytes.Buffer
+				if err := tmpl.Execute(&b, Values{Messages: messages}); err != nil {
+					t.Fatal(err)
+				}
+
+				for _, m := range messages[1:] {
+					if !strings.Contains(b.String(), m.Content) {
+						t.Errorf("expected %q in %q", m.Content, b.String())
+					}
+				}
+
+				if k == "chatml" || k == "llama3-instruct" {
+					expect, err := os.ReadFile(filepath.Join("testdata", k+".gotmpl", "system-user-assistant-user"))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if !strings.HasSuffix(b.String(), string(expect[len(expect)/2:])) {
+						t.Errorf("expected output to end like %q, got %q", expect, b.String())
+					}
+				}
+			})
+		}
+	}
+}
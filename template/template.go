@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"slices"
 	"strings"
@@ -22,7 +23,7 @@ import (
 //go:embed index.json
 var indexBytes []byte
 
-//go:embed *.gotmpl
+//go:embed *.gotmpl *.json
 var templatesFS embed.FS
 
 var templatesOnce = sync.OnceValues(func() ([]*named, error) {
@@ -39,14 +40,46 @@ var templatesOnce = sync.OnceValues(func() ([]*named, error) {
 
 		// normalize line endings
 		t.Bytes = bytes.ReplaceAll(bts, []byte("\r\n"), []byte("\n"))
+
+		// the metadata is of the named template, shared by every chat
+		// template it matches
+		bts, err = templatesFS.ReadFile(t.Name + ".json")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(bts, &t.Metadata); err != nil {
+			return nil, fmt.Errorf("%s.json: %w", t.Name, err)
+		}
 	}
 
 	return templates, nil
 })
 
+// Metadata describes how a named template renders chats. It's read from the
+// JSON file named after the template.
+type Metadata struct {
+	// Stop lists the stop sequences which end a response, such as the
+	// tokens which start and end each turn.
+	Stop []string `json:"stop,omitempty"`
+
+	// BOS reports whether the prompt should start with the BOS token. The
+	// template leaves it out for the tokenizer to add.
+	BOS bool `json:"bos,omitempty"`
+
+	// Roles lists the roles of the messages the template renders.
+	Roles []string `json:"roles,omitempty"`
+
+	// Tools reports whether the template renders tools and tool calls.
+	Tools bool `json:"tools,omitempty"`
+}
+
 type named struct {
 	Name     string `json:"name"`
 	Template string `json:"template"`
+	Metadata `json:"-"`
 	Bytes    []byte
 }
 
@@ -76,6 +109,24 @@ func Named(s string) (*named, error) {
 	return nil, errors.New("no matching template found")
 }
 
+// Lookup returns the named template whose text is s, ignoring leading and
+// trailing whitespace.
+func Lookup(s string) (*named, bool) {
+	templates, err := templatesOnce()
+	if err != nil {
+		return nil, false
+	}
+
+	s = strings.TrimSpace(s)
+	for _, t := range templates {
+		if strings.TrimSpace(string(t.Bytes)) == s {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
 var DefaultTemplate, _ = Parse("{{ .Prompt }}")
 
 type Template struct {
@@ -141,6 +192,163 @@ func (t *Template) Vars() []string {
 	return vars
 }
 
+// legacyRoles are the roles of the messages templates which don't range over
+// the messages render, see [Template.Execute].
+var legacyRoles = []string{"system", "user", "assistant"}
+
+// Roles returns the roles of the messages the template renders, or nil if it
+// renders messages of any role. Named templates render the roles they
+// declare, and tool messages if they render tools. The roles of other
+// templates are guessed, see guessRoles.
+func (t *Template) Roles() []string {
+	if n, ok := Lookup(t.raw); ok && n.Roles != nil {
+		roles := slices.Clone(n.Roles)
+		if n.Tools && !slices.Contains(roles, "tool") {
+			roles = append(roles, "tool")
+		}
+
+		return roles
+	}
+
+	return t.guessRoles()
+}
+
+// guessRoles returns the roles of the messages the template renders, or nil
+// if it renders messages of any role. The roles of templates which range over
+// the messages are those the template compares .Role to, unless it prints
+// .Role or renders messages of other roles in an else branch.
+func (t *Template) guessRoles() []string {
+	vars := t.Vars()
+	if !slices.Contains(vars, "messages") {
+		return legacyRoles
+	}
+
+	var roles []string
+	if slices.Contains(vars, "system") {
+		roles = append(roles, "system")
+	}
+
+	for _, tt := range t.Templates() {
+		if !collectRoles(tt.Root, &roles) {
+			return nil
+		}
+	}
+
+	if len(roles) == 0 || len(roles) == 1 && roles[0] == "system" {
+		return nil
+	}
+
+	return roles
+}
+
+// collectRoles adds the roles n compares .Role to to roles. It returns false
+// if n renders messages of any role.
+func collectRoles(n parse.Node, roles *[]string) bool {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return true
+		}
+
+		for _, c := range n.Nodes {
+			if !collectRoles(c, roles) {
+				return false
+			}
+		}
+	case *parse.ActionNode:
+		// printing the role renders messages of any role
+		for _, c := range n.Pipe.Cmds {
+			if slices.ContainsFunc(c.Args, isRole) && compareRole(c) == "" {
+				return false
+			}
+		}
+	case *parse.IfNode:
+		compares, ok := collectComparisons(n.Pipe, roles)
+		if !ok || !collectRoles(n.List, roles) {
+			return false
+		}
+
+		if n.ElseList == nil {
+			return true
+		}
+
+		// an else branch of a comparison renders messages of the other
+		// roles, unless it's an else if
+		if compares && !(len(n.ElseList.Nodes) == 1 && n.ElseList.Nodes[0].Type() == parse.NodeIf) {
+			return false
+		}
+
+		return collectRoles(n.ElseList, roles)
+	case *parse.RangeNode:
+		return collectRoles(n.List, roles) && collectRoles(n.ElseList, roles)
+	case *parse.WithNode:
+		return collectRoles(n.List, roles) && collectRoles(n.ElseList, roles)
+	}
+
+	return true
+}
+
+// collectComparisons adds the roles p compares .Role to to roles and reports
+// whether it compares any. ok is false if p compares .Role with ne, which
+// matches messages of any other role.
+func collectComparisons(p *parse.PipeNode, roles *[]string) (compares, ok bool) {
+	for _, c := range p.Cmds {
+		switch compareRole(c) {
+		case "eq":
+			for _, arg := range c.Args[1:] {
+				if s, ok := arg.(*parse.StringNode); ok && !slices.Contains(*roles, s.Text) {
+					*roles = append(*roles, s.Text)
+				}
+			}
+
+			compares = true
+		case "ne":
+			return true, false
+		}
+
+		for _, arg := range c.Args {
+			if p, isPipe := arg.(*parse.PipeNode); isPipe {
+				c, ok := collectComparisons(p, roles)
+				if !ok {
+					return true, false
+				}
+
+				compares = compares || c
+			}
+		}
+	}
+
+	return compares, true
+}
+
+// compareRole returns "eq" or "ne" if c compares .Role with that function.
+func compareRole(c *parse.CommandNode) string {
+	if len(c.Args) < 2 || !slices.ContainsFunc(c.Args[1:], isRole) {
+		return ""
+	}
+
+	if fn, ok := c.Args[0].(*parse.IdentifierNode); ok && (fn.Ident == "eq" || fn.Ident == "ne") {
+		return fn.Ident
+	}
+
+	return ""
+}
+
+// isRole reports whether n is the Role field of a message.
+func isRole(n parse.Node) bool {
+	var ident []string
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		ident = n.Ident
+	case *parse.VariableNode:
+		ident = n.Ident
+	case *parse.ChainNode:
+		ident = n.Field
+	}
+
+	return len(ident) > 0 && ident[len(ident)-1] == "Role"
+}
+
 type Values struct {
 	Messages []api.Message
 
@@ -161,7 +369,7 @@ func (t *Template) Execute(w io.Writer, v Values) error {
 	var b bytes.Buffer
 	var prompt, response string
 	for _, m := range messages {
-		execute := func () error {
+		execute := func() error {
 			if err := t.Template.Execute(&b, map[string]any{
 				"System":   system,
 				"Prompt":   prompt,
@@ -297,6 +505,12 @@ func parseNode(n parse.Node) []string {
 		return names
 	case *parse.FieldNode:
 		return n.Ident
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return n.Ident[1:]
+		}
+	case *parse.ChainNode:
+		return append(parseNode(n.Node), n.Field...)
 	case *parse.TemplateNode:
 		return parseNode(n.Pipe)
 	}
@@ -56,11 +56,79 @@ func TestNamed(t *testing.T) {
 				if tmpl.Tree.Root.String() == "" {
 					t.Errorf("empty %s template", k)
 				}
+
+				if len(r.Stop) == 0 {
+					t.Errorf("expected stop sequences for %s", k)
+				}
+
+				if diff := cmp.Diff(r.Roles, tmpl.guessRoles()); diff != "" {
+					t.Errorf("roles mismatch (-metadata +template):\n%s", diff)
+				}
+
+				// every chat template of a named template shares its metadata
+				l, ok := Lookup(b.String())
+				if !ok || l.Name != k {
+					t.Fatalf("expected lookup to find %s", k)
+				}
+
+				if diff := cmp.Diff(r.Metadata, l.Metadata); diff != "" {
+					t.Errorf("metadata mismatch (-named +lookup):\n%s", diff)
+				}
+
 			})
 		}
 	}
 }
 
+func TestRoles(t *testing.T) {
+	cases := []struct {
+		template string
+		expect   []string
+	}{
+		{"{{ .System }} {{ .Prompt }} {{ .Response }}", []string{"system", "user", "assistant"}},
+		{"{{ range .Messages }}<|{{ .Role }}|>{{ .Content }}{{ end }}", nil},
+		{"{{ range .Messages }}{{ if eq .Role \"user\" }}Q: {{ .Content }}{{ else if eq .Role \"assistant\" }}A: {{ .Content }}{{ end }}{{ end }}", []string{"user", "assistant"}},
+		{"{{ if .System }}{{ .System }}{{ end }}{{ range .Messages }}{{ if or (eq .Role \"user\") (eq .Role \"tool\") }}Q: {{ .Content }}{{ else if eq .Role \"assistant\" }}A: {{ .Content }}{{ end }}{{ end }}", []string{"system", "user", "tool", "assistant"}},
+		{"{{ range $i, $m := .Messages }}{{ if eq $m.Role \"user\" }}Q: {{ $m.Content }}{{ else }}A: {{ $m.Content }}{{ end }}{{ end }}", nil},
+		{"{{ range .Messages }}{{ if ne .Role \"system\" }}{{ .Content }}{{ end }}{{ end }}", nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.expect, tmpl.Roles()); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("named", func(t *testing.T) {
+		bts, err := templatesFS.ReadFile("chatml.gotmpl")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tmpl, err := Parse(string(bts))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// named templates render the roles they declare
+		n, _ := Lookup(string(bts))
+		n.Roles = []string{"user", "assistant"}
+		n.Tools = true
+		t.Cleanup(func() { n.Roles, n.Tools = []string{"system", "user", "assistant"}, false })
+
+		if diff := cmp.Diff([]string{"user", "assistant", "tool"}, tmpl.Roles()); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
 func TestTemplate(t *testing.T) {
 	cases := make(map[string][]api.Message)
 	for _, mm := range [][]api.Message{